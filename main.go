@@ -1,19 +1,332 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/wcharczuk/train-sim/simulation"
 )
 
+// interactive runs the simulation in the terminal UI, with the terminal in raw mode while it does.
+func interactive(ctx context.Context, sim *simulation.Simulation) error {
+	saved, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("the terminal UI needs a terminal: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return err
+	}
+	defer stty(saved)
+
+	ui := simulation.NewTUI(sim, os.Stdin, os.Stdout)
+	if size, err := stty("size"); err == nil {
+		fmt.Sscan(size, &ui.Height, &ui.Width)
+	}
+	return ui.Run(ctx)
+}
+
+// browse runs the simulation in the web viewer on addr until interrupted.
+func browse(ctx context.Context, sim *simulation.Simulation, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	viewer := simulation.NewViewer(sim)
+	httpServer := &http.Server{Handler: viewer}
+	go httpServer.Serve(listener)
+	defer httpServer.Shutdown(context.Background())
+	fmt.Fprintf(os.Stderr, "viewer at http://%s/, ctrl-c to stop\n", listener.Addr())
+	return viewer.Run(ctx)
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// serve runs the HTTP API on addr until interrupted, keeping results in dir, or in memory without one.
+func serve(config simulation.Config, addr, dir string, workers int, maxDrain, stallTimeout time.Duration) {
+	var store simulation.ResultStore = simulation.NewMemoryResultStore()
+	if len(dir) > 0 {
+		store = simulation.NewDiskResultStore(dir)
+	}
+	server, err := simulation.NewServer(config, store, workers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	defer server.Close()
+	server.MaxDrainTime = maxDrain
+	server.StallTimeout = stallTimeout
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	httpServer := &http.Server{Addr: addr, Handler: server}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	fmt.Fprintf(os.Stderr, "serving the API on %s\n", addr)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serveMetrics serves the run's metrics on addr in the background, for as long as the program runs.
+func serveMetrics(sim *simulation.Simulation, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	metrics := simulation.NewMetrics()
+	sim.Observers = append(sim.Observers, metrics)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go http.Serve(listener, mux)
+	return nil
+}
+
+// sweepFlags collects every -sweep flag given.
+type sweepFlags []simulation.SweepParameter
+
+func (sf *sweepFlags) String() string {
+	return fmt.Sprint(*sf)
+}
+
+func (sf *sweepFlags) Set(value string) error {
+	parameter, err := simulation.ParseSweepParameter(value)
+	if err != nil {
+		return err
+	}
+	*sf = append(*sf, parameter)
+	return nil
+}
+
 func delay(d time.Duration) *time.Duration {
 	return &d
 }
 
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func compare(config simulation.Config, path string, replications, workers int) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	other := config.Clone()
+	if err := json.Unmarshal(contents, &other); err != nil {
+		fmt.Fprintf(os.Stderr, "reading %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if err := other.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	comparison := simulation.NewComparison(
+		simulation.Scenario{Name: "default", Config: config},
+		simulation.Scenario{Name: path, Config: other},
+		replications,
+		config.Seed,
+	)
+	comparison.Parallelism = workers
+	fmt.Print(comparison.Run())
+}
+
+// replay steps through a journaled run, reading commands from stdin: enter or n for the
+// next step, b to go back a step, g <step> to go to a step, and q to quit.
+func replay(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	journaled, err := simulation.NewReplay(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	var width int
+	if size, err := stty("size"); err == nil {
+		fmt.Sscan(size, new(int), &width)
+	}
+
+	commands := bufio.NewScanner(os.Stdin)
+	for {
+		err = nil
+		fmt.Printf("\nStep %d of %d (n, b, g <step>, q): ", journaled.Step(), journaled.Len())
+		if !commands.Scan() {
+			return
+		}
+		command := strings.Fields(commands.Text())
+		switch {
+		case len(command) == 0 || command[0] == "n":
+			{
+				err = journaled.Forward()
+			}
+		case command[0] == "b":
+			{
+				err = journaled.Back()
+			}
+		case command[0] == "g" && len(command) == 2:
+			{
+				step, parseErr := strconv.Atoi(command[1])
+				if parseErr != nil {
+					err = parseErr
+				} else {
+					err = journaled.Seek(step)
+				}
+			}
+		case command[0] == "q":
+			{
+				return
+			}
+		default:
+			{
+				err = fmt.Errorf("unknown command: %q", commands.Text())
+			}
+		}
+
+		journaled.Simulation().DisplayWidth = width
+		journaled.Simulation().Display()
+		if journaled.Step() > 0 {
+			for _, e := range journaled.Recorded(journaled.Step() - 1).Events {
+				fmt.Println(e)
+			}
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
 func main() {
+	seed := flag.Int64("seed", 0, "random seed for the run, 0 picks one from the clock")
+	engine := flag.String("engine", simulation.EngineStepped, "how runs advance: stepped, every step length, or event, from one event to the next with exact train runs and fixed signal blocks, whose results differ from stepped's by up to about an eighth at a 1s step")
+	stationLayouts := flag.Bool("station-layouts", false, "give stations entrances and vertical circulation, so passengers take time to walk to and from the platform")
+	wheelchairShare := flag.Float64("wheelchair-share", 0, "fraction of passengers in wheelchairs, who need a step-free route")
+	strollerShare := flag.Float64("stroller-share", 0, "fraction of passengers with strollers, who need a step-free route")
+	concessions := flag.Bool("concessions", false, "give a reduced fare to a share of riders, which changes the random draws of a seeded run")
+	segments := flag.Bool("segments", false, "split passengers into commuters, tourists and students, who travel at different hours, walk at different speeds and wait different lengths of time")
+	startOfDay := flag.Duration("start-of-day", 0, "time of day the run starts at, e.g. 7h, which sets when segmented passengers travel and which fares apply")
+	timeSeriesPath := flag.String("timeseries", "", "write sampled time-series to this file")
+	timeSeriesFormat := flag.String("timeseries-format", "csv", "time-series file format, csv or jsonl")
+	timeSeriesInterval := flag.Duration("timeseries-interval", time.Minute, "simulated time between time-series samples")
+	eventsPath := flag.String("events", "", "write the event log to this file as JSON lines")
+	eventsLevel := flag.String("events-level", "info", "lowest event severity to write: debug, info, warn or error")
+	trajectoriesPath := flag.String("trajectories", "", "write every train's trajectory to this file as CSV")
+	stringLinePath := flag.String("stringline", "", "write a time-distance (string line) diagram to this file as SVG")
+	trajectoryInterval := flag.Duration("trajectory-interval", 5*time.Second, "simulated time between trajectory samples")
+	reportPath := flag.String("report", "", "write a self-contained HTML report of the run to this file")
+	comparePath := flag.String("compare", "", "compare against the config in this JSON file, which overrides fields of the default config")
+	replications := flag.Int("replications", 10, "paired runs per scenario when comparing, or runs per point when sweeping or optimizing")
+	monteCarlo := flag.Int("monte-carlo", 0, "run up to this many independent replications and report means with confidence intervals")
+	precision := flag.Float64("precision", 0.02, "stop replicating once the mean wait and journey intervals are within this fraction of the mean")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "simulations to run at once when comparing, replicating or sweeping")
+	var sweep sweepFlags
+	flag.Var(&sweep, "sweep", "sweep a config field over values, e.g. total_train_count=24,32,40; repeat for a grid")
+	optimize := flag.String("optimize", "", "find the first of a config field's values that meets the targets, e.g. total_train_count=8,16,24,32")
+	maxP95Wait := flag.Duration("max-p95-wait", 10*time.Minute, "target 95th percentile wait when optimizing")
+	maxLoadFactor := flag.Float64("max-load-factor", 0.8, "target mean load factor on the busiest track when optimizing")
+	checkpointPath := flag.String("checkpoint", "", "write the simulation's state to this file part way through the run, which needs the stepped engine")
+	checkpointAt := flag.Duration("checkpoint-at", time.Hour, "simulated time to write the checkpoint at")
+	resumePath := flag.String("resume", "", "carry on the run saved in this checkpoint file instead of starting a new one, with the stepped engine")
+	journalPath := flag.String("journal", "", "write a journal of every random draw, event and train movement in the run to this file")
+	replayPath := flag.String("replay", "", "step through the run journaled in this file instead of running")
+	maxDrain := flag.Duration("max-drain", 4*time.Hour, "give up if the trains aren't all back in the yard this long after the end of service, 0 waits forever")
+	stallTimeout := flag.Duration("stall-timeout", 30*time.Minute, "give up if no train moves for this much simulated time, 0 waits forever")
+	progress := flag.Bool("progress", false, "report how far along the run is on stderr")
+	serveAddr := flag.String("serve", "", "serve an HTTP API for running simulations and fetching their results on this address, e.g. localhost:8080")
+	resultsDir := flag.String("results", "", "keep the API's run results in this directory rather than in memory")
+	metricsAddr := flag.String("metrics", "", "serve Prometheus metrics about the run at /metrics on this address while it goes, e.g. localhost:9100")
+	webAddr := flag.String("web", "", "run in a live viewer in the browser, served on this address, e.g. localhost:8080")
+	tui := flag.Bool("tui", false, "run in an interactive terminal UI that can pause, step, inspect stations and trains, and hold trains or start incidents by hand")
+	checkInvariants := flag.Bool("check-invariants", false, "check the simulation's invariants after every step, which is slow, and report any violations")
+	flag.Parse()
+
+	if len(*replayPath) > 0 {
+		replay(*replayPath)
+		return
+	}
+
 	sim := simulation.New(1*time.Second, 3*time.Hour, nil)
+	if *seed != 0 {
+		sim.SetSeed(*seed)
+	}
 
 	sim.TrainCapacity = 512
+	sim.UseStationLayouts = *stationLayouts
+	sim.WheelchairShare = *wheelchairShare
+	sim.StrollerShare = *strollerShare
+	sim.StartOfDay = *startOfDay
+	if *segments {
+		sim.Segments = simulation.DefaultSegments()
+	}
+	if *concessions {
+		sim.Concessions = simulation.DefaultConcessions()
+	}
+
+	if *engine != simulation.EngineStepped && *engine != simulation.EngineEvent {
+		fmt.Fprintf(os.Stderr, "unknown engine: %q\n", *engine)
+		os.Exit(1)
+	}
+	sim.Engine = *engine
+	if err := simulation.RecorderFormat(*timeSeriesFormat).Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if *engine == simulation.EngineEvent && (len(*checkpointPath) > 0 || len(*resumePath) > 0) {
+		fmt.Fprintf(os.Stderr, "-checkpoint and -resume need the stepped engine\n")
+		os.Exit(1)
+	}
+
+	if len(*resumePath) > 0 {
+		file, err := os.Open(*resumePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		sim, err = simulation.ReadCheckpoint(file)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *resumePath, err)
+			os.Exit(1)
+		}
+	}
+	if err := sim.Config().Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 
 	/*sim.TotalTrainCount = 64
 	sim.AverageTimeBetweenTrains = 45 * time.Second
@@ -23,5 +336,210 @@ func main() {
 	sim.TrainAverageBraking = 3.0
 	sim.TrainMaximumSpeed = 50.0 // ~111 mph*/
 
-	sim.Run()
+	if len(*serveAddr) > 0 {
+		serve(sim.Config(), *serveAddr, *resultsDir, *workers, *maxDrain, *stallTimeout)
+		return
+	}
+	if len(*comparePath) > 0 {
+		compare(sim.Config(), *comparePath, *replications, *workers)
+		return
+	}
+	if len(sweep) > 0 {
+		runner := simulation.NewGridSweep(simulation.Scenario{Name: "default", Config: sim.Config()}, sim.Seed, sweep...)
+		runner.Replications = *replications
+		runner.Workers = *workers
+		result, err := runner.Run()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(result)
+		return
+	}
+	if len(*optimize) > 0 {
+		parameter, err := simulation.ParseSweepParameter(*optimize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		optimizer := simulation.NewOptimizer(simulation.Scenario{Name: "default", Config: sim.Config()}, sim.Seed, parameter, simulation.ServiceTargets{
+			MaxP95Wait:    *maxP95Wait,
+			MaxLoadFactor: *maxLoadFactor,
+		})
+		optimizer.Sweep.Replications = *replications
+		optimizer.Sweep.Workers = *workers
+		result, err := optimizer.Run()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(result)
+		return
+	}
+	if *monteCarlo > 0 {
+		runner := simulation.NewReplicationRunner(simulation.Scenario{Name: "default", Config: sim.Config()}, sim.Seed)
+		runner.MaxReplications = *monteCarlo
+		runner.TargetPrecision = *precision
+		runner.Workers = *workers
+		fmt.Print(runner.Run())
+		return
+	}
+
+	var recorder *simulation.Recorder
+	if len(*timeSeriesPath) > 0 {
+		file, err := os.Create(*timeSeriesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		if recorder, err = simulation.NewRecorder(file, simulation.RecorderFormat(*timeSeriesFormat), *timeSeriesInterval); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		sim.Observers = append(sim.Observers, recorder)
+	}
+
+	if len(*eventsPath) > 0 {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(*eventsLevel)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		file, err := os.Create(*eventsPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		sim.Events.Subscribe(simulation.EventFilter{MinimumLevel: level}, simulation.NewJSONLEventWriter(file))
+	}
+
+	var trajectories *simulation.TrajectoryRecorder
+	if len(*trajectoriesPath) > 0 || len(*stringLinePath) > 0 || len(*reportPath) > 0 {
+		trajectories = simulation.NewTrajectoryRecorder(*trajectoryInterval)
+		sim.Observers = append(sim.Observers, trajectories)
+	}
+
+	var checker *simulation.InvariantChecker
+	if *checkInvariants {
+		checker = simulation.NewInvariantChecker()
+		sim.Observers = append(sim.Observers, checker)
+	}
+
+	if len(*resumePath) == 0 {
+		sim.Generate()
+	}
+	var journal *simulation.Journal
+	if len(*journalPath) > 0 {
+		file, err := os.Create(*journalPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		if journal, err = simulation.NewJournal(file, sim); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		// closing from a defer too means a run that panics still journals the step that panicked.
+		defer journal.Close()
+	}
+	if len(*checkpointPath) > 0 {
+		sim.RunUntil(*checkpointAt)
+		if err := writeFile(*checkpointPath, sim.WriteCheckpoint); err != nil {
+			fmt.Fprintf(os.Stderr, "writing checkpoint: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	sim.MaxDrainTime = *maxDrain
+	sim.StallTimeout = *stallTimeout
+	// $COLUMNS usually isn't exported to programs, so ask the terminal how wide it is.
+	if size, err := stty("size"); err == nil {
+		fmt.Sscan(size, new(int), &sim.DisplayWidth)
+	}
+	if *progress {
+		sim.Progress = func(progress simulation.RunProgress) {
+			fmt.Fprintf(os.Stderr, "%v\n", progress)
+		}
+	}
+	if len(*metricsAddr) > 0 {
+		if err := serveMetrics(sim, *metricsAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *tui {
+		if err := interactive(ctx, sim); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if !sim.IsFinished() {
+			// quit part way, so there's nothing to report.
+			return
+		}
+	}
+	if len(*webAddr) > 0 {
+		if err := browse(ctx, sim, *webAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		if !sim.IsFinished() {
+			return
+		}
+		// the viewer was stopped with ctrl-c after the run was over, so there's only the stats left.
+		ctx = context.Background()
+	}
+	stats, err := sim.FinishContext(ctx)
+	if err != nil {
+		if journal != nil {
+			journal.Close()
+		}
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Simulation Stats:\n%v", stats)
+
+	if journal != nil {
+		if err := journal.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "writing journal: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(*trajectoriesPath) > 0 {
+		if err := writeFile(*trajectoriesPath, trajectories.WriteCSV); err != nil {
+			fmt.Fprintf(os.Stderr, "writing trajectories: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(*stringLinePath) > 0 {
+		if err := writeFile(*stringLinePath, simulation.NewStringLineDiagram(sim.Stations, trajectories).WriteSVG); err != nil {
+			fmt.Fprintf(os.Stderr, "writing string line diagram: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(*reportPath) > 0 {
+		if err := writeFile(*reportPath, sim.NewReport(sim.ComputeStats(), trajectories).WriteHTML); err != nil {
+			fmt.Fprintf(os.Stderr, "writing report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "writing time-series: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if checker != nil && checker.Found > 0 {
+		for _, violation := range checker.Violations {
+			fmt.Fprintf(os.Stderr, "%v\n", violation)
+		}
+		fmt.Fprintf(os.Stderr, "%v\n", checker.Err())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,189 @@
+package simulation
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/blendlabs/go-util"
+)
+
+// ElevatorOutage takes elevators at a station out of service for a window of simulated time.
+// An empty Elevator name takes out every elevator at the station.
+type ElevatorOutage struct {
+	Station  string        `json:"station"`
+	Elevator string        `json:"elevator,omitempty"`
+	Start    time.Duration `json:"start"`
+	End      time.Duration `json:"end"`
+}
+
+// UnmarshalJSON replaces the outage rather than merging into it, so a config's
+// outages decoded over another's don't pick up the other's elevator.
+func (eo *ElevatorOutage) UnmarshalJSON(data []byte) error {
+	type plain ElevatorOutage
+	var decoded plain
+	if err := decodeStrictly(data, &decoded); err != nil {
+		return err
+	}
+	*eo = ElevatorOutage(decoded)
+	return nil
+}
+
+// IsActive returns if the outage covers the given time.
+func (eo ElevatorOutage) IsActive(wallClock time.Duration) bool {
+	return wallClock >= eo.Start && wallClock < eo.End
+}
+
+// Affects returns if the outage applies to the given elevator.
+func (eo ElevatorOutage) Affects(station *Station, elevator *Circulation) bool {
+	if eo.Station != station.Name {
+		return false
+	}
+	return len(eo.Elevator) == 0 || eo.Elevator == elevator.Name
+}
+
+// ScheduleElevatorOutage adds an outage starting at `start` and lasting `duration`.
+func (s *Simulation) ScheduleElevatorOutage(station, elevator string, start, duration time.Duration) {
+	s.ElevatorOutages = append(s.ElevatorOutages, ElevatorOutage{
+		Station:  station,
+		Elevator: elevator,
+		Start:    start,
+		End:      start + duration,
+	})
+}
+
+// ApplyElevatorOutages puts elevators in or out of service per the outage schedule.
+func (s *Simulation) ApplyElevatorOutages() {
+	if len(s.ElevatorOutages) == 0 {
+		return
+	}
+
+	for _, station := range s.Stations {
+		if station.Layout == nil {
+			continue
+		}
+		for _, entrance := range station.Layout.Entrances {
+			for _, elevator := range entrance.Elevators() {
+				var outOfService bool
+				for _, outage := range s.ElevatorOutages {
+					if outage.Affects(station, elevator) && outage.IsActive(s.WallClock) {
+						outOfService = true
+						break
+					}
+				}
+
+				if outOfService && !elevator.OutOfService {
+					s.publishStation(EventElevatorOutOfOrder, slog.LevelWarn, station, "%s at %s out of service", elevator.Name, station.Name)
+				} else if !outOfService && elevator.OutOfService {
+					s.publishStation(EventElevatorRestored, slog.LevelInfo, station, "%s at %s back in service", elevator.Name, station.Name)
+				}
+				elevator.OutOfService = outOfService
+			}
+		}
+	}
+}
+
+// StationByName returns the station with the given name, or nil.
+func (s *Simulation) StationByName(name string) *Station {
+	for _, station := range s.Stations {
+		if station.Name == name {
+			return station
+		}
+	}
+	return nil
+}
+
+// PlanStepFreeTrip checks a step-free rider can get in at the origin and out at their destination,
+// rerouting them to the nearest step-free station if their destination isn't.
+// It returns false if the rider can't make the trip.
+func (s *Simulation) PlanStepFreeTrip(origin *Station, p *Passenger) bool {
+	if !origin.HasStepFreeAccess() {
+		return false
+	}
+
+	destination := s.StationByName(p.Destination)
+	if destination == nil || destination.HasStepFreeAccess() {
+		return true
+	}
+
+	alternate := s.nearestStepFreeStation(destination, origin)
+	if alternate == nil {
+		return false
+	}
+
+	p.Destination = alternate.Name
+	p.IsOutBound = s.DestinationIsOutbound(origin, p.Destination)
+	p.Reroutes++
+	return true
+}
+
+func (s *Simulation) nearestStepFreeStation(to, except *Station) *Station {
+	var nearest *Station
+	var nearestStops int
+	for _, isOutbound := range []bool{true, false} {
+		candidate := to.NextStepFreeStation(isOutbound)
+		if candidate == nil || candidate == except {
+			continue
+		}
+		stops := s.StopsToDestination(isOutbound, to, candidate.Name)
+		if nearest == nil || stops < nearestStops {
+			nearest = candidate
+			nearestStops = stops
+		}
+	}
+	return nearest
+}
+
+func (s *Simulation) randomMobilityNeed() MobilityNeed {
+	if s.WheelchairShare <= 0 && s.StrollerShare <= 0 {
+		// nobody needs a step-free route, so don't take a draw other runs wouldn't.
+		return MobilityNone
+	}
+	draw := s.Provider.Float64()
+	if draw < s.WheelchairShare {
+		return MobilityWheelchair
+	}
+	if draw < s.WheelchairShare+s.StrollerShare {
+		return MobilityStroller
+	}
+	return MobilityNone
+}
+
+func (s *Simulation) computeStepFreeStats() *StepFreeStats {
+	if s.WheelchairShare <= 0 && s.StrollerShare <= 0 {
+		return nil
+	}
+	var stepFreeWaiting, otherWaiting, stepFreeJourneys, otherJourneys []time.Duration
+	stats := &StepFreeStats{
+		UnableToTravel: s.StepFreeUnableToTravel,
+	}
+
+	for x := 0; x < s.People.Len(); x++ {
+		p := s.People.Dequeue()
+		if p.NeedsStepFree() {
+			stats.Trips += len(p.Journeys)
+			stats.Rerouted += p.Reroutes
+			stats.Stranded += p.Stranded
+			stats.UnableToTravel += p.Stranded
+		}
+		// every trip counts once, leaving out those started while the line was still filling with trains.
+		for _, trip := range p.Trips {
+			if trip.EnteredAt < s.StasisAt {
+				continue
+			}
+			if p.NeedsStepFree() {
+				stepFreeWaiting = append(stepFreeWaiting, trip.Waiting)
+				stepFreeJourneys = append(stepFreeJourneys, trip.ExitedAt-trip.EnteredAt)
+			} else {
+				otherWaiting = append(otherWaiting, trip.Waiting)
+				otherJourneys = append(otherJourneys, trip.ExitedAt-trip.EnteredAt)
+			}
+		}
+		s.People.Enqueue(p)
+	}
+
+	stats.AverageWaitingTime = util.MeanOfDuration(stepFreeWaiting)
+	stats.AverageJourneyTime = util.MeanOfDuration(stepFreeJourneys)
+	stats.AverageOtherWaitingTime = util.MeanOfDuration(otherWaiting)
+	stats.AverageOtherJourneyTime = util.MeanOfDuration(otherJourneys)
+	return stats
+}
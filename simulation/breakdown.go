@@ -0,0 +1,175 @@
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+	"time"
+)
+
+// StationStats are the passenger counts and waits at one station.
+type StationStats struct {
+	Name            string
+	Boardings       int
+	Alightings      int
+	DeniedBoardings int
+	PeakWaiting     int
+	PeakWaitingAt   time.Duration
+
+	MeanWait time.Duration
+	P95Wait  time.Duration
+}
+
+// StationStatsTable renders the station stats as an aligned table.
+func StationStatsTable(stations []*StationStats) string {
+	buffer := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Station\tBoardings\tAlightings\tDenied\tPeak Waiting\tMean Wait\tP95 Wait")
+	for _, station := range stations {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d @ %v\t%v\t%v\n",
+			station.Name, station.Boardings, station.Alightings, station.DeniedBoardings,
+			station.PeakWaiting, station.PeakWaitingAt,
+			station.MeanWait.Round(time.Second), station.P95Wait.Round(time.Second),
+		)
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+// TrackStats are the loads and run times on one track between two stations, in one direction.
+type TrackStats struct {
+	From       string
+	To         string
+	IsOutbound bool
+
+	Trains     int
+	Passengers int
+	MeanLoad   float64
+	PeakLoad   int
+
+	// LoadFactor is the mean load as a fraction of the trains' capacity.
+	LoadFactor     float64
+	PeakLoadFactor float64
+
+	MeanRunTime time.Duration
+}
+
+// Name returns the track as "From → To".
+func (ts *TrackStats) Name() string {
+	return fmt.Sprintf("%s → %s", ts.From, ts.To)
+}
+
+// TrackStatsTable renders the track stats as an aligned table.
+func TrackStatsTable(tracks []*TrackStats) string {
+	buffer := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Track\tTrains\tPassengers\tMean Load\tPeak Load\tLoad Factor\tPeak Load Factor\tMean Run Time")
+	for _, track := range tracks {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%0.1f\t%d\t%0.0f%%\t%0.0f%%\t%v\n",
+			track.Name(), track.Trains, track.Passengers, track.MeanLoad, track.PeakLoad,
+			track.LoadFactor*100.0, track.PeakLoadFactor*100.0, track.MeanRunTime.Round(time.Second),
+		)
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+// PeakLoadTrack returns the track with the highest mean load, i.e. the line's peak load point.
+func PeakLoadTrack(tracks []*TrackStats) *TrackStats {
+	var peak *TrackStats
+	for _, track := range tracks {
+		if peak == nil || track.MeanLoad > peak.MeanLoad {
+			peak = track
+		}
+	}
+	return peak
+}
+
+func (s *Simulation) computeStationStats() []*StationStats {
+	waits := map[string]*Distribution{}
+	for _, station := range s.Stations {
+		waits[station.Name] = NewDistribution(station.Name)
+	}
+
+	for x := 0; x < s.People.Len(); x++ {
+		p := s.People.Dequeue()
+		for _, trip := range p.Trips {
+			if trip.EnteredAt < s.StasisAt {
+				continue
+			}
+			if wait, hasStation := waits[trip.Origin]; hasStation {
+				wait.Add(trip.Waiting)
+			}
+		}
+		s.People.Enqueue(p)
+	}
+
+	var stats []*StationStats
+	for _, station := range s.Stations {
+		wait := waits[station.Name]
+		stats = append(stats, &StationStats{
+			Name:            station.Name,
+			Boardings:       station.Boardings,
+			Alightings:      station.Alightings,
+			DeniedBoardings: station.DeniedBoardings,
+			PeakWaiting:     station.PeakWaiting,
+			PeakWaitingAt:   station.PeakWaitingAt,
+			MeanWait:        wait.Mean(),
+			P95Wait:         wait.Quantile(0.95),
+		})
+	}
+	return stats
+}
+
+// computeTrackStats returns the outbound tracks in line order, then the inbound tracks in line order.
+func (s *Simulation) computeTrackStats() []*TrackStats {
+	var stats []*TrackStats
+	station := s.InBoundTerminus()
+	for station.OutBoundTrack != nil {
+		stats = append(stats, s.trackStats(station.OutBoundTrack))
+		station = station.OutBoundTrack.End
+	}
+	station = s.OutBoundTerminus()
+	for station.InBoundTrack != nil {
+		stats = append(stats, s.trackStats(station.InBoundTrack))
+		station = station.InBoundTrack.End
+	}
+	return stats
+}
+
+func (s *Simulation) trackStats(track *Track) *TrackStats {
+	stats := &TrackStats{
+		From:       track.Begin.Name,
+		To:         track.End.Name,
+		IsOutbound: track.IsOutBound,
+	}
+
+	var totalCapacity int
+	var totalRunTime time.Duration
+	for _, traversal := range track.Traversals {
+		if traversal.DepartedAt < s.StasisAt {
+			continue
+		}
+		stats.Trains++
+		stats.Passengers += traversal.Load
+		totalCapacity += traversal.Capacity
+		totalRunTime += traversal.RunTime
+		if traversal.Load > stats.PeakLoad {
+			stats.PeakLoad = traversal.Load
+		}
+		if traversal.Capacity > 0 {
+			if loadFactor := float64(traversal.Load) / float64(traversal.Capacity); loadFactor > stats.PeakLoadFactor {
+				stats.PeakLoadFactor = loadFactor
+			}
+		}
+	}
+
+	if stats.Trains > 0 {
+		stats.MeanLoad = float64(stats.Passengers) / float64(stats.Trains)
+		stats.MeanRunTime = totalRunTime / time.Duration(stats.Trains)
+	}
+	if totalCapacity > 0 {
+		stats.LoadFactor = float64(stats.Passengers) / float64(totalCapacity)
+	}
+	return stats
+}
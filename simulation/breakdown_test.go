@@ -0,0 +1,58 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestTrainEmbarkPassengersDeniedWhenFull(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	station := sim.Stations[1]
+	for x := 0; x < 3; x++ {
+		p := sim.People.Dequeue()
+		p.IsOutBound = true
+		p.Destination = sim.Stations[5].Name
+		station.WaitingPassengers.Enqueue(p)
+	}
+
+	train := sim.Yard.Dequeue()
+	train.HasLeftYard(sim.WallClock)
+	train.Capacity = 2
+	train.EmbarkPassengers(sim.WallClock, station)
+
+	assert.Len(train.Passengers, 2)
+	assert.Equal(2, station.Boardings)
+	assert.Equal(1, station.DeniedBoardings)
+	assert.Equal(1, station.WaitingPassengers.Len())
+}
+
+func TestSimulationTrackStats(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.StasisAt = time.Hour
+
+	track := sim.Stations[2].OutBoundTrack
+	track.Traversals = []Traversal{
+		{TrainID: 1, DepartedAt: 30 * time.Minute, RunTime: time.Minute, Load: 900, Capacity: 1000},
+		{TrainID: 2, DepartedAt: 61 * time.Minute, RunTime: 2 * time.Minute, Load: 400, Capacity: 1000},
+		{TrainID: 3, DepartedAt: 65 * time.Minute, RunTime: 4 * time.Minute, Load: 800, Capacity: 1000},
+	}
+
+	tracks := sim.computeTrackStats()
+	assert.Len(tracks, 2*(len(sim.Stations)-1))
+
+	peak := PeakLoadTrack(tracks)
+	assert.NotNil(peak)
+	assert.Equal(sim.Stations[2].Name, peak.From)
+	assert.True(peak.IsOutbound)
+	assert.Equal(2, peak.Trains)
+	assert.InDelta(600, peak.MeanLoad, 0.001)
+	assert.Equal(800, peak.PeakLoad)
+	assert.InDelta(0.6, peak.LoadFactor, 0.001)
+	assert.InDelta(0.8, peak.PeakLoadFactor, 0.001)
+	assert.Equal(3*time.Minute, peak.MeanRunTime)
+}
@@ -0,0 +1,743 @@
+package simulation
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// CheckpointVersion is the version of the checkpoint format WriteCheckpoint writes, and the only one ReadCheckpoint reads.
+const CheckpointVersion = 1
+
+const checkpointMagic = "train-sim checkpoint"
+
+func newCountingSource(seed int64) *countingSource {
+	cs := &countingSource{}
+	cs.Seed(seed)
+	return cs
+}
+
+// countingSource is a math/rand source that counts the values drawn from it, so a checkpoint
+// can put it back where it was by reseeding it and drawing as many again.
+type countingSource struct {
+	source rand.Source64
+	seed   int64
+	draws  uint64
+
+	// record, if set, is handed every value drawn, for a journal.
+	record func(value uint64)
+
+	// replay, if set, is where values come from instead of source, replay[0] being draw replayFrom.
+	// Drawing past replayLimit panics with errReplayExhausted.
+	replay      []uint64
+	replayFrom  uint64
+	replayLimit uint64
+}
+
+func (cs *countingSource) Seed(seed int64) {
+	cs.source = rand.NewSource(seed).(rand.Source64)
+	cs.seed = seed
+	cs.draws = 0
+}
+
+// Int63 is the low 63 bits of Uint64, as it is for math/rand's own source.
+func (cs *countingSource) Int63() int64 {
+	return int64(cs.Uint64() & (1<<63 - 1))
+}
+
+func (cs *countingSource) Uint64() uint64 {
+	var value uint64
+	if cs.replay != nil {
+		if cs.draws >= cs.replayLimit {
+			panic(errReplayExhausted)
+		}
+		value = cs.replay[cs.draws-cs.replayFrom]
+	} else {
+		value = cs.source.Uint64()
+	}
+	cs.draws++
+	if cs.record != nil {
+		cs.record(value)
+	}
+	return value
+}
+
+// restore reseeds the source and skips over the values already drawn.
+func (cs *countingSource) restore(seed int64, draws uint64) {
+	cs.Seed(seed)
+	for cs.draws < draws {
+		cs.Uint64()
+	}
+}
+
+// WriteCheckpoint writes the whole state of a stepped simulation between steps, so ReadCheckpoint
+// can carry on from it exactly as the run would have, e.g. to resume a long run or to branch
+// "what if" runs off a mid-day state. Observers, event subscribers and PauseTime aren't saved.
+// Event engine runs can't be checkpointed, as their queue of pending events isn't saved.
+func (s *Simulation) WriteCheckpoint(w io.Writer) error {
+	if err := s.canCheckpoint(); err != nil {
+		return err
+	}
+	cp, err := newCheckpoint(s)
+	if err != nil {
+		return err
+	}
+	return cp.write(w)
+}
+
+func (s *Simulation) canCheckpoint() error {
+	if s.Engine == EngineEvent {
+		return fmt.Errorf("checkpoints need the stepped engine, the event engine's pending events aren't saved")
+	}
+	if s.source == nil {
+		return fmt.Errorf("checkpoints need the provider New sets up")
+	}
+	return nil
+}
+
+func (cp *checkpoint) write(w io.Writer) error {
+	compressed := gzip.NewWriter(w)
+	encoder := gob.NewEncoder(compressed)
+	if err := encoder.Encode(checkpointHeader{Magic: checkpointMagic, Version: CheckpointVersion}); err != nil {
+		return err
+	}
+	if err := encoder.Encode(cp); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// ReadCheckpoint returns the simulation saved by WriteCheckpoint, ready to carry on with RunUntil or Finish.
+func ReadCheckpoint(r io.Reader) (*Simulation, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %v", err)
+	}
+	decoder := gob.NewDecoder(compressed)
+	var header checkpointHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %v", err)
+	}
+	if header.Magic != checkpointMagic {
+		return nil, fmt.Errorf("not a checkpoint")
+	}
+	if header.Version != CheckpointVersion {
+		return nil, fmt.Errorf("checkpoint is version %d, only version %d can be read", header.Version, CheckpointVersion)
+	}
+	var cp checkpoint
+	if err := decoder.Decode(&cp); err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %v", err)
+	}
+	return cp.restore()
+}
+
+type checkpointHeader struct {
+	Magic   string
+	Version int
+}
+
+// checkpoint is a simulation with its pointers swapped for indexes into the checkpoint's
+// lists, -1 for nil, so the graph between stations, tracks, trains and passengers survives.
+type checkpoint struct {
+	Config     Config
+	SourceSeed int64
+	Draws      uint64
+
+	StepFreeUnableToTravel int
+	Segments               []Segment
+	Services               []Service
+	Concessions            []Concession
+	Incidents              []Incident
+
+	WallClock             time.Duration
+	Stasis                bool
+	StasisAt              time.Duration
+	Complete              bool
+	TotalAverageRidership int
+	LastTrainReleased     time.Duration
+
+	HasEvents         bool
+	EventCapacity     int
+	EventMinimumLevel slog.Level
+	Events            []Event
+	EventsPublished   int
+
+	Passengers []passengerCheckpoint
+	People     []int
+	Trains     []trainCheckpoint
+	Yard       []int
+	Stations   []stationCheckpoint
+}
+
+type passengerCheckpoint struct {
+	Passenger  Passenger
+	Segment    int
+	Concession int
+}
+
+type trainCheckpoint struct {
+	Train      Train
+	Service    int
+	Passengers []int
+}
+
+type stationCheckpoint struct {
+	Name               string
+	RidersPerDayMean   int
+	RidersPerDayStdDev float64
+	Chainage           float64
+
+	Departures      []Departure
+	Boardings       int
+	Alightings      int
+	DeniedBoardings int
+	PeakWaiting     int
+	PeakWaitingAt   time.Duration
+
+	Waiting       []int
+	OutBoundTrain int
+	InBoundTrain  int
+	OutBoundTrack *trackCheckpoint
+	InBoundTrack  *trackCheckpoint
+	Layout        *layoutCheckpoint
+}
+
+type trackCheckpoint struct {
+	DistanceMeters float64
+	IsOutBound     bool
+	End            int
+	Trains         []int
+	Traversals     []Traversal
+}
+
+type layoutCheckpoint struct {
+	PlatformWalkTime time.Duration
+	Entrances        []entranceCheckpoint
+	Circulations     []circulationCheckpoint
+	Movements        []movementCheckpoint
+}
+
+type entranceCheckpoint struct {
+	Name     string
+	WalkTime time.Duration
+	Path     []int
+}
+
+type circulationCheckpoint struct {
+	Kind              CirculationKind
+	Name              string
+	TraversalTime     time.Duration
+	CapacityPerMinute float64
+	OutOfService      bool
+	Queue             []int
+	Allowance         float64
+}
+
+type movementCheckpoint struct {
+	Passenger int
+	Egress    bool
+	Steps     []int
+	LeadOut   time.Duration
+	Pace      float64
+	Index     int
+	ReadyAt   time.Duration
+	Queued    bool
+}
+
+func newCheckpoint(s *Simulation) (*checkpoint, error) {
+	_, err := NewFareConfig(s.FarePolicy)
+	if err != nil {
+		return nil, fmt.Errorf("can't checkpoint: %v", err)
+	}
+	cp := &checkpoint{
+		Config:     s.Config(),
+		SourceSeed: s.source.seed,
+		Draws:      s.source.draws,
+
+		StepFreeUnableToTravel: s.StepFreeUnableToTravel,
+		Incidents:              s.Incidents,
+
+		WallClock:             s.WallClock,
+		Stasis:                s.Stasis,
+		StasisAt:              s.StasisAt,
+		Complete:              s.Complete,
+		TotalAverageRidership: s.TotalAverageRidership,
+		LastTrainReleased:     s.LastTrainReleased,
+	}
+	if s.Events != nil {
+		cp.HasEvents = true
+		cp.EventCapacity = len(s.Events.events)
+		cp.EventMinimumLevel = s.Events.MinimumLevel
+		cp.Events = s.Events.Recent(s.Events.Len())
+		cp.EventsPublished = s.Events.Published
+	}
+
+	segments := map[*Segment]int{}
+	for index, segment := range s.Segments {
+		segments[segment] = index
+		cp.Segments = append(cp.Segments, *segment)
+	}
+	services := map[*Service]int{}
+	for index, service := range s.Services {
+		services[service] = index
+		cp.Services = append(cp.Services, *service)
+	}
+	concessions := map[*Concession]int{}
+	for index, concession := range s.Concessions {
+		concessions[concession] = index
+		cp.Concessions = append(cp.Concessions, *concession)
+	}
+
+	passengers := map[*Passenger]int{}
+	passengerRef := func(p *Passenger) (int, error) {
+		if index, ok := passengers[p]; ok {
+			return index, nil
+		}
+		pc := passengerCheckpoint{Passenger: *p, Segment: -1, Concession: -1}
+		pc.Passenger.Segment, pc.Passenger.Concession = nil, nil
+		if p.Segment != nil {
+			index, ok := segments[p.Segment]
+			if !ok {
+				return 0, fmt.Errorf("passenger %d's segment %q isn't one of the simulation's", p.ID, p.Segment.Name)
+			}
+			pc.Segment = index
+		}
+		if p.Concession != nil {
+			index, ok := concessions[p.Concession]
+			if !ok {
+				return 0, fmt.Errorf("passenger %d's concession %q isn't one of the simulation's", p.ID, p.Concession.Name)
+			}
+			pc.Concession = index
+		}
+		passengers[p] = len(cp.Passengers)
+		cp.Passengers = append(cp.Passengers, pc)
+		return passengers[p], nil
+	}
+	passengerRefs := func(values []*Passenger) ([]int, error) {
+		refs := make([]int, len(values))
+		for index, p := range values {
+			ref, err := passengerRef(p)
+			if err != nil {
+				return nil, err
+			}
+			refs[index] = ref
+		}
+		return refs, nil
+	}
+
+	trains := map[*Train]int{}
+	trainRef := func(t *Train) (int, error) {
+		if t == nil {
+			return -1, nil
+		}
+		if index, ok := trains[t]; ok {
+			return index, nil
+		}
+		tc := trainCheckpoint{Train: *t, Service: -1}
+		tc.Train.Service, tc.Train.Passengers = nil, nil
+		if t.Service != nil {
+			index, ok := services[t.Service]
+			if !ok {
+				return 0, fmt.Errorf("train %d's service %q isn't one of the simulation's", t.ID, t.Service.Name)
+			}
+			tc.Service = index
+		}
+		refs, err := passengerRefs(t.Passengers)
+		if err != nil {
+			return 0, err
+		}
+		tc.Passengers = refs
+		trains[t] = len(cp.Trains)
+		cp.Trains = append(cp.Trains, tc)
+		return trains[t], nil
+	}
+
+	if s.People != nil {
+		if cp.People, err = passengerRefs(s.People.Values()); err != nil {
+			return nil, err
+		}
+	}
+	if s.Yard != nil {
+		for _, t := range s.Yard.Values() {
+			ref, err := trainRef(t)
+			if err != nil {
+				return nil, err
+			}
+			cp.Yard = append(cp.Yard, ref)
+		}
+	}
+
+	stations := map[*Station]int{}
+	for index, station := range s.Stations {
+		stations[station] = index
+	}
+	trackCheckpointFor := func(track *Track) (*trackCheckpoint, error) {
+		if track == nil {
+			return nil, nil
+		}
+		end, ok := stations[track.End]
+		if !ok {
+			return nil, fmt.Errorf("track to %s doesn't end at one of the simulation's stations", track.End.Name)
+		}
+		tc := &trackCheckpoint{
+			DistanceMeters: track.DistanceMeters,
+			IsOutBound:     track.IsOutBound,
+			End:            end,
+			Traversals:     track.Traversals,
+		}
+		for _, t := range track.Trains {
+			ref, err := trainRef(t)
+			if err != nil {
+				return nil, err
+			}
+			tc.Trains = append(tc.Trains, ref)
+		}
+		return tc, nil
+	}
+
+	for _, station := range s.Stations {
+		sc := stationCheckpoint{
+			Name:               station.Name,
+			RidersPerDayMean:   station.RidersPerDayMean,
+			RidersPerDayStdDev: station.RidersPerDayStdDev,
+			Chainage:           station.Chainage,
+			Departures:         station.Departures,
+			Boardings:          station.Boardings,
+			Alightings:         station.Alightings,
+			DeniedBoardings:    station.DeniedBoardings,
+			PeakWaiting:        station.PeakWaiting,
+			PeakWaitingAt:      station.PeakWaitingAt,
+		}
+		if sc.Waiting, err = passengerRefs(station.WaitingPassengers.Values()); err != nil {
+			return nil, err
+		}
+		if sc.OutBoundTrain, err = trainRef(station.OutBoundTrain); err != nil {
+			return nil, err
+		}
+		if sc.InBoundTrain, err = trainRef(station.InBoundTrain); err != nil {
+			return nil, err
+		}
+		if sc.OutBoundTrack, err = trackCheckpointFor(station.OutBoundTrack); err != nil {
+			return nil, err
+		}
+		if sc.InBoundTrack, err = trackCheckpointFor(station.InBoundTrack); err != nil {
+			return nil, err
+		}
+		if station.Layout != nil {
+			if sc.Layout, err = newLayoutCheckpoint(station.Layout, passengerRef); err != nil {
+				return nil, fmt.Errorf("%s: %v", station.Name, err)
+			}
+		}
+		cp.Stations = append(cp.Stations, sc)
+	}
+	return cp, nil
+}
+
+func newLayoutCheckpoint(layout *StationLayout, passengerRef func(*Passenger) (int, error)) (*layoutCheckpoint, error) {
+	lc := &layoutCheckpoint{PlatformWalkTime: layout.PlatformWalkTime}
+
+	circulations := map[*Circulation]int{}
+	circulationRefs := func(values []*Circulation) []int {
+		refs := make([]int, len(values))
+		for index, c := range values {
+			ref, ok := circulations[c]
+			if !ok {
+				ref = len(lc.Circulations)
+				circulations[c] = ref
+				lc.Circulations = append(lc.Circulations, circulationCheckpoint{
+					Kind:              c.Kind,
+					Name:              c.Name,
+					TraversalTime:     c.TraversalTime,
+					CapacityPerMinute: c.CapacityPerMinute,
+					OutOfService:      c.OutOfService,
+					Allowance:         c.allowance,
+				})
+			}
+			refs[index] = ref
+		}
+		return refs
+	}
+	for _, entrance := range layout.Entrances {
+		lc.Entrances = append(lc.Entrances, entranceCheckpoint{
+			Name:     entrance.Name,
+			WalkTime: entrance.WalkTime,
+			Path:     circulationRefs(entrance.Path),
+		})
+	}
+
+	movements := map[*Movement]int{}
+	for index, m := range layout.Movements {
+		passenger, err := passengerRef(m.Passenger)
+		if err != nil {
+			return nil, err
+		}
+		movements[m] = index
+		lc.Movements = append(lc.Movements, movementCheckpoint{
+			Passenger: passenger,
+			Egress:    m.Egress,
+			Steps:     circulationRefs(m.Steps),
+			LeadOut:   m.LeadOut,
+			Pace:      m.Pace,
+			Index:     m.Index,
+			ReadyAt:   m.ReadyAt,
+			Queued:    m.Queued,
+		})
+	}
+	for c, ref := range circulations {
+		for _, m := range c.Queue {
+			index, ok := movements[m]
+			if !ok {
+				return nil, fmt.Errorf("%s has a queued passenger who isn't moving through the station", c.Name)
+			}
+			lc.Circulations[ref].Queue = append(lc.Circulations[ref].Queue, index)
+		}
+	}
+	return lc, nil
+}
+
+func (cp *checkpoint) restore() (*Simulation, error) {
+	s := New(cp.Config.StepLength, cp.Config.TotalTime, nil)
+	s.ApplyConfig(cp.Config)
+	s.source.restore(cp.SourceSeed, cp.Draws)
+
+	s.StepFreeUnableToTravel = cp.StepFreeUnableToTravel
+	s.Incidents = cp.Incidents
+	s.WallClock = cp.WallClock
+	s.Stasis = cp.Stasis
+	s.StasisAt = cp.StasisAt
+	s.Complete = cp.Complete
+	s.TotalAverageRidership = cp.TotalAverageRidership
+	s.LastTrainReleased = cp.LastTrainReleased
+
+	s.Events = nil
+	if cp.HasEvents {
+		s.Events = NewEventLog(cp.EventCapacity)
+		s.Events.MinimumLevel = cp.EventMinimumLevel
+		for _, e := range cp.Events {
+			s.Events.Publish(e)
+		}
+		s.Events.Published = cp.EventsPublished
+	}
+
+	s.Segments = nil
+	for index := range cp.Segments {
+		segment := cp.Segments[index]
+		s.Segments = append(s.Segments, &segment)
+	}
+	s.Services = nil
+	for index := range cp.Services {
+		service := cp.Services[index]
+		s.Services = append(s.Services, &service)
+	}
+	s.Concessions = nil
+	for index := range cp.Concessions {
+		concession := cp.Concessions[index]
+		s.Concessions = append(s.Concessions, &concession)
+	}
+
+	passengers := make([]*Passenger, len(cp.Passengers))
+	for index, pc := range cp.Passengers {
+		p := pc.Passenger
+		if pc.Segment >= 0 {
+			if pc.Segment >= len(s.Segments) {
+				return nil, fmt.Errorf("passenger %d has an unknown segment", p.ID)
+			}
+			p.Segment = s.Segments[pc.Segment]
+		}
+		if pc.Concession >= 0 {
+			if pc.Concession >= len(s.Concessions) {
+				return nil, fmt.Errorf("passenger %d has an unknown concession", p.ID)
+			}
+			p.Concession = s.Concessions[pc.Concession]
+		}
+		passengers[index] = &p
+	}
+	passengerAt := func(ref int) (*Passenger, error) {
+		if ref < 0 || ref >= len(passengers) {
+			return nil, fmt.Errorf("unknown passenger %d", ref)
+		}
+		return passengers[ref], nil
+	}
+	queueOf := func(refs []int) (*QueueOfPassenger, error) {
+		queue := NewQueueOfPassenger()
+		for _, ref := range refs {
+			p, err := passengerAt(ref)
+			if err != nil {
+				return nil, err
+			}
+			queue.Enqueue(p)
+		}
+		return queue, nil
+	}
+
+	trains := make([]*Train, len(cp.Trains))
+	for index, tc := range cp.Trains {
+		t := tc.Train
+		if tc.Service >= 0 {
+			if tc.Service >= len(s.Services) {
+				return nil, fmt.Errorf("train %d has an unknown service", t.ID)
+			}
+			t.Service = s.Services[tc.Service]
+		}
+		for _, ref := range tc.Passengers {
+			p, err := passengerAt(ref)
+			if err != nil {
+				return nil, err
+			}
+			t.Passengers = append(t.Passengers, p)
+		}
+		trains[index] = &t
+	}
+	trainAt := func(ref int) (*Train, error) {
+		if ref == -1 {
+			return nil, nil
+		}
+		if ref < 0 || ref >= len(trains) {
+			return nil, fmt.Errorf("unknown train %d", ref)
+		}
+		return trains[ref], nil
+	}
+
+	var err error
+	if s.People, err = queueOf(cp.People); err != nil {
+		return nil, err
+	}
+	s.Yard = NewQueueOfTrain()
+	for _, ref := range cp.Yard {
+		t, err := trainAt(ref)
+		if err != nil {
+			return nil, err
+		}
+		s.Yard.Enqueue(t)
+	}
+
+	s.Stations = nil
+	for _, sc := range cp.Stations {
+		station := NewStation(sc.Name, sc.RidersPerDayMean, s.People)
+		station.RidersPerDayStdDev = sc.RidersPerDayStdDev
+		station.Chainage = sc.Chainage
+		station.Events = s.Events
+		station.Departures = sc.Departures
+		station.Boardings = sc.Boardings
+		station.Alightings = sc.Alightings
+		station.DeniedBoardings = sc.DeniedBoardings
+		station.PeakWaiting = sc.PeakWaiting
+		station.PeakWaitingAt = sc.PeakWaitingAt
+		if station.WaitingPassengers, err = queueOf(sc.Waiting); err != nil {
+			return nil, err
+		}
+		if station.OutBoundTrain, err = trainAt(sc.OutBoundTrain); err != nil {
+			return nil, err
+		}
+		if station.InBoundTrain, err = trainAt(sc.InBoundTrain); err != nil {
+			return nil, err
+		}
+		if sc.Layout != nil {
+			if station.Layout, err = sc.Layout.restore(passengerAt); err != nil {
+				return nil, fmt.Errorf("%s: %v", sc.Name, err)
+			}
+		}
+		s.Stations = append(s.Stations, station)
+	}
+
+	restoreTrack := func(begin *Station, tc *trackCheckpoint) (*Track, error) {
+		if tc == nil {
+			return nil, nil
+		}
+		if tc.End < 0 || tc.End >= len(s.Stations) {
+			return nil, fmt.Errorf("track from %s ends at an unknown station", begin.Name)
+		}
+		track := &Track{
+			DistanceMeters: tc.DistanceMeters,
+			IsOutBound:     tc.IsOutBound,
+			Begin:          begin,
+			End:            s.Stations[tc.End],
+			Traversals:     tc.Traversals,
+		}
+		for _, ref := range tc.Trains {
+			t, err := trainAt(ref)
+			if err != nil {
+				return nil, err
+			}
+			track.Trains = append(track.Trains, t)
+		}
+		return track, nil
+	}
+	for index, sc := range cp.Stations {
+		station := s.Stations[index]
+		if station.OutBoundTrack, err = restoreTrack(station, sc.OutBoundTrack); err != nil {
+			return nil, err
+		}
+		if station.InBoundTrack, err = restoreTrack(station, sc.InBoundTrack); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (lc *layoutCheckpoint) restore(passengerAt func(int) (*Passenger, error)) (*StationLayout, error) {
+	layout := &StationLayout{PlatformWalkTime: lc.PlatformWalkTime}
+
+	circulations := make([]*Circulation, len(lc.Circulations))
+	for index, cc := range lc.Circulations {
+		circulations[index] = &Circulation{
+			Kind:              cc.Kind,
+			Name:              cc.Name,
+			TraversalTime:     cc.TraversalTime,
+			CapacityPerMinute: cc.CapacityPerMinute,
+			OutOfService:      cc.OutOfService,
+			allowance:         cc.Allowance,
+		}
+	}
+	circulationsAt := func(refs []int) ([]*Circulation, error) {
+		var values []*Circulation
+		for _, ref := range refs {
+			if ref < 0 || ref >= len(circulations) {
+				return nil, fmt.Errorf("unknown circulation %d", ref)
+			}
+			values = append(values, circulations[ref])
+		}
+		return values, nil
+	}
+
+	for _, ec := range lc.Entrances {
+		path, err := circulationsAt(ec.Path)
+		if err != nil {
+			return nil, err
+		}
+		layout.Entrances = append(layout.Entrances, &Entrance{Name: ec.Name, WalkTime: ec.WalkTime, Path: path})
+	}
+	for _, mc := range lc.Movements {
+		p, err := passengerAt(mc.Passenger)
+		if err != nil {
+			return nil, err
+		}
+		steps, err := circulationsAt(mc.Steps)
+		if err != nil {
+			return nil, err
+		}
+		layout.Movements = append(layout.Movements, &Movement{
+			Passenger: p,
+			Egress:    mc.Egress,
+			Steps:     steps,
+			LeadOut:   mc.LeadOut,
+			Pace:      mc.Pace,
+			Index:     mc.Index,
+			ReadyAt:   mc.ReadyAt,
+			Queued:    mc.Queued,
+		})
+	}
+	for index, cc := range lc.Circulations {
+		for _, ref := range cc.Queue {
+			if ref < 0 || ref >= len(layout.Movements) {
+				return nil, fmt.Errorf("unknown movement %d", ref)
+			}
+			circulations[index].Queue = append(circulations[index].Queue, layout.Movements[ref])
+		}
+	}
+	return layout, nil
+}
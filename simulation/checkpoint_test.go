@@ -0,0 +1,132 @@
+package simulation
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func testCheckpointScenario() Scenario {
+	scenario := testReplicationScenario()
+	scenario.Config.ElevatorOutages = []ElevatorOutage{{Station: "96 Street", Start: 20 * time.Minute, End: 50 * time.Minute}}
+	scenario.Setup = func(s *Simulation) {
+		s.Services = []*Service{
+			{Name: "Local", Share: 0.5},
+			{Name: "Express", SkipStations: []string{"145 Street", "116 Street"}, Share: 0.5},
+		}
+		s.FarePolicy = TimeOfDayFare{
+			Policy:            DistanceFare{BaseFare: 1.5, PerKilometer: 0.2, MaximumFare: 4},
+			PeakPeriods:       []FarePeriod{{Start: 7 * time.Hour, End: 9 * time.Hour}},
+			PeakMultiplier:    1.25,
+			OffPeakMultiplier: 1,
+		}
+	}
+	return scenario
+}
+
+func checkpointAndRestore(t *testing.T, sim *Simulation) *Simulation {
+	buffer := new(bytes.Buffer)
+	if err := sim.WriteCheckpoint(buffer); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := ReadCheckpoint(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return restored
+}
+
+func TestCheckpointResumesExactly(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testCheckpointScenario()
+	uninterrupted := scenario.NewSimulation(1).Simulate()
+
+	sim := scenario.NewSimulation(1)
+	sim.Generate()
+	sim.RunUntil(45 * time.Minute)
+	restored := checkpointAndRestore(t, sim)
+	assert.Equal(sim.WallClock, restored.WallClock)
+	resumed := restored.Finish()
+
+	assert.Equal(uninterrupted.Revenue.Trips, resumed.Revenue.Trips)
+	assert.Equal(uninterrupted.Revenue.TotalRevenue, resumed.Revenue.TotalRevenue)
+	for _, metric := range StatsMetrics() {
+		assert.Equal(metric.Value(uninterrupted), metric.Value(resumed), metric.Name)
+	}
+}
+
+func TestCheckpointKeepsPointerGraph(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testCheckpointScenario().NewSimulation(1)
+	sim.Generate()
+	sim.RunUntil(30 * time.Minute)
+	restored := checkpointAndRestore(t, sim)
+
+	assert.Len(restored.Stations, len(sim.Stations))
+	trains := map[*Train]bool{}
+	for _, train := range restored.AllTrains() {
+		trains[train] = true
+	}
+	assert.Len(trains, sim.TotalTrainCount)
+
+	var running int
+	for index, station := range restored.Stations {
+		assert.True(station.GeneralPopulation == restored.People)
+		assert.True(station.Events == restored.Events)
+		if station.OutBoundTrack != nil {
+			assert.True(station.OutBoundTrack.Begin == station)
+			assert.True(station.OutBoundTrack.End == restored.Stations[index+1])
+			assert.True(station.OutBoundTrack.End.InBoundTrack.End == station)
+		}
+		for _, track := range []*Track{station.OutBoundTrack, station.InBoundTrack} {
+			if track == nil {
+				continue
+			}
+			for _, train := range track.Trains {
+				assert.True(trains[train])
+				running++
+			}
+		}
+		for _, train := range []*Train{station.OutBoundTrain, station.InBoundTrain} {
+			if train != nil {
+				assert.True(trains[train])
+			}
+		}
+	}
+	assert.NotZero(running)
+	for _, train := range restored.AllTrains() {
+		if train.Service != nil {
+			assert.True(train.Service == restored.Services[0] || train.Service == restored.Services[1])
+		}
+	}
+}
+
+func TestCheckpointNeedsSteppedEngine(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Engine = EngineEvent
+	assert.NotNil(sim.WriteCheckpoint(new(bytes.Buffer)))
+
+	_, err := ReadCheckpoint(bytes.NewBufferString("not a checkpoint"))
+	assert.NotNil(err)
+}
+
+type halfPriceSundays struct{}
+
+func (halfPriceSundays) Fare(trip FareTrip) float64 {
+	return 1.45
+}
+
+func TestCheckpointNeedsAFarePolicyItCanDescribe(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.FarePolicy = halfPriceSundays{}
+	assert.Nil(sim.Config().FarePolicy)
+	assert.NotNil(sim.WriteCheckpoint(new(bytes.Buffer)))
+}
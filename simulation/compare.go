@@ -0,0 +1,361 @@
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// Scenario is one configuration of the line to simulate.
+type Scenario struct {
+	Name   string
+	Config Config
+	// Setup, if set, is called on each new simulation after the config is applied,
+	// for anything Config doesn't cover such as a fare policy of its own. Runs go concurrently,
+	// so it must give each simulation its own objects rather than share them.
+	Setup func(s *Simulation)
+}
+
+// NewSimulation returns a simulation set up for the scenario with the given seed.
+func (sc Scenario) NewSimulation(seed int64) *Simulation {
+	config := sc.Config
+	config.Seed = seed
+	s := New(config.StepLength, config.TotalTime, nil)
+	s.ApplyConfig(config)
+	if sc.Setup != nil {
+		sc.Setup(s)
+	}
+	return s
+}
+
+// Metric is one number pulled out of a run's stats.
+type Metric struct {
+	Name          string
+	LowerIsBetter bool
+	Value         func(stats *SimulationStats) float64
+}
+
+// StatsMetrics returns the line-wide metrics compared between runs.
+func StatsMetrics() []Metric {
+	distribution := func(pick func(*DistributionStats) *DistributionSummary, quantile func(*DistributionSummary) float64) func(*SimulationStats) float64 {
+		return func(stats *SimulationStats) float64 {
+			if stats.Distributions == nil || pick(stats.Distributions) == nil {
+				return 0
+			}
+			return quantile(pick(stats.Distributions))
+		}
+	}
+	mean := func(summary *DistributionSummary) float64 { return summary.Mean.Seconds() }
+	p95 := func(summary *DistributionSummary) float64 { return summary.P95.Seconds() }
+
+	return []Metric{
+		{Name: "Mean Wait (s)", LowerIsBetter: true, Value: distribution(func(d *DistributionStats) *DistributionSummary { return d.Wait }, mean)},
+		{Name: "P95 Wait (s)", LowerIsBetter: true, Value: distribution(func(d *DistributionStats) *DistributionSummary { return d.Wait }, p95)},
+		{Name: "Mean In-Vehicle (s)", LowerIsBetter: true, Value: distribution(func(d *DistributionStats) *DistributionSummary { return d.InVehicle }, mean)},
+		{Name: "Mean Journey (s)", LowerIsBetter: true, Value: distribution(func(d *DistributionStats) *DistributionSummary { return d.Journey }, mean)},
+		{Name: "P95 Journey (s)", LowerIsBetter: true, Value: distribution(func(d *DistributionStats) *DistributionSummary { return d.Journey }, p95)},
+		{Name: "Mean Round Trip (s)", LowerIsBetter: true, Value: distribution(func(d *DistributionStats) *DistributionSummary { return d.RoundTrip }, mean)},
+		{Name: "Denied Boardings", LowerIsBetter: true, Value: func(stats *SimulationStats) float64 {
+			var denied int
+			for _, station := range stats.Stations {
+				denied += station.DeniedBoardings
+			}
+			return float64(denied)
+		}},
+		{Name: "Peak Load Factor", LowerIsBetter: true, Value: func(stats *SimulationStats) float64 {
+			if peak := PeakLoadTrack(stats.Tracks); peak != nil {
+				return peak.LoadFactor
+			}
+			return 0
+		}},
+		{Name: "Bunched Pairs", LowerIsBetter: true, Value: func(stats *SimulationStats) float64 {
+			if stats.Regularity == nil {
+				return 0
+			}
+			return float64(stats.Regularity.BunchedPairs)
+		}},
+		{Name: "Fare Revenue", Value: func(stats *SimulationStats) float64 {
+			if stats.Revenue == nil {
+				return 0
+			}
+			return stats.Revenue.TotalRevenue
+		}},
+		{Name: "Operating Cost", LowerIsBetter: true, Value: func(stats *SimulationStats) float64 {
+			if stats.CostBenefit == nil || stats.CostBenefit.OperatingCost == nil {
+				return 0
+			}
+			return stats.CostBenefit.OperatingCost.Total
+		}},
+		{Name: "Farebox Recovery", Value: func(stats *SimulationStats) float64 {
+			if stats.CostBenefit == nil || stats.CostBenefit.OperatingCost == nil {
+				return 0
+			}
+			return stats.CostBenefit.FareboxRecovery()
+		}},
+	}
+}
+
+// StationMetric is one number pulled out of a station's stats.
+type StationMetric struct {
+	Name          string
+	LowerIsBetter bool
+	Value         func(station *StationStats) float64
+}
+
+// StationMetrics returns the per-station metrics compared between runs.
+func StationMetrics() []StationMetric {
+	return []StationMetric{
+		{Name: "Mean Wait (s)", LowerIsBetter: true, Value: func(station *StationStats) float64 { return station.MeanWait.Seconds() }},
+		{Name: "P95 Wait (s)", LowerIsBetter: true, Value: func(station *StationStats) float64 { return station.P95Wait.Seconds() }},
+		{Name: "Boardings", Value: func(station *StationStats) float64 { return float64(station.Boardings) }},
+		{Name: "Denied Boardings", LowerIsBetter: true, Value: func(station *StationStats) float64 { return float64(station.DeniedBoardings) }},
+		{Name: "Peak Waiting", LowerIsBetter: true, Value: func(station *StationStats) float64 { return float64(station.PeakWaiting) }},
+	}
+}
+
+// NewComparison returns a comparison of `a` against `b` over `replications` pairs of runs,
+// pair `i` of which both use the seed DeriveSeed(seed, i).
+func NewComparison(a, b Scenario, replications int, seed int64) *Comparison {
+	seeds := make([]int64, replications)
+	for index := range seeds {
+		seeds[index] = DeriveSeed(seed, index)
+	}
+	return &Comparison{
+		A:           a,
+		B:           b,
+		Seeds:       seeds,
+		Confidence:  0.95,
+		Parallelism: runtime.GOMAXPROCS(0),
+	}
+}
+
+// Comparison runs two scenarios over the same seeds, so each pair of runs sees the same
+// random draws as far as the scenarios allow, and tests the differences pairwise.
+type Comparison struct {
+	A     Scenario
+	B     Scenario
+	Seeds []int64
+
+	// Confidence is the level of the confidence intervals; a difference is significant
+	// when its p-value is under 1 - Confidence. Station metrics' p-values are adjusted
+	// first, as there are so many of them.
+	Confidence float64
+	// Parallelism is how many runs go at once.
+	Parallelism int
+}
+
+// Run simulates every pair of runs and compares them.
+func (c *Comparison) Run() *ComparisonResult {
+	statsA := make([]*SimulationStats, len(c.Seeds))
+	statsB := make([]*SimulationStats, len(c.Seeds))
+
+	runParallel(c.Parallelism, 2*len(c.Seeds), func(index int) {
+		seed := c.Seeds[index/2]
+		if index%2 == 0 {
+			statsA[index/2] = c.A.NewSimulation(seed).Simulate()
+		} else {
+			statsB[index/2] = c.B.NewSimulation(seed).Simulate()
+		}
+	})
+
+	return CompareStats(c.A.Name, c.B.Name, statsA, statsB, c.Confidence)
+}
+
+// CompareStats tests the paired runs `a[i]` and `b[i]` against each other on every metric.
+// The station metrics are corrected together with Holm's method, so that identical scenarios
+// flag no station at all with probability `confidence`.
+func CompareStats(nameA, nameB string, a, b []*SimulationStats, confidence float64) *ComparisonResult {
+	result := &ComparisonResult{
+		A:            nameA,
+		B:            nameB,
+		Replications: len(a),
+		Confidence:   confidence,
+	}
+	for _, metric := range StatsMetrics() {
+		valuesA := make([]float64, len(a))
+		valuesB := make([]float64, len(b))
+		for index := range a {
+			valuesA[index] = metric.Value(a[index])
+			valuesB[index] = metric.Value(b[index])
+		}
+		result.Metrics = append(result.Metrics, newMetricComparison(metric.Name, "", metric.LowerIsBetter, valuesA, valuesB, confidence))
+	}
+
+	if len(a) == 0 {
+		return result
+	}
+	var summariesA, summariesB []*CostBenefitSummary
+	for index := range a {
+		if a[index].CostBenefit != nil && b[index].CostBenefit != nil {
+			summariesA = append(summariesA, a[index].CostBenefit)
+			summariesB = append(summariesB, b[index].CostBenefit)
+		}
+	}
+	if len(summariesA) > 0 {
+		result.CostBenefit = AppraiseCostBenefit(summariesA, summariesB, confidence)
+	}
+
+	for _, station := range a[0].Stations {
+		for _, metric := range StationMetrics() {
+			var valuesA, valuesB []float64
+			for index := range a {
+				stationA, stationB := findStationStats(a[index].Stations, station.Name), findStationStats(b[index].Stations, station.Name)
+				if stationA == nil || stationB == nil {
+					continue
+				}
+				valuesA = append(valuesA, metric.Value(stationA))
+				valuesB = append(valuesB, metric.Value(stationB))
+			}
+			result.Stations = append(result.Stations, newMetricComparison(metric.Name, station.Name, metric.LowerIsBetter, valuesA, valuesB, confidence))
+		}
+	}
+	adjustHolm(result.Stations, confidence)
+	return result
+}
+
+// adjustHolm sets the metrics' adjusted p-values with Holm's step-down method, which bounds
+// the chance of any false positive among them, and whether each is still significant.
+func adjustHolm(metrics []*MetricComparison, confidence float64) {
+	ordered := append([]*MetricComparison(nil), metrics...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Difference.P < ordered[j].Difference.P
+	})
+	var running float64
+	for index, metric := range ordered {
+		running = math.Max(running, math.Min(1, float64(len(ordered)-index)*metric.Difference.P))
+		metric.AdjustedP = running
+		metric.Significant = metric.AdjustedP < 1-confidence
+	}
+}
+
+func findStationStats(stations []*StationStats, name string) *StationStats {
+	for _, station := range stations {
+		if station.Name == name {
+			return station
+		}
+	}
+	return nil
+}
+
+func newMetricComparison(name, station string, lowerIsBetter bool, a, b []float64, confidence float64) *MetricComparison {
+	difference := PairedTTest(a, b, confidence)
+	return &MetricComparison{
+		Name:          name,
+		Station:       station,
+		LowerIsBetter: lowerIsBetter,
+		Difference:    difference,
+		AdjustedP:     difference.P,
+		Significant:   difference.P < 1-confidence,
+	}
+}
+
+// MetricComparison is how one metric changed from A to B.
+type MetricComparison struct {
+	Name string
+	// Station is empty for line-wide metrics.
+	Station       string
+	LowerIsBetter bool
+
+	Difference PairedDifference
+	// AdjustedP is the p-value corrected for the other tests made alongside it,
+	// which for line-wide metrics is the p-value itself.
+	AdjustedP   float64
+	Significant bool
+}
+
+// Verdict returns whether B is "better" or "worse" than A, or "" if the change isn't significant.
+func (mc *MetricComparison) Verdict() string {
+	if !mc.Significant || mc.Difference.Mean == 0 {
+		return ""
+	}
+	if (mc.Difference.Mean < 0) == mc.LowerIsBetter {
+		return "better"
+	}
+	return "worse"
+}
+
+// ComparisonResult is every metric's change from scenario A to scenario B.
+type ComparisonResult struct {
+	A            string
+	B            string
+	Replications int
+	Confidence   float64
+
+	Metrics  []*MetricComparison
+	Stations []*MetricComparison
+	// CostBenefit is B's net benefit over A; nil without cost-benefit stats to appraise.
+	CostBenefit *CostBenefitAppraisal
+}
+
+// SignificantStations returns the station metrics that changed significantly.
+func (cr *ComparisonResult) SignificantStations() []*MetricComparison {
+	var significant []*MetricComparison
+	for _, metric := range cr.Stations {
+		if metric.Significant {
+			significant = append(significant, metric)
+		}
+	}
+	return significant
+}
+
+func (cr *ComparisonResult) String() string {
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, "Comparison of %s (A) vs %s (B) over %d paired runs, %0.0f%% intervals\n", cr.A, cr.B, cr.Replications, cr.Confidence*100.0)
+
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Metric\tA\tB\tB - A\tInterval\tp\tVerdict")
+	for _, metric := range cr.Metrics {
+		writeMetricComparison(w, metric.Name, metric)
+	}
+	w.Flush()
+	if cr.CostBenefit != nil {
+		fmt.Fprint(buffer, cr.CostBenefit)
+	}
+
+	significant := cr.SignificantStations()
+	if len(significant) == 0 {
+		fmt.Fprintf(buffer, "No station metrics changed significantly, with p adjusted by Holm's method over %d tests.\n", len(cr.Stations))
+		return buffer.String()
+	}
+	fmt.Fprintf(buffer, "Station metrics that changed significantly, with p adjusted by Holm's method over %d tests:\n", len(cr.Stations))
+	w = tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Station / Metric\tA\tB\tB - A\tInterval\tHolm p\tVerdict")
+	for _, metric := range significant {
+		writeMetricComparison(w, metric.Station+" / "+metric.Name, metric)
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+func writeMetricComparison(w *tabwriter.Writer, name string, metric *MetricComparison) {
+	difference := metric.Difference
+	fmt.Fprintf(w, "%s\t%0.2f\t%0.2f\t%+0.2f\t[%0.2f, %0.2f]\t%0.4f\t%s\n",
+		name, difference.MeanA, difference.MeanB, difference.Mean, difference.Lower, difference.Upper, metric.AdjustedP, metric.Verdict())
+}
+
+// runParallel calls `work` with every index below `count`, from up to `workers` goroutines at once.
+func runParallel(workers, count int, work func(index int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				work(index)
+			}
+		}()
+	}
+	for index := 0; index < count; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,172 @@
+package simulation
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestStudentTQuantile(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.InDelta(12.706, StudentTQuantile(0.975, 1), 0.001)
+	assert.InDelta(2.228, StudentTQuantile(0.975, 10), 0.001)
+	assert.InDelta(1.960, StudentTQuantile(0.975, 10000), 0.001)
+	assert.InDelta(-2.228, StudentTQuantile(0.025, 10), 0.001)
+	assert.InDelta(0.5, StudentTCDF(0, 5), 1e-9)
+}
+
+func TestRegularizedIncompleteBeta(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.InDelta(0.5, RegularizedIncompleteBeta(0.5, 3, 3), 1e-9)
+	// I_x(1, 1) is uniform.
+	assert.InDelta(0.3, RegularizedIncompleteBeta(0.3, 1, 1), 1e-9)
+	// I_x(a, 1) = x^a.
+	assert.InDelta(math.Pow(0.7, 2.5), RegularizedIncompleteBeta(0.7, 2.5, 1), 1e-9)
+}
+
+func TestPairedTTest(t *testing.T) {
+	assert := assert.New(t)
+
+	a := []float64{10, 12, 9, 11, 13}
+	b := []float64{11, 14, 9.5, 12, 15}
+	result := PairedTTest(a, b, 0.95)
+	assert.Equal(5, result.Samples)
+	assert.InDelta(1.3, result.Mean, 1e-9)
+	// differences 1, 2, 0.5, 1, 2 have a standard deviation of 0.6708.
+	assert.InDelta(0.6708/math.Sqrt(5), result.StdErr, 1e-4)
+	assert.InDelta(4.333, result.T, 0.001)
+	assert.InDelta(0.0123, result.P, 0.0005)
+	assert.True(result.Lower > 0)
+	assert.True(result.Upper > result.Mean)
+
+	same := PairedTTest(a, a, 0.95)
+	assert.Zero(same.Mean)
+	assert.Equal(1.0, same.P)
+}
+
+func TestComparisonIdenticalScenarios(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+
+	result := NewComparison(scenario, scenario, 3, 1).Run()
+	assert.Equal(3, result.Replications)
+	assert.Len(result.Metrics, len(StatsMetrics()))
+	assert.NotEmpty(result.Stations)
+	for _, metric := range result.Metrics {
+		assert.Zero(metric.Difference.Mean, metric.Name)
+		assert.False(metric.Significant, metric.Name)
+	}
+	assert.Empty(result.SignificantStations())
+	assert.Zero(result.CostBenefit.NetBenefit.Mean)
+	assert.NotEmpty(result.String())
+}
+
+func TestComparisonFleetSize(t *testing.T) {
+	assert := assert.New(t)
+
+	more := testReplicationScenario()
+	fewer := testReplicationScenario()
+	fewer.Name = "4 trains"
+	fewer.Config.TotalTrainCount = 4
+
+	result := NewComparison(more, fewer, 3, 1).Run()
+	metrics := map[string]*MetricComparison{}
+	for _, metric := range result.Metrics {
+		metrics[metric.Name] = metric
+	}
+	assert.True(metrics["Operating Cost"].Difference.Mean < 0)
+	assert.Equal("better", metrics["Operating Cost"].Verdict())
+	assert.True(metrics["Mean Wait (s)"].Difference.MeanA > 0)
+	assert.True(result.CostBenefit.OperatingCostChange < 0)
+	assert.InDelta(result.CostBenefit.PassengerTimeSavings-result.CostBenefit.OperatingCostChange, result.CostBenefit.NetBenefit.Mean, 0.001)
+	assert.True(strings.Contains(result.String(), "Net Benefit: "))
+}
+
+func TestScenarioSegmentsAreOptIn(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	assert.False(scenario.Config.UseSegments)
+	assert.Zero(scenario.Config.StartOfDay)
+	assert.Empty(scenario.NewSimulation(1).Segments)
+
+	scenario.Config.UseSegments = true
+	sim := scenario.NewSimulation(1)
+	assert.Len(sim.Segments, len(DefaultSegments()))
+	assert.True(sim.Config().UseSegments)
+	assert.NotEmpty(sim.Simulate().Segments)
+}
+
+func TestScenarioCarriesServices(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	scenario.Config.Services = []Service{
+		{Name: "Local", Share: 0.5},
+		{Name: "Express", SkipStations: []string{"Bank"}, Share: 0.5},
+	}
+	sim := scenario.NewSimulation(1)
+	assert.Len(sim.Services, 2)
+	assert.Equal(scenario.Config.Services, sim.Config().Services)
+
+	sim.Services[1].SkipStations[0] = "Moorgate"
+	assert.Equal("Bank", scenario.Config.Services[1].SkipStations[0])
+
+	scenario.Config.Services[0].Share = -1
+	assert.NotNil(scenario.Config.Validate())
+}
+
+func TestAdjustHolm(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := []*MetricComparison{
+		{Name: "a", Difference: PairedDifference{P: 0.04}},
+		{Name: "b", Difference: PairedDifference{P: 0.01}},
+		{Name: "c", Difference: PairedDifference{P: 0.03}},
+		{Name: "d", Difference: PairedDifference{P: 0.005}},
+	}
+	adjustHolm(metrics, 0.95)
+	assert.InDelta(0.06, metrics[0].AdjustedP, 1e-9)
+	assert.InDelta(0.03, metrics[1].AdjustedP, 1e-9)
+	assert.InDelta(0.06, metrics[2].AdjustedP, 1e-9)
+	assert.InDelta(0.02, metrics[3].AdjustedP, 1e-9)
+	assert.False(metrics[0].Significant)
+	assert.True(metrics[1].Significant)
+	assert.False(metrics[2].Significant)
+	assert.True(metrics[3].Significant)
+}
+
+func TestCompareStatsUnchangedStationsAreNotFlagged(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	scenario.Config.UseSegments = true
+	const replications = 5
+	a := make([]*SimulationStats, replications)
+	b := make([]*SimulationStats, replications)
+	runParallel(runtime.GOMAXPROCS(0), 2*replications, func(index int) {
+		if index < replications {
+			a[index] = scenario.NewSimulation(int64(index + 1)).Simulate()
+		} else {
+			b[index-replications] = scenario.NewSimulation(int64(index + 1)).Simulate()
+		}
+	})
+
+	// the runs differ only by chance, which at p < 0.05 alone would flag some of the stations.
+	result := CompareStats("a", "b", a, b, 0.95)
+	var unadjusted int
+	for _, metric := range result.Stations {
+		if metric.Difference.P < 0.05 {
+			unadjusted++
+		}
+	}
+	assert.NotZero(unadjusted)
+	assert.Empty(result.SignificantStations())
+	assert.True(strings.Contains(result.String(), "Holm's method"))
+}
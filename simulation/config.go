@@ -0,0 +1,327 @@
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the parameters of a run, enough to describe it in output files
+// and to set up another run the same way. Durations marshal as nanoseconds.
+type Config struct {
+	Seed int64 `json:"seed"`
+
+	StepLength time.Duration `json:"step_length"`
+	TotalTime  time.Duration `json:"total_time"`
+	StartOfDay time.Duration `json:"start_of_day"`
+
+	TotalPassengerCount int `json:"total_passenger_count"`
+	TotalTrainCount     int `json:"total_train_count"`
+
+	TrainCapacity            int     `json:"train_capacity"`
+	TrainAverageAcceleration float64 `json:"train_average_acceleration"`
+	TrainAverageBraking      float64 `json:"train_average_braking"`
+	TrainMaximumSpeed        float64 `json:"train_maximum_speed"`
+
+	StationIncidentLikelihood float64       `json:"station_incident_likelihood"`
+	AverageIncidentDelay      time.Duration `json:"average_incident_delay"`
+
+	AverageTimeBetweenTrains time.Duration `json:"average_time_between_trains"`
+	AverageTimeInStation     time.Duration `json:"average_time_in_station"`
+	BunchingThreshold        time.Duration `json:"bunching_threshold"`
+
+	UseStationLayouts    bool          `json:"use_station_layouts"`
+	WheelchairShare      float64       `json:"wheelchair_share"`
+	StrollerShare        float64       `json:"stroller_share"`
+	StepFreeBoardingTime time.Duration `json:"step_free_boarding_time"`
+
+	// ElevatorOutages are windows, from the start of the run, where elevators are out of service.
+	ElevatorOutages []ElevatorOutage `json:"elevator_outages,omitempty"`
+
+	UseSegments            bool    `json:"use_segments"`
+	RouteChoiceSensitivity float64 `json:"route_choice_sensitivity"`
+
+	// FarePolicy is what trips cost before concessions; nil charges nothing.
+	FarePolicy  *FareConfig  `json:"fare_policy"`
+	Concessions []Concession `json:"concessions,omitempty"`
+
+	// OperatingCosts prices the service that was run; nil costs nothing.
+	OperatingCosts *OperatingCostModel `json:"operating_costs"`
+
+	// Services are the stopping patterns trains run; none means every train stops everywhere.
+	Services []Service `json:"services,omitempty"`
+
+	Engine string `json:"engine,omitempty"`
+}
+
+// Validate returns an error if the config can't make a run, e.g. one with trains that can't move.
+func (c Config) Validate() error {
+	if c.Engine != "" && c.Engine != EngineStepped && c.Engine != EngineEvent {
+		return fmt.Errorf("unknown engine: %q", c.Engine)
+	}
+	if c.StepLength <= 0 || c.TotalTime <= 0 {
+		return fmt.Errorf("step_length and total_time must be positive")
+	}
+	if c.TotalTrainCount <= 0 || c.TrainCapacity <= 0 {
+		return fmt.Errorf("total_train_count and train_capacity must be positive")
+	}
+	if c.TrainAverageAcceleration <= 0 || c.TrainAverageBraking <= 0 || c.TrainMaximumSpeed <= 0 {
+		return fmt.Errorf("train_average_acceleration, train_average_braking and train_maximum_speed must be positive")
+	}
+	if c.TotalPassengerCount < 0 {
+		return fmt.Errorf("total_passenger_count can't be negative")
+	}
+	for _, outage := range c.ElevatorOutages {
+		if outage.End <= outage.Start {
+			return fmt.Errorf("elevator_outages: an outage at %s must end after it starts", outage.Station)
+		}
+	}
+	if c.FarePolicy != nil {
+		if err := c.FarePolicy.Validate(); err != nil {
+			return fmt.Errorf("fare_policy: %v", err)
+		}
+	}
+	if costs := c.OperatingCosts; costs != nil {
+		if costs.PerTrainHour < 0 || costs.PerTrainKm < 0 || costs.CrewPerTrain < 0 || costs.CrewHourlyRate < 0 ||
+			costs.EnergyPerTrainKm < 0 || costs.EnergyPrice < 0 || costs.CapitalPerTrainPerDay < 0 {
+			return fmt.Errorf("operating_costs can't be negative")
+		}
+	}
+	var concessionShare float64
+	for _, concession := range c.Concessions {
+		if concession.Share < 0 || concession.Discount < 0 || concession.Discount > 1 {
+			return fmt.Errorf("concessions: %s needs a share of at least 0 and a discount between 0 and 1", concession.Name)
+		}
+		concessionShare += concession.Share
+	}
+	if concessionShare > 1 {
+		return fmt.Errorf("concessions: the shares add up to more than 1")
+	}
+	if len(c.Services) > 0 {
+		var total float64
+		for _, service := range c.Services {
+			if service.Share < 0 {
+				return fmt.Errorf("services: %s has a negative share", service.Name)
+			}
+			total += service.Share
+		}
+		if total <= 0 {
+			return fmt.Errorf("services: at least one share must be positive")
+		}
+	}
+	return nil
+}
+
+// Config returns the simulation's current parameters.
+// A fare policy other than the package's own can't be described, and is left out.
+func (s *Simulation) Config() Config {
+	farePolicy, _ := NewFareConfig(s.FarePolicy)
+	var operatingCosts *OperatingCostModel
+	if s.OperatingCosts != nil {
+		copied := *s.OperatingCosts
+		operatingCosts = &copied
+	}
+	var concessions []Concession
+	for _, concession := range s.Concessions {
+		concessions = append(concessions, *concession)
+	}
+	var services []Service
+	for _, service := range s.Services {
+		services = append(services, service.copy())
+	}
+	return Config{
+		Seed:                      s.Seed,
+		StepLength:                s.StepLength,
+		TotalTime:                 s.TotalTime,
+		StartOfDay:                s.StartOfDay,
+		TotalPassengerCount:       s.TotalPassengerCount,
+		TotalTrainCount:           s.TotalTrainCount,
+		TrainCapacity:             s.TrainCapacity,
+		TrainAverageAcceleration:  s.TrainAverageAcceleration,
+		TrainAverageBraking:       s.TrainAverageBraking,
+		TrainMaximumSpeed:         s.TrainMaximumSpeed,
+		StationIncidentLikelihood: s.StationIncidentLikelihood,
+		AverageIncidentDelay:      s.AverageIncidentDelay,
+		AverageTimeBetweenTrains:  s.AverageTimeBetweenTrains,
+		AverageTimeInStation:      s.AverageTimeInStation,
+		BunchingThreshold:         s.BunchingThreshold,
+		UseStationLayouts:         s.UseStationLayouts,
+		WheelchairShare:           s.WheelchairShare,
+		StrollerShare:             s.StrollerShare,
+		StepFreeBoardingTime:      s.StepFreeBoardingTime,
+		ElevatorOutages:           append([]ElevatorOutage(nil), s.ElevatorOutages...),
+		UseSegments:               len(s.Segments) > 0,
+		RouteChoiceSensitivity:    s.RouteChoiceSensitivity,
+		FarePolicy:                farePolicy,
+		Concessions:               concessions,
+		OperatingCosts:            operatingCosts,
+		Services:                  services,
+		Engine:                    s.Engine,
+	}
+}
+
+// ApplyConfig sets the simulation's parameters, including reseeding the random provider.
+// It should be called before the run starts.
+func (s *Simulation) ApplyConfig(config Config) {
+	s.SetSeed(config.Seed)
+	s.StepLength = config.StepLength
+	s.TotalTime = config.TotalTime
+	s.StartOfDay = config.StartOfDay
+	s.TotalPassengerCount = config.TotalPassengerCount
+	s.TotalTrainCount = config.TotalTrainCount
+	s.TrainCapacity = config.TrainCapacity
+	s.TrainAverageAcceleration = config.TrainAverageAcceleration
+	s.TrainAverageBraking = config.TrainAverageBraking
+	s.TrainMaximumSpeed = config.TrainMaximumSpeed
+	s.StationIncidentLikelihood = config.StationIncidentLikelihood
+	s.AverageIncidentDelay = config.AverageIncidentDelay
+	s.AverageTimeBetweenTrains = config.AverageTimeBetweenTrains
+	s.AverageTimeInStation = config.AverageTimeInStation
+	s.BunchingThreshold = config.BunchingThreshold
+	s.UseStationLayouts = config.UseStationLayouts
+	s.WheelchairShare = config.WheelchairShare
+	s.StrollerShare = config.StrollerShare
+	s.StepFreeBoardingTime = config.StepFreeBoardingTime
+	s.ElevatorOutages = append([]ElevatorOutage(nil), config.ElevatorOutages...)
+	if !config.UseSegments {
+		s.Segments = nil
+	} else if len(s.Segments) == 0 {
+		s.Segments = DefaultSegments()
+	}
+	s.RouteChoiceSensitivity = config.RouteChoiceSensitivity
+	s.FarePolicy = config.FarePolicy.FarePolicy()
+	s.Concessions = nil
+	for _, concession := range config.Concessions {
+		concession := concession
+		s.Concessions = append(s.Concessions, &concession)
+	}
+	s.OperatingCosts = nil
+	if config.OperatingCosts != nil {
+		operatingCosts := *config.OperatingCosts
+		s.OperatingCosts = &operatingCosts
+	}
+	s.Services = nil
+	for _, service := range config.Services {
+		service := service.copy()
+		s.Services = append(s.Services, &service)
+	}
+	s.Engine = config.Engine
+}
+
+// Clone returns a copy of the config that shares no slices or pointers with it,
+// so decoding over the copy can't change the original.
+func (c Config) Clone() Config {
+	c.ElevatorOutages = append([]ElevatorOutage(nil), c.ElevatorOutages...)
+	if c.FarePolicy != nil {
+		farePolicy := *c.FarePolicy
+		c.FarePolicy = &farePolicy
+	}
+	c.Concessions = append([]Concession(nil), c.Concessions...)
+	if c.OperatingCosts != nil {
+		operatingCosts := *c.OperatingCosts
+		c.OperatingCosts = &operatingCosts
+	}
+	services := c.Services
+	c.Services = nil
+	for _, service := range services {
+		c.Services = append(c.Services, service.copy())
+	}
+	return c
+}
+
+// SetSeed reseeds the random provider so the run can be reproduced.
+func (s *Simulation) SetSeed(seed int64) {
+	s.Seed = seed
+	s.Provider.Seed(seed)
+}
+
+// ConfigFields returns the names parameters are set by, i.e. the Config JSON keys.
+func ConfigFields() []string {
+	var names []string
+	configType := reflect.TypeOf(Config{})
+	for index := 0; index < configType.NumField(); index++ {
+		names = append(names, configFieldName(configType.Field(index)))
+	}
+	return names
+}
+
+// SetConfigValue sets the Config field with JSON key `name` from its text form.
+// Durations are written like "150s" or "2m30s", and lists like services as JSON.
+func SetConfigValue(config *Config, name, value string) error {
+	configValue := reflect.ValueOf(config).Elem()
+	configType := configValue.Type()
+	for index := 0; index < configType.NumField(); index++ {
+		if configFieldName(configType.Field(index)) != name {
+			continue
+		}
+		field := configValue.Field(index)
+		if field.Type() == reflect.TypeOf(time.Duration(0)) {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			field.SetInt(int64(duration))
+			return nil
+		}
+		switch field.Kind() {
+		case reflect.Int, reflect.Int64:
+			{
+				parsed, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				field.SetInt(parsed)
+			}
+		case reflect.Float64:
+			{
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				field.SetFloat(parsed)
+			}
+		case reflect.Bool:
+			{
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				field.SetBool(parsed)
+			}
+		case reflect.String:
+			{
+				field.SetString(value)
+			}
+		case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Struct:
+			{
+				parsed := reflect.New(field.Type())
+				if err := json.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				field.Set(parsed.Elem())
+			}
+		default:
+			{
+				return fmt.Errorf("%s: can't set a %v", name, field.Kind())
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown config field: %q", name)
+}
+
+// decodeStrictly decodes JSON into `value`, refusing fields it doesn't have.
+// The custom decoders of a config's parts use it, as a decoder's own settings don't reach them.
+func decodeStrictly(data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(value)
+}
+
+func configFieldName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
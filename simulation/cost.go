@@ -0,0 +1,237 @@
+package simulation
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultOperatingCostModel returns rough unit costs for a heavy rail subway.
+func DefaultOperatingCostModel() *OperatingCostModel {
+	return &OperatingCostModel{
+		PerTrainHour:          150.0,
+		PerTrainKm:            4.0,
+		CrewPerTrain:          2,
+		CrewHourlyRate:        55.0,
+		EnergyPerTrainKm:      20.0,
+		EnergyPrice:           0.12,
+		CapitalPerTrainPerDay: 2500.0,
+	}
+}
+
+// OperatingCostModel is the unit costs of running trains.
+type OperatingCostModel struct {
+	// PerTrainHour covers costs that scale with time in service, e.g. supervision and station staff.
+	PerTrainHour float64 `json:"per_train_hour"`
+	// PerTrainKm covers costs that scale with distance, e.g. maintenance and wear.
+	PerTrainKm float64 `json:"per_train_km"`
+
+	CrewPerTrain   int     `json:"crew_per_train"`
+	CrewHourlyRate float64 `json:"crew_hourly_rate"`
+
+	// EnergyPerTrainKm is the traction energy in kWh, charged at EnergyPrice per kWh.
+	EnergyPerTrainKm float64 `json:"energy_per_train_km"`
+	EnergyPrice      float64 `json:"energy_price"`
+
+	// CapitalPerTrainPerDay is the fleet's capital charge, per train owned, per day.
+	CapitalPerTrainPerDay float64 `json:"capital_per_train_per_day"`
+}
+
+// Cost returns the operating cost of the given amount of service.
+func (ocm *OperatingCostModel) Cost(trainHours, trainKilometers float64, fleetSize int, period time.Duration) *OperatingCost {
+	cost := &OperatingCost{
+		TrainHours:      trainHours,
+		TrainKilometers: trainKilometers,
+		CrewHours:       trainHours * float64(ocm.CrewPerTrain),
+		EnergyKWh:       trainKilometers * ocm.EnergyPerTrainKm,
+	}
+	cost.TrainHourCost = trainHours * ocm.PerTrainHour
+	cost.TrainKmCost = trainKilometers * ocm.PerTrainKm
+	cost.CrewCost = cost.CrewHours * ocm.CrewHourlyRate
+	cost.EnergyCost = cost.EnergyKWh * ocm.EnergyPrice
+	cost.CapitalCost = float64(fleetSize) * ocm.CapitalPerTrainPerDay * (float64(period) / float64(24*time.Hour))
+	cost.Total = cost.TrainHourCost + cost.TrainKmCost + cost.CrewCost + cost.EnergyCost + cost.CapitalCost
+	return cost
+}
+
+// OperatingCost is what it cost to run the service.
+type OperatingCost struct {
+	TrainHours      float64
+	TrainKilometers float64
+	CrewHours       float64
+	EnergyKWh       float64
+
+	TrainHourCost float64
+	TrainKmCost   float64
+	CrewCost      float64
+	EnergyCost    float64
+	CapitalCost   float64
+	Total         float64
+}
+
+func (oc *OperatingCost) String() string {
+	return fmt.Sprintf("Operating Cost: %0.2f (Train-Hours: %0.2f, Train-Km: %0.2f, Crew: %0.2f, Energy: %0.2f, Fleet Capital: %0.2f)\n", oc.Total, oc.TrainHourCost, oc.TrainKmCost, oc.CrewCost, oc.EnergyCost, oc.CapitalCost)
+}
+
+// CostBenefitSummary pairs what the service cost to run with what it cost its riders in time.
+type CostBenefitSummary struct {
+	OperatingCost *OperatingCost
+	Revenue       float64
+
+	Trips         int
+	WaitingHours  float64
+	InMotionHours float64
+
+	// PassengerTimeCost is the generalized cost of every completed trip.
+	PassengerTimeCost        float64
+	PassengerTimeCostPerTrip float64
+}
+
+func (cbs *CostBenefitSummary) String() string {
+	output := cbs.OperatingCost.String()
+	output += fmt.Sprintf("Passenger Hours Waiting: %0.1f Riding: %0.1f\nPassenger Time Cost: %0.2f (%0.2f per trip)\nFare Revenue: %0.2f Farebox Recovery: %0.1f%%\n",
+		cbs.WaitingHours, cbs.InMotionHours,
+		cbs.PassengerTimeCost, cbs.PassengerTimeCostPerTrip,
+		cbs.Revenue, cbs.FareboxRecovery()*100.0,
+	)
+	return output
+}
+
+// FareboxRecovery is the fraction of operating cost covered by fares.
+func (cbs *CostBenefitSummary) FareboxRecovery() float64 {
+	if cbs.OperatingCost == nil || cbs.OperatingCost.Total == 0 {
+		return 0
+	}
+	return cbs.Revenue / cbs.OperatingCost.Total
+}
+
+// CompareCostBenefit appraises scenario B against a base scenario A.
+// User benefits use the rule of a half over the two scenarios' ridership, and fares
+// are treated as a transfer between riders and the operator.
+func CompareCostBenefit(a, b *CostBenefitSummary) *CostBenefitComparison {
+	comparison := &CostBenefitComparison{
+		OperatingCostChange: b.OperatingCost.Total - a.OperatingCost.Total,
+		RevenueChange:       b.Revenue - a.Revenue,
+		TripsChange:         b.Trips - a.Trips,
+	}
+	averageTrips := float64(a.Trips+b.Trips) / 2.0
+	comparison.PassengerTimeSavings = (a.PassengerTimeCostPerTrip - b.PassengerTimeCostPerTrip) * averageTrips
+	comparison.NetBenefit = comparison.PassengerTimeSavings - comparison.OperatingCostChange
+	if comparison.OperatingCostChange > 0 {
+		comparison.BenefitCostRatio = comparison.PassengerTimeSavings / comparison.OperatingCostChange
+	}
+	return comparison
+}
+
+// CostBenefitComparison is the change going from scenario A to scenario B.
+type CostBenefitComparison struct {
+	OperatingCostChange  float64
+	RevenueChange        float64
+	TripsChange          int
+	PassengerTimeSavings float64
+	NetBenefit           float64
+	BenefitCostRatio     float64
+}
+
+func (cbc *CostBenefitComparison) String() string {
+	return fmt.Sprintf("Passenger Time Savings: %0.2f\nOperating Cost Change: %0.2f\nRevenue Change: %0.2f\nTrips Change: %d\nNet Benefit: %0.2f\nBenefit/Cost Ratio: %0.2f\n",
+		cbc.PassengerTimeSavings, cbc.OperatingCostChange, cbc.RevenueChange, cbc.TripsChange, cbc.NetBenefit, cbc.BenefitCostRatio)
+}
+
+// AppraiseCostBenefit appraises scenario B against A over paired runs, `a[i]` against `b[i]`,
+// with CompareCostBenefit, testing the mean net benefit against zero at `confidence`.
+func AppraiseCostBenefit(a, b []*CostBenefitSummary, confidence float64) *CostBenefitAppraisal {
+	appraisal := &CostBenefitAppraisal{Replications: len(a)}
+	zeros := make([]float64, len(a))
+	netBenefits := make([]float64, len(a))
+	for index := range a {
+		comparison := CompareCostBenefit(a[index], b[index])
+		n := float64(len(a))
+		appraisal.PassengerTimeSavings += comparison.PassengerTimeSavings / n
+		appraisal.OperatingCostChange += comparison.OperatingCostChange / n
+		appraisal.RevenueChange += comparison.RevenueChange / n
+		netBenefits[index] = comparison.NetBenefit
+	}
+	appraisal.NetBenefit = PairedTTest(zeros, netBenefits, confidence)
+	if appraisal.OperatingCostChange > 0 {
+		appraisal.BenefitCostRatio = appraisal.PassengerTimeSavings / appraisal.OperatingCostChange
+	}
+	return appraisal
+}
+
+// CostBenefitAppraisal is the mean change going from scenario A to scenario B over paired runs.
+type CostBenefitAppraisal struct {
+	Replications         int
+	PassengerTimeSavings float64
+	OperatingCostChange  float64
+	RevenueChange        float64
+
+	// NetBenefit is the pairs' net benefits as a difference from zero, so its Mean, interval
+	// and P say how sure the appraisal is that B is worth it.
+	NetBenefit PairedDifference
+	// BenefitCostRatio is the mean time savings over the mean rise in operating cost, 0 if costs didn't rise.
+	BenefitCostRatio float64
+}
+
+func (cba *CostBenefitAppraisal) String() string {
+	return fmt.Sprintf("Net Benefit: %+0.2f [%0.2f, %0.2f] p %0.4f (Passenger Time Savings: %0.2f, Operating Cost Change: %+0.2f, Revenue Change: %+0.2f, Benefit/Cost Ratio: %0.2f)\n",
+		cba.NetBenefit.Mean, cba.NetBenefit.Lower, cba.NetBenefit.Upper, cba.NetBenefit.P,
+		cba.PassengerTimeSavings, cba.OperatingCostChange, cba.RevenueChange, cba.BenefitCostRatio)
+}
+
+// TrainHours returns the total time trains have spent out of the yard, in hours.
+func (s *Simulation) TrainHours() float64 {
+	var total time.Duration
+	for _, train := range s.AllTrains() {
+		for _, roundTrip := range train.RoundTripTimes {
+			total += roundTrip
+		}
+	}
+	for _, train := range s.TrainsInService() {
+		total += s.WallClock - train.LeftYard
+	}
+	return total.Hours()
+}
+
+// TrainKilometers returns the total distance trains have run.
+func (s *Simulation) TrainKilometers() float64 {
+	var total float64
+	for _, train := range s.AllTrains() {
+		total += train.DistanceTraveled / 1000.0
+	}
+	return total
+}
+
+func (s *Simulation) computeCostBenefit(revenue *RevenueStats) *CostBenefitSummary {
+	summary := &CostBenefitSummary{}
+	if s.OperatingCosts != nil {
+		summary.OperatingCost = s.OperatingCosts.Cost(s.TrainHours(), s.TrainKilometers(), s.TotalTrainCount, s.WallClock)
+	} else {
+		summary.OperatingCost = &OperatingCost{}
+	}
+	if revenue != nil {
+		summary.Revenue = revenue.TotalRevenue
+	}
+
+	for x := 0; x < s.People.Len(); x++ {
+		p := s.People.Dequeue()
+		summary.Trips += len(p.Journeys)
+		for _, waiting := range p.Waiting {
+			summary.WaitingHours += waiting.Hours()
+		}
+		for _, inMotion := range p.InMotion {
+			summary.InMotionHours += inMotion.Hours()
+		}
+		for _, cost := range p.GeneralizedCosts {
+			summary.PassengerTimeCost += cost
+		}
+		s.People.Enqueue(p)
+	}
+	if len(s.Segments) == 0 {
+		// there's no segment to price each trip with, so price the time spent altogether.
+		summary.PassengerTimeCost = DefaultValueOfTime * (WaitTimeWeight*summary.WaitingHours + summary.InMotionHours)
+	}
+	if summary.Trips > 0 {
+		summary.PassengerTimeCostPerTrip = summary.PassengerTimeCost / float64(summary.Trips)
+	}
+	return summary
+}
@@ -0,0 +1,105 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestOperatingCostModelCost(t *testing.T) {
+	assert := assert.New(t)
+
+	model := &OperatingCostModel{
+		PerTrainHour:          100,
+		PerTrainKm:            2,
+		CrewPerTrain:          2,
+		CrewHourlyRate:        50,
+		EnergyPerTrainKm:      10,
+		EnergyPrice:           0.1,
+		CapitalPerTrainPerDay: 2400,
+	}
+
+	cost := model.Cost(10, 200, 4, 6*time.Hour)
+	assert.InDelta(1000, cost.TrainHourCost, 0.001)
+	assert.InDelta(400, cost.TrainKmCost, 0.001)
+	assert.InDelta(20, cost.CrewHours, 0.001)
+	assert.InDelta(1000, cost.CrewCost, 0.001)
+	assert.InDelta(200, cost.EnergyCost, 0.001)
+	assert.InDelta(2400, cost.CapitalCost, 0.001)
+	assert.InDelta(5000, cost.Total, 0.001)
+}
+
+func TestCompareCostBenefit(t *testing.T) {
+	assert := assert.New(t)
+
+	a := &CostBenefitSummary{
+		OperatingCost:            &OperatingCost{Total: 10000},
+		Revenue:                  3000,
+		Trips:                    1000,
+		PassengerTimeCostPerTrip: 12,
+	}
+	b := &CostBenefitSummary{
+		OperatingCost:            &OperatingCost{Total: 12000},
+		Revenue:                  3300,
+		Trips:                    1100,
+		PassengerTimeCostPerTrip: 10,
+	}
+
+	comparison := CompareCostBenefit(a, b)
+	assert.InDelta(2000, comparison.OperatingCostChange, 0.001)
+	assert.InDelta(2100, comparison.PassengerTimeSavings, 0.001)
+	assert.InDelta(100, comparison.NetBenefit, 0.001)
+	assert.InDelta(300, comparison.RevenueChange, 0.001)
+	assert.InDelta(1.05, comparison.BenefitCostRatio, 0.001)
+}
+
+func TestAppraiseCostBenefit(t *testing.T) {
+	assert := assert.New(t)
+
+	summary := func(cost float64, trips int, timeCostPerTrip float64) *CostBenefitSummary {
+		return &CostBenefitSummary{OperatingCost: &OperatingCost{Total: cost}, Trips: trips, PassengerTimeCostPerTrip: timeCostPerTrip}
+	}
+	a := []*CostBenefitSummary{summary(10000, 1000, 12), summary(10000, 1000, 12), summary(10000, 1000, 12)}
+	b := []*CostBenefitSummary{summary(12000, 1000, 9), summary(12000, 1000, 9.5), summary(12000, 1000, 10)}
+
+	appraisal := AppraiseCostBenefit(a, b, 0.95)
+	assert.Equal(3, appraisal.Replications)
+	assert.InDelta(2500, appraisal.PassengerTimeSavings, 0.001)
+	assert.InDelta(2000, appraisal.OperatingCostChange, 0.001)
+	assert.InDelta(500, appraisal.NetBenefit.Mean, 0.001)
+	assert.True(appraisal.NetBenefit.Lower < 500 && appraisal.NetBenefit.Upper > 500)
+	assert.InDelta(1.25, appraisal.BenefitCostRatio, 0.001)
+	assert.True(strings.Contains(appraisal.String(), "Net Benefit: +500.00"))
+}
+
+func TestSimulationCostBenefitWithoutSegments(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	assert.Empty(sim.Segments)
+	summary := sim.Simulate().CostBenefit
+	assert.NotZero(summary.Trips)
+	assert.InDelta(DefaultValueOfTime*(WaitTimeWeight*summary.WaitingHours+summary.InMotionHours), summary.PassengerTimeCost, 0.001)
+	assert.NotZero(summary.PassengerTimeCostPerTrip)
+}
+
+func TestConfigCarriesOperatingCosts(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	assert.Equal(DefaultOperatingCostModel(), scenario.Config.OperatingCosts)
+
+	assert.Nil(SetConfigValue(&scenario.Config, "operating_costs", `{"per_train_hour": 200, "crew_per_train": 1}`))
+	assert.Equal(&OperatingCostModel{PerTrainHour: 200, CrewPerTrain: 1}, scenario.Config.OperatingCosts)
+	sim := scenario.NewSimulation(1)
+	assert.Equal(scenario.Config.OperatingCosts, sim.OperatingCosts)
+	sim.OperatingCosts.PerTrainHour = 300
+	assert.Equal(200.0, scenario.Config.OperatingCosts.PerTrainHour)
+
+	scenario.Config.OperatingCosts.EnergyPrice = -1
+	assert.NotNil(scenario.Config.Validate())
+	scenario.Config.OperatingCosts = nil
+	assert.Nil(scenario.NewSimulation(1).OperatingCosts)
+}
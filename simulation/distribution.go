@@ -0,0 +1,232 @@
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DistributionRelativeAccuracy is how close a reported quantile is to the true value, as a fraction of it.
+	DistributionRelativeAccuracy = 0.01
+)
+
+// NewDistribution returns a new, empty distribution.
+func NewDistribution(name string) *Distribution {
+	gamma := (1.0 + DistributionRelativeAccuracy) / (1.0 - DistributionRelativeAccuracy)
+	return &Distribution{
+		Name:     name,
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		buckets:  map[int]int{},
+	}
+}
+
+// Distribution is a histogram of durations with logarithmically sized buckets, so that
+// quantiles are accurate to within DistributionRelativeAccuracy however long the tail gets.
+type Distribution struct {
+	Name  string
+	Count int
+	Sum   time.Duration
+	Min   time.Duration
+	Max   time.Duration
+
+	gamma    float64
+	logGamma float64
+	zeros    int
+	buckets  map[int]int
+}
+
+// Add records a sample.
+func (d *Distribution) Add(value time.Duration) {
+	if d.Count == 0 || value < d.Min {
+		d.Min = value
+	}
+	if d.Count == 0 || value > d.Max {
+		d.Max = value
+	}
+	d.Count++
+	d.Sum += value
+
+	if value <= 0 {
+		d.zeros++
+		return
+	}
+	d.buckets[d.bucketFor(value)]++
+}
+
+// Mean returns the mean of every sample.
+func (d *Distribution) Mean() time.Duration {
+	if d.Count == 0 {
+		return 0
+	}
+	return d.Sum / time.Duration(d.Count)
+}
+
+// Quantile returns the value `q` (0 to 1) of the way through the samples, e.g. 0.95 for the 95th percentile.
+func (d *Distribution) Quantile(q float64) time.Duration {
+	if d.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return d.Min
+	}
+	if q >= 1 {
+		return d.Max
+	}
+
+	rank := int(math.Ceil(q * float64(d.Count)))
+	if rank <= d.zeros {
+		return d.Min
+	}
+
+	indexes := make([]int, 0, len(d.buckets))
+	for index := range d.buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	seen := d.zeros
+	for _, index := range indexes {
+		seen += d.buckets[index]
+		if seen >= rank {
+			return d.clamp(d.valueFor(index))
+		}
+	}
+	return d.Max
+}
+
+// Summary returns the count, mean and tail percentiles.
+func (d *Distribution) Summary() *DistributionSummary {
+	return &DistributionSummary{
+		Name:  d.Name,
+		Count: d.Count,
+		Mean:  d.Mean(),
+		P50:   d.Quantile(0.50),
+		P90:   d.Quantile(0.90),
+		P95:   d.Quantile(0.95),
+		P99:   d.Quantile(0.99),
+		Max:   d.Max,
+	}
+}
+
+func (d *Distribution) bucketFor(value time.Duration) int {
+	return int(math.Ceil(math.Log(float64(value)) / d.logGamma))
+}
+
+// valueFor returns the middle of the bucket, which is within the relative accuracy of anything in it.
+func (d *Distribution) valueFor(index int) time.Duration {
+	return time.Duration(2.0 * math.Pow(d.gamma, float64(index)) / (d.gamma + 1.0))
+}
+
+func (d *Distribution) clamp(value time.Duration) time.Duration {
+	if value < d.Min {
+		return d.Min
+	}
+	if value > d.Max {
+		return d.Max
+	}
+	return value
+}
+
+// DistributionSummary is a distribution's count, mean and tail percentiles.
+type DistributionSummary struct {
+	Name  string
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func (ds *DistributionSummary) String() string {
+	return fmt.Sprintf("%-16s n=%-7d mean=%-8v p50=%-8v p90=%-8v p95=%-8v p99=%-8v max=%v",
+		ds.Name, ds.Count,
+		ds.Mean.Round(time.Second), ds.P50.Round(time.Second), ds.P90.Round(time.Second),
+		ds.P95.Round(time.Second), ds.P99.Round(time.Second), ds.Max.Round(time.Second),
+	)
+}
+
+// DistributionStats are the distributions of passenger and train times once the line is at stasis.
+type DistributionStats struct {
+	// WarmUp is how long the simulation ran before stasis; samples starting earlier are excluded.
+	WarmUp time.Duration
+
+	Wait          *DistributionSummary
+	InVehicle     *DistributionSummary
+	Journey       *DistributionSummary
+	RoundTrip     *DistributionSummary
+	Dwell         *DistributionSummary
+	Headway       *DistributionSummary
+	HeadwayByStop map[string]*DistributionSummary
+}
+
+func (ds *DistributionStats) String() string {
+	output := fmt.Sprintf("Distributions (excluding %v warm-up):\n", ds.WarmUp)
+	for _, summary := range []*DistributionSummary{ds.Wait, ds.InVehicle, ds.Journey, ds.RoundTrip, ds.Dwell, ds.Headway} {
+		output += "  " + summary.String() + "\n"
+	}
+	return output
+}
+
+func (s *Simulation) computeDistributionStats() *DistributionStats {
+	wait := NewDistribution("Wait")
+	inVehicle := NewDistribution("In-Vehicle")
+	journey := NewDistribution("Door-to-Door")
+	roundTrip := NewDistribution("Round Trip")
+	dwell := NewDistribution("Dwell")
+	headway := NewDistribution("Headway")
+
+	for x := 0; x < s.People.Len(); x++ {
+		p := s.People.Dequeue()
+		for _, trip := range p.Trips {
+			if trip.EnteredAt < s.StasisAt {
+				continue
+			}
+			wait.Add(trip.Waiting)
+			inVehicle.Add(trip.InMotion)
+			journey.Add(trip.ExitedAt - trip.EnteredAt)
+		}
+		s.People.Enqueue(p)
+	}
+
+	for _, train := range s.AllTrains() {
+		for _, rt := range train.RoundTrips {
+			if rt.LeftYard < s.StasisAt {
+				continue
+			}
+			roundTrip.Add(rt.ReturnedAt - rt.LeftYard)
+		}
+	}
+
+	stats := &DistributionStats{
+		WarmUp:        s.StasisAt,
+		HeadwayByStop: map[string]*DistributionSummary{},
+	}
+	for _, station := range s.Stations {
+		stationHeadway := NewDistribution(station.Name)
+		for _, departure := range station.Departures {
+			if departure.Stopped && departure.ArrivedAt >= s.StasisAt {
+				dwell.Add(departure.DepartedAt - departure.ArrivedAt)
+			}
+		}
+		for _, isOutbound := range []bool{true, false} {
+			for _, value := range station.Headways(isOutbound, s.StasisAt) {
+				headway.Add(value)
+				stationHeadway.Add(value)
+			}
+		}
+		stats.HeadwayByStop[station.Name] = stationHeadway.Summary()
+	}
+
+	stats.Wait = wait.Summary()
+	stats.InVehicle = inVehicle.Summary()
+	stats.Journey = journey.Summary()
+	stats.RoundTrip = roundTrip.Summary()
+	stats.Dwell = dwell.Summary()
+	stats.Headway = headway.Summary()
+	return stats
+}
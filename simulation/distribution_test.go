@@ -0,0 +1,76 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestDistributionQuantiles(t *testing.T) {
+	assert := assert.New(t)
+
+	d := NewDistribution("Test")
+	for x := 1; x <= 1000; x++ {
+		d.Add(time.Duration(x) * time.Second)
+	}
+
+	assert.Equal(1000, d.Count)
+	assert.Equal(500500*time.Millisecond, d.Mean())
+	assert.InDelta(500, d.Quantile(0.5).Seconds(), 500*DistributionRelativeAccuracy)
+	assert.InDelta(900, d.Quantile(0.9).Seconds(), 900*DistributionRelativeAccuracy)
+	assert.InDelta(990, d.Quantile(0.99).Seconds(), 990*DistributionRelativeAccuracy)
+	assert.Equal(time.Second, d.Quantile(0))
+	assert.Equal(1000*time.Second, d.Quantile(1))
+}
+
+func TestDistributionZeros(t *testing.T) {
+	assert := assert.New(t)
+
+	d := NewDistribution("Test")
+	for x := 0; x < 9; x++ {
+		d.Add(0)
+	}
+	d.Add(time.Minute)
+
+	assert.Zero(d.Quantile(0.5))
+	assert.Zero(d.Quantile(0.9))
+	assert.InDelta(60, d.Quantile(0.95).Seconds(), 60*DistributionRelativeAccuracy)
+}
+
+func TestDistributionEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	d := NewDistribution("Test")
+	assert.Zero(d.Mean())
+	assert.Zero(d.Quantile(0.5))
+	assert.Zero(d.Summary().Count)
+}
+
+func TestSimulationDistributionStatsExcludesWarmUp(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.StasisAt = time.Hour
+
+	p := sim.People.Dequeue()
+	p.Trips = append(p.Trips,
+		Trip{EnteredAt: 30 * time.Minute, ExitedAt: 50 * time.Minute, Waiting: 5 * time.Minute, InMotion: 10 * time.Minute},
+		Trip{EnteredAt: 2 * time.Hour, ExitedAt: 2*time.Hour + 20*time.Minute, Waiting: 2 * time.Minute, InMotion: 15 * time.Minute},
+	)
+	sim.People.Enqueue(p)
+
+	station := sim.Stations[1]
+	station.Departures = []Departure{
+		{TrainID: 1, IsOutbound: true, Stopped: true, ArrivedAt: 50 * time.Minute, DepartedAt: 51 * time.Minute},
+		{TrainID: 2, IsOutbound: true, Stopped: true, ArrivedAt: 61 * time.Minute, DepartedAt: 62 * time.Minute},
+		{TrainID: 3, IsOutbound: true, Stopped: true, ArrivedAt: 65 * time.Minute, DepartedAt: 65*time.Minute + 30*time.Second},
+	}
+
+	stats := sim.computeDistributionStats()
+	assert.Equal(1, stats.Wait.Count)
+	assert.Equal(2*time.Minute, stats.Wait.Mean)
+	assert.Equal(20*time.Minute, stats.Journey.Mean)
+	assert.Equal(2, stats.Dwell.Count)
+	assert.Equal(1, stats.Headway.Count)
+	assert.InDelta((3*time.Minute + 30*time.Second).Seconds(), stats.Headway.P50.Seconds(), 3)
+}
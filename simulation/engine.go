@@ -0,0 +1,767 @@
+package simulation
+
+import (
+	"container/heap"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Engines a simulation can run on.
+const (
+	// EngineStepped advances every station and track each StepLength.
+	EngineStepped = "stepped"
+	// EngineEvent jumps from one timestamped event to the next, working out where trains
+	// are between events in closed form. It's a different model of the line, not a faster
+	// route to the stepped engine's numbers: trains run the exact RunTime profile and are kept
+	// apart by fixed signal blocks, where the stepped engine updates speeds once a step and
+	// keeps trains a stopping distance apart. At a 1 s step the stepped engine's trains reach
+	// platforms still moving and stop at once, so its round trips come out about 6% quicker
+	// and riders' waits and rides differ by up to about an eighth.
+	EngineEvent = "event"
+)
+
+// signalBlockLength is the longest a signal block is, in meters. Each track is split into equal
+// blocks no longer than this, and only one train can be in a block at a time.
+const signalBlockLength = 250.0
+
+// blockedApproachDistance is how far short of a block or platform it hasn't been cleared into
+// a train stops, in meters.
+const blockedApproachDistance = 20.0
+
+type engineEventKind int
+
+const (
+	engineYardRelease engineEventKind = iota
+	engineEndOfService
+	enginePassengerArrival
+	engineMovementReady
+	engineCirculationFree
+	enginePassengerGivesUp
+	engineTrainPassesSignal
+	engineSignalClears
+	engineDwellEnds
+	engineIncident
+	engineIncidentEnds
+	engineElevatorOutage
+	engineObserve
+)
+
+type engineEvent struct {
+	at  time.Duration
+	seq int
+
+	kind        engineEventKind
+	station     *Station
+	train       *Train
+	movement    *Movement
+	circulation *Circulation
+	signal      engineSignal
+	// version is the plan of the train's run the event was scheduled for; it's stale once the
+	// run is planned again.
+	version int
+}
+
+type engineEventQueue []*engineEvent
+
+func (q engineEventQueue) Len() int { return len(q) }
+func (q engineEventQueue) Less(i, j int) bool {
+	if q[i].at == q[j].at {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at < q[j].at
+}
+func (q engineEventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *engineEventQueue) Push(x interface{}) { *q = append(*q, x.(*engineEvent)) }
+func (q *engineEventQueue) Pop() interface{} {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
+// engineSignal is the signal protecting a block of a track, or a platform.
+type engineSignal struct {
+	track      *Track
+	block      int
+	station    *Station
+	isOutbound bool
+}
+
+func platformSignal(station *Station, isOutbound bool) engineSignal {
+	return engineSignal{station: station, isOutbound: isOutbound}
+}
+
+// trainRun is a train's run from the station it last stopped at to the next one it stops at,
+// through any it runs past on the way.
+type trainRun struct {
+	// sections are the platforms and blocks along the run, starting with the platform it leaves from.
+	sections []runSection
+	// at is the section the train is in; it's been cleared through the sections before `cleared`.
+	at      int
+	cleared int
+
+	// the train's motion is planned from `origin` meters along the run at `start`, to a stand at
+	// the end of the last section it's cleared through, or just short of it if it isn't the last.
+	start   time.Duration
+	origin  float64
+	profile motionProfile
+	// version counts the plans, so events for an earlier one can be told apart.
+	version int
+}
+
+// runSection is a platform or block along a run.
+type runSection struct {
+	signal engineSignal
+	// start and end are how far along the run the section is; a platform has no length.
+	start, end float64
+	// trackStart is how far along the run the section's track starts.
+	trackStart float64
+}
+
+// position returns how far along the run the train is, and how fast it's going.
+func (tr *trainRun) position(now time.Duration) (distance, speed float64) {
+	distance, speed = tr.profile.At(now - tr.start)
+	return tr.origin + distance, speed
+}
+
+func newEventEngine(s *Simulation) *eventEngine {
+	return &eventEngine{
+		sim:                  s,
+		runs:                 map[*Train]*trainRun{},
+		tracks:               map[*Train]*Track{},
+		holders:              map[engineSignal]*Train{},
+		waiting:              map[engineSignal][]*Train{},
+		circulationFree:      map[*Circulation]time.Duration{},
+		circulationScheduled: map[*Circulation]bool{},
+	}
+}
+
+// eventEngine runs a simulation as a sequence of discrete events rather than fixed steps.
+// It drives the same stations, trains and passengers as the stepped engine, so every stat,
+// recorder and report works on either. The random processes keep the same rates, but as
+// continuous-time processes; e.g. a station that gets one passenger in a step with probability
+// p gets passengers at a rate of p per StepLength, so arrivals aren't capped at one per step.
+//
+// Trains run on fixed block signalling: a train is cleared through the blocks and platforms ahead
+// of it as far as they're free, and holds each until it has passed through it. Its motion is worked
+// out to stop short of the first one it isn't cleared into, and worked out again from wherever it's
+// got to, at whatever speed, each time a signal ahead of it clears.
+type eventEngine struct {
+	sim   *Simulation
+	queue engineEventQueue
+	seq   int
+
+	runs   map[*Train]*trainRun
+	tracks map[*Train]*Track
+	// holders are the trains each block or platform is cleared for, and waiting the trains held at
+	// each signal for it to clear.
+	holders map[engineSignal]*Train
+	waiting map[engineSignal][]*Train
+
+	releasePending bool
+
+	circulationFree      map[*Circulation]time.Duration
+	circulationScheduled map[*Circulation]bool
+}
+
+func (e *eventEngine) schedule(at time.Duration, event *engineEvent) {
+	event.at = at
+	event.seq = e.seq
+	e.seq++
+	heap.Push(&e.queue, event)
+}
+
+// scheduleNext schedules the next event of a random process happening `ratePerSecond`,
+// unless it wouldn't happen before the service ends.
+func (e *eventEngine) scheduleNext(ratePerSecond float64, event *engineEvent) {
+	s := e.sim
+	if ratePerSecond <= 0 {
+		return
+	}
+	wait := s.Provider.ExpFloat64() / ratePerSecond
+	if wait >= (s.TotalTime - s.WallClock).Seconds() {
+		return
+	}
+	e.schedule(s.WallClock+secondsToDuration(wait), event)
+}
+
+// eventEngine returns the simulation's event engine, starting it the first time.
+func (s *Simulation) eventEngine() *eventEngine {
+	if s.events == nil {
+		s.events = newEventEngine(s)
+		s.events.start()
+	}
+	return s.events
+}
+
+// start schedules the events that get the run going.
+func (e *eventEngine) start() {
+	s := e.sim
+	for _, station := range s.Stations {
+		if station.Layout != nil {
+			station := station
+			station.Layout.started = func(m *Movement) {
+				e.schedule(m.ReadyAt, &engineEvent{kind: engineMovementReady, station: station, movement: m})
+			}
+		}
+	}
+	for _, outage := range s.ElevatorOutages {
+		e.schedule(outage.Start, &engineEvent{kind: engineElevatorOutage})
+		e.schedule(outage.End, &engineEvent{kind: engineElevatorOutage})
+	}
+	e.schedule(s.WallClock, &engineEvent{kind: engineYardRelease})
+	e.schedule(s.TotalTime, &engineEvent{kind: engineEndOfService})
+	if len(s.Observers) > 0 || s.PauseTime != nil {
+		e.schedule(s.WallClock+e.observeInterval(), &engineEvent{kind: engineObserve})
+	}
+}
+
+// observeInterval is how often the observers see the simulation: every StepLength, or less often
+// if every one of them is an IntervalObserver that needs to see it less often.
+func (e *eventEngine) observeInterval() time.Duration {
+	s := e.sim
+	if s.PauseTime != nil || len(s.Observers) == 0 {
+		return s.StepLength
+	}
+	var interval time.Duration
+	for _, observer := range s.Observers {
+		every := s.StepLength
+		if sampler, ok := observer.(IntervalObserver); ok && sampler.ObserveInterval() > every {
+			every = sampler.ObserveInterval()
+		}
+		if interval == 0 || every < interval {
+			interval = every
+		}
+	}
+	return interval
+}
+
+// runUntil processes events before `until`, stopping early once the service has ended and every
+// train is back in the yard.
+func (e *eventEngine) runUntil(until time.Duration) {
+	s := e.sim
+	for e.queue.Len() > 0 && e.queue[0].at < until && !s.IsFinished() {
+		event := heap.Pop(&e.queue).(*engineEvent)
+		s.WallClock = event.at
+		e.handle(event)
+	}
+	if !s.IsFinished() && s.WallClock < until && e.queue.Len() > 0 {
+		s.WallClock = until
+	}
+}
+
+func (e *eventEngine) handle(event *engineEvent) {
+	s := e.sim
+	switch event.kind {
+	case engineYardRelease:
+		{
+			e.releaseFromYard()
+		}
+	case engineEndOfService:
+		{
+			s.IsComplete()
+		}
+	case enginePassengerArrival:
+		{
+			e.passengerArrives(event.station)
+		}
+	case engineMovementReady:
+		{
+			e.movementReady(event.station, event.movement)
+		}
+	case engineCirculationFree:
+		{
+			e.circulationScheduled[event.circulation] = false
+			e.admit(event.station, event.circulation)
+		}
+	case enginePassengerGivesUp:
+		{
+			s.PassengersGiveUp(event.station)
+		}
+	case engineTrainPassesSignal:
+		{
+			e.passesSignal(event.train, event.version)
+		}
+	case engineSignalClears:
+		{
+			waiting := e.waiting[event.signal]
+			delete(e.waiting, event.signal)
+			for _, train := range waiting {
+				e.proceed(train)
+			}
+		}
+	case engineDwellEnds:
+		{
+			e.dwellEnds(event.train, event.station)
+		}
+	case engineIncident:
+		{
+			e.incident(event.station)
+		}
+	case engineIncidentEnds:
+		{
+			if event.station.OutBoundTrain == event.train || event.station.InBoundTrain == event.train {
+				s.ReleaseTrainOnHold(event.station, event.train)
+				e.dwellEnds(event.train, event.station)
+			}
+		}
+	case engineElevatorOutage:
+		{
+			s.ApplyElevatorOutages()
+			for _, station := range s.Stations {
+				if station.Layout != nil {
+					for _, circulation := range station.Layout.Circulations() {
+						e.admit(station, circulation)
+					}
+				}
+			}
+		}
+	case engineObserve:
+		{
+			e.syncPositions()
+			for _, observer := range s.Observers {
+				observer.Observe(s)
+			}
+			if s.PauseTime != nil {
+				s.Display()
+				time.Sleep(*s.PauseTime)
+			}
+			e.schedule(s.WallClock+e.observeInterval(), &engineEvent{kind: engineObserve})
+		}
+	}
+}
+
+func (e *eventEngine) releaseFromYard() {
+	s := e.sim
+	if s.Complete {
+		return
+	}
+	terminus := s.Stations[0]
+	if s.Yard.Len() == 0 || !e.signalFree(platformSignal(terminus, true), nil) {
+		// try again as soon as a train is back or the platform clears.
+		e.releasePending = true
+		return
+	}
+
+	s.LastTrainReleased = s.WallClock
+	train := s.Yard.Dequeue()
+	train.HasLeftYard(s.WallClock)
+	s.publishTrain(EventTrainReleased, slog.LevelInfo, train, terminus, "Releasing [%d] from yard, %d left in yard", train.ID, s.Yard.Len())
+	train.ArrivesAtStation(s.WallClock, terminus)
+	terminus.RecordOccupancy(s.WallClock)
+	e.schedule(s.WallClock+train.DwellTime(terminus), &engineEvent{kind: engineDwellEnds, train: train, station: terminus})
+	e.schedule(s.WallClock+s.AverageTimeBetweenTrains, &engineEvent{kind: engineYardRelease})
+}
+
+// startPassengerProcesses starts passengers arriving and incidents happening, once the line is at stasis.
+func (e *eventEngine) startPassengerProcesses() {
+	s := e.sim
+	for _, station := range s.Stations {
+		e.scheduleNext(e.arrivalRate(station), &engineEvent{kind: enginePassengerArrival, station: station})
+		e.scheduleNext(e.incidentRate(station), &engineEvent{kind: engineIncident, station: station})
+	}
+}
+
+// arrivalRate is passengers per second, the stepped engine's per-step arrival probability spread over the step.
+func (e *eventEngine) arrivalRate(station *Station) float64 {
+	probability := station.PassengerArrivalPDF(e.sim.Provider, e.sim.StepLength)
+	if math.IsNaN(probability) || probability <= 0 {
+		return 0
+	}
+	return math.Min(probability, 1) / e.sim.StepLength.Seconds()
+}
+
+// incidentRate is incidents per second while a train is in the station.
+func (e *eventEngine) incidentRate(station *Station) float64 {
+	s := e.sim
+	if s.TotalAverageRidership == 0 || s.StationIncidentLikelihood <= 0 {
+		return 0
+	}
+	ridershipRatio := float64(station.RidersPerDayMean) / float64(s.TotalAverageRidership)
+	return ridershipRatio * s.StationIncidentLikelihood / time.Hour.Seconds()
+}
+
+func (e *eventEngine) passengerArrives(station *Station) {
+	s := e.sim
+	if s.Complete {
+		return
+	}
+	defer e.scheduleNext(e.arrivalRate(station), &engineEvent{kind: enginePassengerArrival, station: station})
+	if s.People.Len() == 0 {
+		return
+	}
+
+	passenger := s.People.Dequeue()
+	if passenger.Segment != nil && s.Provider.Float64() > passenger.Segment.ArrivalLikelihood(s.TimeOfDay()) {
+		s.People.Enqueue(passenger)
+		return
+	}
+	s.PassengerArrivesAtStation(station, passenger)
+	if station.Layout == nil {
+		e.passengerOnPlatform(station, passenger)
+	}
+	station.RecordOccupancy(s.WallClock)
+}
+
+// passengerOnPlatform is called once a passenger has been through PassengerReachesPlatform,
+// to give up on them later if they're still waiting.
+func (e *eventEngine) passengerOnPlatform(station *Station, passenger *Passenger) {
+	if passenger.StartedWaiting == 0 || passenger.Segment == nil || passenger.Segment.Patience <= 0 {
+		return
+	}
+	e.schedule(e.sim.WallClock+passenger.Segment.Patience+time.Nanosecond, &engineEvent{kind: enginePassengerGivesUp, station: station})
+}
+
+func (e *eventEngine) movementReady(station *Station, m *Movement) {
+	s := e.sim
+	if m.Index < len(m.Steps) {
+		circulation := m.Steps[m.Index]
+		m.Queued = true
+		circulation.Queue = append(circulation.Queue, m)
+		e.admit(station, circulation)
+		return
+	}
+
+	// nothing here walks the movements in order, so swap the finished one out.
+	layout := station.Layout
+	for index, other := range layout.Movements {
+		if other == m {
+			last := len(layout.Movements) - 1
+			layout.Movements[index] = layout.Movements[last]
+			layout.Movements[last] = nil
+			layout.Movements = layout.Movements[:last]
+			break
+		}
+	}
+	if m.Egress {
+		station.PassengerExits(s.WallClock, m.Passenger)
+		return
+	}
+	s.PassengerReachesPlatform(station, m.Passenger)
+	e.passengerOnPlatform(station, m.Passenger)
+	station.RecordOccupancy(s.WallClock)
+}
+
+// admit lets queued movements through the circulation element one at a time, at its capacity.
+func (e *eventEngine) admit(station *Station, circulation *Circulation) {
+	s := e.sim
+	if circulation.OutOfService || circulation.CapacityPerMinute <= 0 {
+		return
+	}
+	interval := secondsToDuration(time.Minute.Seconds() / circulation.CapacityPerMinute)
+	for len(circulation.Queue) > 0 && s.WallClock >= e.circulationFree[circulation] {
+		m := circulation.Queue[0]
+		circulation.Queue = circulation.Queue[1:]
+		m.Admitted(s.WallClock, circulation)
+		e.circulationFree[circulation] = s.WallClock + interval
+		e.schedule(m.ReadyAt, &engineEvent{kind: engineMovementReady, station: station, movement: m})
+	}
+	if len(circulation.Queue) > 0 && !e.circulationScheduled[circulation] {
+		e.circulationScheduled[circulation] = true
+		e.schedule(e.circulationFree[circulation], &engineEvent{kind: engineCirculationFree, station: station, circulation: circulation})
+	}
+}
+
+// platformDirection returns which platform a train arriving at the station ends up on.
+func platformDirection(station *Station, train *Train) bool {
+	if station.IsOutboundTerminus() {
+		return false
+	}
+	return train.IsOutbound
+}
+
+func platformTrain(station *Station, isOutbound bool) *Train {
+	if isOutbound {
+		return station.OutBoundTrain
+	}
+	return station.InBoundTrain
+}
+
+// signalFree returns if the block or platform can be cleared for the train.
+func (e *eventEngine) signalFree(signal engineSignal, train *Train) bool {
+	if holder := e.holders[signal]; holder != nil && holder != train {
+		return false
+	}
+	if signal.station != nil {
+		if occupant := platformTrain(signal.station, signal.isOutbound); occupant != nil && occupant != train {
+			return false
+		}
+	}
+	return true
+}
+
+// signalBlocks returns how many blocks a track is split into.
+func signalBlocks(track *Track) int {
+	return int(math.Max(math.Ceil(track.DistanceMeters/signalBlockLength), 1))
+}
+
+// planRun lays out the run from a stand at `from` to the next station the train stops at.
+func (e *eventEngine) planRun(train *Train, from *Station) *trainRun {
+	run := &trainRun{cleared: 1}
+	run.sections = append(run.sections, runSection{signal: platformSignal(from, train.IsOutbound)})
+	var distance float64
+	station := from
+	for {
+		track := station.TrackFor(train.IsOutbound)
+		blocks := signalBlocks(track)
+		length := track.DistanceMeters / float64(blocks)
+		for block := 0; block < blocks; block++ {
+			section := runSection{
+				signal:     engineSignal{track: track, block: block},
+				start:      distance + float64(block)*length,
+				end:        distance + float64(block+1)*length,
+				trackStart: distance,
+			}
+			if block == blocks-1 {
+				section.end = distance + track.DistanceMeters
+			}
+			run.sections = append(run.sections, section)
+		}
+		distance += track.DistanceMeters
+		station = track.End
+		run.sections = append(run.sections, runSection{signal: platformSignal(station, platformDirection(station, train)), start: distance, end: distance})
+		if train.StopsAt(station) {
+			return run
+		}
+	}
+}
+
+// clearAhead clears the train through as many of the sections ahead of it as are free, returning
+// if it cleared any; it waits at the signal of the first that isn't. A platform it runs through is
+// only cleared along with the block after it, so it never has to stop there.
+func (e *eventEngine) clearAhead(train *Train, run *trainRun) bool {
+	cleared := run.cleared
+	for run.cleared < len(run.sections) {
+		count := 1
+		if run.sections[run.cleared].signal.station != nil && run.cleared+1 < len(run.sections) {
+			count = 2
+		}
+		for _, section := range run.sections[run.cleared : run.cleared+count] {
+			if !e.signalFree(section.signal, train) {
+				e.waitAt(section.signal, train)
+				return run.cleared > cleared
+			}
+		}
+		for _, section := range run.sections[run.cleared : run.cleared+count] {
+			e.holders[section.signal] = train
+		}
+		run.cleared += count
+	}
+	return run.cleared > cleared
+}
+
+func (e *eventEngine) waitAt(signal engineSignal, train *Train) {
+	for _, waiting := range e.waiting[signal] {
+		if waiting == train {
+			return
+		}
+	}
+	e.waiting[signal] = append(e.waiting[signal], train)
+}
+
+// clearSignal lets go of a block or platform, and lets the trains waiting for it try again.
+func (e *eventEngine) clearSignal(signal engineSignal) {
+	delete(e.holders, signal)
+	if len(e.waiting[signal]) > 0 {
+		e.schedule(e.sim.WallClock, &engineEvent{kind: engineSignalClears, signal: signal})
+	}
+}
+
+// proceed carries on a train that was waiting at a signal.
+func (e *eventEngine) proceed(train *Train) {
+	run := e.runs[train]
+	if run == nil {
+		return
+	}
+	if run.at == 0 {
+		// it's still at the platform it's leaving from.
+		e.dwellEnds(train, run.sections[0].signal.station)
+		return
+	}
+	if e.clearAhead(train, run) {
+		e.replan(train, run)
+	}
+}
+
+// replan works out the train's motion from where it is now to as far as it's been cleared.
+func (e *eventEngine) replan(train *Train, run *trainRun) {
+	s := e.sim
+	distance, speed := run.position(s.WallClock)
+	target := run.sections[run.cleared-1].end
+	if run.cleared < len(run.sections) {
+		target = math.Max(target-blockedApproachDistance, distance+speed*speed/(2*train.Braking))
+		train.SendSignal(SignalCaution)
+	} else {
+		train.SendSignal(SignalGo)
+	}
+	run.start, run.origin, run.version = s.WallClock, distance, run.version+1
+	run.profile = newMotionProfileFrom(target-distance, speed, train.MaximumSpeed, train.Acceleration, train.Braking)
+	e.schedulePassing(train, run)
+}
+
+// schedulePassing schedules the train reaching the end of the section it's in, if it's been
+// cleared beyond it.
+func (e *eventEngine) schedulePassing(train *Train, run *trainRun) {
+	if run.at+1 >= run.cleared || !run.profile.Arrives() {
+		// it stops short, or sits where the run's stall check will find it if it can't move at all.
+		return
+	}
+	at := run.start + run.profile.TimeAt(run.sections[run.at].end-run.origin)
+	e.schedule(at, &engineEvent{kind: engineTrainPassesSignal, train: train, version: run.version})
+}
+
+// passesSignal moves the train on from a block, into the next one or a station.
+func (e *eventEngine) passesSignal(train *Train, version int) {
+	run := e.runs[train]
+	if run == nil || run.version != version {
+		return
+	}
+	e.clearSignal(run.sections[run.at].signal)
+	run.at++
+	if station := run.sections[run.at].signal.station; station != nil {
+		e.trainArrives(train, station)
+		return
+	}
+	e.schedulePassing(train, run)
+}
+
+func (e *eventEngine) trainArrives(train *Train, station *Station) {
+	s := e.sim
+	track := e.tracks[train]
+	track.RemoveTrain(train.ID)
+	train.DistanceTraveled += track.DistanceMeters
+	track.Traversals = append(track.Traversals, Traversal{
+		TrainID:    train.ID,
+		DepartedAt: train.DepartedStation,
+		RunTime:    s.WallClock - train.DepartedStation,
+		Load:       len(train.Passengers),
+		Capacity:   train.Capacity,
+	})
+	_, train.Speed = e.runs[train].position(s.WallClock)
+	train.SendSignal(SignalGo)
+	train.ArrivesAtStation(s.WallClock, station)
+	station.RecordOccupancy(s.WallClock)
+
+	if station.IsInboundTerminus() && !train.IsOutbound {
+		s.publishTrain(EventTrainReturned, slog.LevelInfo, train, station, "Returning [%d] to the yard", train.ID)
+		station.TrainDeparts(train)
+		train.ReturnsToYard(s.WallClock, station)
+		delete(e.runs, train)
+		delete(e.tracks, train)
+		s.Yard.Enqueue(train)
+		if !s.Stasis {
+			s.IsAtStasis()
+			e.startPassengerProcesses()
+		}
+		e.platformCleared(station, false)
+		e.retryRelease()
+		return
+	}
+
+	if !train.StopsAt(station) {
+		e.depart(train, station)
+		return
+	}
+	delete(e.runs, train)
+	e.schedule(s.WallClock+train.DwellTime(station), &engineEvent{kind: engineDwellEnds, train: train, station: station})
+}
+
+func (e *eventEngine) dwellEnds(train *Train, station *Station) {
+	s := e.sim
+	if platformTrain(station, train.IsOutbound) != train || train.Signal == SignalHold {
+		// gone already, or held by an incident, which will try again when it ends.
+		return
+	}
+	if remaining := train.ArrivedAtStation + train.DwellTime(station) - s.WallClock; remaining > 0 {
+		// riders stepping on since it arrived have lengthened the dwell.
+		e.schedule(s.WallClock+remaining, &engineEvent{kind: engineDwellEnds, train: train, station: station})
+		return
+	}
+	e.depart(train, station)
+}
+
+// depart sends the train on from the station, once the block after it is clear.
+func (e *eventEngine) depart(train *Train, station *Station) {
+	s := e.sim
+	run := e.runs[train]
+	if run == nil {
+		run = e.planRun(train, station)
+		e.runs[train] = run
+	}
+	if run.cleared <= run.at+1 && !e.clearAhead(train, run) {
+		return
+	}
+	isOutbound := train.IsOutbound
+	train.Depart(s.WallClock, station)
+	if platformTrain(station, isOutbound) == train {
+		return
+	}
+	e.tracks[train] = station.TrackFor(isOutbound)
+	e.platformCleared(station, isOutbound)
+	run.at++
+	if run.at == 1 {
+		// off from a stand.
+		e.replan(train, run)
+		return
+	}
+	e.schedulePassing(train, run)
+}
+
+// platformCleared lets the trains waiting for the platform, or the yard, into it.
+func (e *eventEngine) platformCleared(station *Station, isOutbound bool) {
+	e.clearSignal(platformSignal(station, isOutbound))
+	if station == e.sim.Stations[0] && isOutbound {
+		e.retryRelease()
+	}
+}
+
+// retryRelease releases a train from the yard if one was due but couldn't go.
+func (e *eventEngine) retryRelease() {
+	if e.releasePending {
+		e.releasePending = false
+		e.releaseFromYard()
+	}
+}
+
+func (e *eventEngine) incident(station *Station) {
+	s := e.sim
+	if s.Complete {
+		return
+	}
+	defer e.scheduleNext(e.incidentRate(station), &engineEvent{kind: engineIncident, station: station})
+
+	var trainAffected *Train
+	if station.OutBoundTrain != nil && station.InBoundTrain != nil {
+		if s.Provider.Float64() <= 0.5 {
+			trainAffected = station.OutBoundTrain
+		} else {
+			trainAffected = station.InBoundTrain
+		}
+	} else if station.OutBoundTrain != nil {
+		trainAffected = station.OutBoundTrain
+	} else {
+		trainAffected = station.InBoundTrain
+	}
+	if trainAffected == nil {
+		return
+	}
+
+	s.StartIncident(station, trainAffected)
+	e.schedule(s.WallClock+s.AverageIncidentDelay, &engineEvent{kind: engineIncidentEnds, train: trainAffected, station: station})
+}
+
+// syncPositions works out where every running train is for observers.
+func (e *eventEngine) syncPositions() {
+	s := e.sim
+	for train, run := range e.runs {
+		if run.at == 0 {
+			// still at the platform it's leaving from.
+			continue
+		}
+		distance, speed := run.position(s.WallClock)
+		// the bounds only ever catch rounding, as the run is planned within the blocks it's cleared through.
+		train.Position = math.Min(math.Max(distance-run.sections[run.at].trackStart, 0), e.tracks[train].DistanceMeters)
+		train.Speed = speed
+	}
+}
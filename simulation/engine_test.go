@@ -0,0 +1,226 @@
+package simulation
+
+import (
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestMotionProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	// 10m/s reached after 5s and 25m, both ways, so 1000m is 5s + 95s + 5s.
+	profile := newMotionProfile(1000, 10, 2, 2)
+	assert.Equal(10.0, profile.Peak)
+	assert.InDelta(105.0, profile.Seconds(), 0.0001)
+	assert.Equal(profile.Duration(), profile.TimeAt(1000))
+	assert.Equal(5*time.Second, profile.TimeAt(25))
+
+	distance, speed := profile.At(50 * time.Second)
+	assert.InDelta(475.0, distance, 0.0001)
+	assert.Equal(10.0, speed)
+	distance, speed = profile.At(profile.Duration())
+	assert.Equal(1000.0, distance)
+	assert.Zero(speed)
+
+	for _, meters := range []float64{10, 25, 500, 990} {
+		distance, _ := profile.At(profile.TimeAt(meters))
+		assert.InDelta(meters, distance, 0.001)
+	}
+}
+
+func TestMotionProfileShortRun(t *testing.T) {
+	assert := assert.New(t)
+
+	// too short to get to 10m/s, so it peaks halfway at sqrt(2 * 16 * 2 * 2 / 4).
+	profile := newMotionProfile(16, 10, 2, 2)
+	assert.InDelta(math.Sqrt(32), profile.Peak, 0.0001)
+	assert.Zero(profile.cruiseDistance())
+	assert.InDelta(math.Sqrt(32), profile.Seconds(), 0.0001)
+}
+
+func TestMotionProfileFromSpeed(t *testing.T) {
+	assert := assert.New(t)
+
+	// from 6m/s, 10m/s is 2s and 16m on, so 1000m is 2s + 95.9s + 5s.
+	profile := newMotionProfileFrom(1000, 6, 10, 2, 2)
+	assert.Equal(10.0, profile.Peak)
+	assert.InDelta(102.9, profile.Seconds(), 0.0001)
+	assert.Equal(2*time.Second, profile.TimeAt(16))
+	distance, speed := profile.At(0)
+	assert.Zero(distance)
+	assert.Equal(6.0, speed)
+	distance, speed = profile.At(time.Second)
+	assert.InDelta(7.0, distance, 0.0001)
+	assert.InDelta(8.0, speed, 0.0001)
+
+	// too close to stop at the usual rate, so it brakes harder, from 10m/s to a stand in 20m and 4s.
+	profile = newMotionProfileFrom(20, 10, 10, 2, 2)
+	assert.Equal(10.0, profile.Peak)
+	assert.InDelta(2.5, profile.Braking, 0.0001)
+	assert.InDelta(4.0, profile.Seconds(), 0.0001)
+	distance, _ = profile.At(profile.Duration())
+	assert.Equal(20.0, distance)
+}
+
+func TestMotionProfileCantMove(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, profile := range []motionProfile{newMotionProfile(1000, 10, 0, 2), newMotionProfile(1000, 10, 2, 0), newMotionProfile(1000, 0, 2, 2)} {
+		assert.False(profile.Arrives())
+		assert.Equal(time.Duration(math.MaxInt64), profile.Duration())
+		assert.Equal(time.Duration(math.MaxInt64), profile.TimeAt(500))
+		distance, speed := profile.At(24 * time.Hour)
+		assert.Zero(distance)
+		assert.Zero(speed)
+	}
+	assert.True(newMotionProfile(0, 10, 0, 0).Arrives())
+}
+
+func TestEventEngineTrainsThatCantMove(t *testing.T) {
+	assert := assert.New(t)
+
+	// with nothing to stop the run, it ends with no train having made it back to the yard.
+	scenario := testReplicationScenario()
+	scenario.Config.Engine = EngineEvent
+	scenario.Config.TrainAverageAcceleration = 0
+	sim := scenario.NewSimulation(1)
+	stats := sim.Simulate()
+	assert.False(sim.AllTrainsReturned())
+	assert.Zero(stats.Revenue.Trips)
+}
+
+// positionObserver checks every train running between stations is somewhere on its track.
+type positionObserver struct {
+	t        *testing.T
+	observed int
+}
+
+func (po *positionObserver) Observe(s *Simulation) {
+	for _, station := range s.Stations {
+		for _, track := range []*Track{station.OutBoundTrack, station.InBoundTrack} {
+			if track == nil {
+				continue
+			}
+			for _, train := range track.Trains {
+				if train.Position < 0 || train.Position > track.DistanceMeters || train.Speed < 0 || train.Speed > train.MaximumSpeed+0.001 {
+					po.t.Errorf("train %d at %0.2fm of %0.2fm doing %0.2fm/s", train.ID, train.Position, track.DistanceMeters, train.Speed)
+				}
+			}
+		}
+	}
+	po.observed++
+}
+
+func TestEventEngine(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	scenario.Config.Engine = EngineEvent
+	sim := scenario.NewSimulation(1)
+	observer := &positionObserver{t: t}
+	sim.Observers = append(sim.Observers, observer)
+	stats := sim.Simulate()
+
+	assert.True(sim.Complete)
+	assert.True(sim.AllTrainsReturned())
+	assert.True(sim.Stasis)
+	assert.NotZero(observer.observed)
+	assert.NotZero(stats.Revenue.Trips)
+	assert.NotZero(stats.AverageTrainRoundTripTime)
+
+	again := scenario.NewSimulation(1).Simulate()
+	assert.Equal(stats.Revenue.Trips, again.Revenue.Trips)
+	assert.Equal(stats.AveragePassengerJourneyTime, again.AveragePassengerJourneyTime)
+}
+
+func TestEventEngineWithStationLayouts(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	scenario.Config.Engine = EngineEvent
+	scenario.Config.UseStationLayouts = true
+	sim := scenario.NewSimulation(1)
+	stats := sim.Simulate()
+
+	assert.True(sim.AllTrainsReturned())
+	assert.NotNil(sim.Stations[0].Layout)
+	assert.NotZero(stats.Revenue.Trips)
+}
+
+func TestEventEngineMatchesSteppedEngine(t *testing.T) {
+	assert := assert.New(t)
+
+	// the engines are different models of the line (see EngineEvent), so at the default config
+	// they only agree to within the stepped engine's error at a 1 s step.
+	stepped := testReplicationScenario()
+	fine := stepped
+	fine.Config.StepLength = 100 * time.Millisecond
+	event := stepped
+	event.Config.Engine = EngineEvent
+
+	estimate := func(scenario Scenario) map[string]float64 {
+		var stats []*SimulationStats
+		for index := 0; index < 8; index++ {
+			stats = append(stats, scenario.NewSimulation(DeriveSeed(1, index)).Simulate())
+		}
+		means := map[string]float64{}
+		for _, metric := range EstimateMetrics(stats, 0.95) {
+			means[metric.Name] = metric.Mean
+		}
+		return means
+	}
+	steppedMeans, fineMeans, eventMeans := estimate(stepped), estimate(fine), estimate(event)
+	for _, name := range []string{"Mean Wait (s)", "Mean In-Vehicle (s)", "Mean Journey (s)", "Mean Round Trip (s)"} {
+		assert.InDelta(eventMeans[name], steppedMeans[name], 0.15*eventMeans[name], name)
+	}
+
+	// the stepped engine's runs close in on the event engine's exact ones as its steps get shorter.
+	roundTrip := "Mean Round Trip (s)"
+	assert.True(math.Abs(fineMeans[roundTrip]-eventMeans[roundTrip]) < math.Abs(steppedMeans[roundTrip]-eventMeans[roundTrip]))
+	assert.InDelta(eventMeans[roundTrip], fineMeans[roundTrip], 0.02*eventMeans[roundTrip])
+}
+
+func TestEventEngineObservesAtTheLongestInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	scenario.Config.Engine = EngineEvent
+	sim := scenario.NewSimulation(1)
+	sim.Generate()
+	trajectories := NewTrajectoryRecorder(time.Minute)
+	recorder, err := NewRecorder(io.Discard, RecorderFormatCSV, 5*time.Minute)
+	assert.Nil(err)
+	sim.Observers = append(sim.Observers, trajectories, recorder)
+	sim.RunUntil(time.Hour)
+	assert.NotEmpty(trajectories.TrainIDs())
+	for _, id := range trajectories.TrainIDs() {
+		for _, point := range trajectories.Trajectories[id] {
+			assert.Zero(point.Time % time.Minute)
+		}
+	}
+	assert.Equal(time.Minute, sim.eventEngine().observeInterval())
+
+	// anything that has to see every step gets to.
+	sim.Observers = append(sim.Observers, &positionObserver{t: t})
+	assert.Equal(sim.StepLength, sim.eventEngine().observeInterval())
+}
+
+func benchmarkEngine(b *testing.B, engine string) {
+	scenario := testReplicationScenario()
+	scenario.Config.Engine = engine
+	for n := 0; n < b.N; n++ {
+		scenario.NewSimulation(DeriveSeed(1, n)).Simulate()
+	}
+}
+
+func BenchmarkSteppedEngine(b *testing.B) {
+	benchmarkEngine(b, EngineStepped)
+}
+
+func BenchmarkEventEngine(b *testing.B) {
+	benchmarkEngine(b, EngineEvent)
+}
@@ -0,0 +1,279 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultEventLogCapacity is how many recent events the simulation keeps in memory.
+	DefaultEventLogCapacity = 1024
+)
+
+// EventKind is what happened.
+type EventKind string
+
+// Event kinds.
+const (
+	EventTrainReleased       EventKind = "train_released"
+	EventTrainArrived        EventKind = "train_arrived"
+	EventTrainDeparted       EventKind = "train_departed"
+	EventTrainReturned       EventKind = "train_returned"
+	EventIncidentStarted     EventKind = "incident_started"
+	EventIncidentResolved    EventKind = "incident_resolved"
+	EventTrainHeld           EventKind = "train_held"
+	EventTrainHoldReleased   EventKind = "train_hold_released"
+	EventPassengerBoarded    EventKind = "passenger_boarded"
+	EventPassengerAlighted   EventKind = "passenger_alighted"
+	EventStepFreeUnavailable EventKind = "step_free_unavailable"
+	EventElevatorOutOfOrder  EventKind = "elevator_out_of_service"
+	EventElevatorRestored    EventKind = "elevator_restored"
+	EventStasisReached       EventKind = "stasis_reached"
+	EventComplete            EventKind = "complete"
+	EventInvariantViolated   EventKind = "invariant_violated"
+)
+
+// NoID marks an event that isn't about a train or passenger.
+const NoID = -1
+
+// Event is something that happened during the simulation.
+type Event struct {
+	Time  time.Duration
+	Kind  EventKind
+	Level slog.Level
+
+	// TrainID and PassengerID are NoID when the event isn't about one.
+	TrainID     int
+	PassengerID int
+	Station     string
+
+	Message string
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%v - %s", e.Time, e.Message)
+}
+
+// EventFilter picks which events a subscriber hears about. Empty fields match everything.
+type EventFilter struct {
+	MinimumLevel slog.Level
+	Kinds        []EventKind
+	Station      string
+	TrainID      *int
+}
+
+// Matches returns if the event passes the filter.
+func (ef EventFilter) Matches(e Event) bool {
+	if e.Level < ef.MinimumLevel {
+		return false
+	}
+	if len(ef.Station) > 0 && e.Station != ef.Station {
+		return false
+	}
+	if ef.TrainID != nil && e.TrainID != *ef.TrainID {
+		return false
+	}
+	if len(ef.Kinds) == 0 {
+		return true
+	}
+	for _, kind := range ef.Kinds {
+		if kind == e.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// EventHandler is called with each event a subscriber's filter matches.
+type EventHandler func(e Event)
+
+type eventSubscription struct {
+	filter  EventFilter
+	handler EventHandler
+}
+
+// NewEventLog returns an event log keeping the last `capacity` events at info level and up.
+func NewEventLog(capacity int) *EventLog {
+	return &EventLog{
+		events:       make([]Event, capacity),
+		MinimumLevel: slog.LevelInfo,
+	}
+}
+
+// EventLog keeps the most recent events in a fixed size ring buffer, so memory stays bounded
+// however long the run, and passes every event on to its subscribers.
+type EventLog struct {
+	events      []Event
+	start       int
+	count       int
+	subscribers []eventSubscription
+
+	// MinimumLevel is the lowest level of event kept in the buffer, so a flood of passenger
+	// events doesn't push out the ones about trains. Subscribers still hear about everything they ask for.
+	MinimumLevel slog.Level
+
+	// Published counts every event, including those that have since been dropped from the buffer.
+	Published int
+}
+
+// Publish records an event and hands it to any matching subscribers. It's safe to call on a nil log.
+func (el *EventLog) Publish(e Event) {
+	if el == nil {
+		return
+	}
+	el.Published++
+	if len(el.events) > 0 && e.Level >= el.MinimumLevel {
+		if el.count < len(el.events) {
+			el.events[(el.start+el.count)%len(el.events)] = e
+			el.count++
+		} else {
+			el.events[el.start] = e
+			el.start = (el.start + 1) % len(el.events)
+		}
+	}
+	for _, subscriber := range el.subscribers {
+		if subscriber.filter.Matches(e) {
+			subscriber.handler(e)
+		}
+	}
+}
+
+// Wants returns if an event at the given level would be kept or heard by anyone, so it needn't be
+// put together otherwise. It's safe to call on a nil log.
+func (el *EventLog) Wants(level slog.Level) bool {
+	if el == nil {
+		return false
+	}
+	if len(el.events) > 0 && level >= el.MinimumLevel {
+		return true
+	}
+	for _, subscriber := range el.subscribers {
+		if level >= subscriber.filter.MinimumLevel {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe calls the handler with every event the filter matches from now on.
+func (el *EventLog) Subscribe(filter EventFilter, handler EventHandler) {
+	el.subscribers = append(el.subscribers, eventSubscription{filter: filter, handler: handler})
+}
+
+// Len returns how many events are in the buffer.
+func (el *EventLog) Len() int {
+	if el == nil {
+		return 0
+	}
+	return el.count
+}
+
+// Recent returns up to the last `count` events, oldest first.
+func (el *EventLog) Recent(count int) []Event {
+	if el == nil {
+		return nil
+	}
+	if count > el.count {
+		count = el.count
+	}
+	events := make([]Event, 0, count)
+	for x := el.count - count; x < el.count; x++ {
+		events = append(events, el.events[(el.start+x)%len(el.events)])
+	}
+	return events
+}
+
+// NewJSONLEventWriter returns a handler that writes each event as a line of JSON through log/slog.
+// Events carry simulated time as "sim_time_s"; slog's wall clock time is left out so runs with the
+// same seed write the same file.
+func NewJSONLEventWriter(w io.Writer) EventHandler {
+	logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+	return func(e Event) {
+		attrs := []slog.Attr{
+			slog.Float64("sim_time_s", e.Time.Seconds()),
+			slog.String("kind", string(e.Kind)),
+		}
+		if e.TrainID != NoID {
+			attrs = append(attrs, slog.Int("train_id", e.TrainID))
+		}
+		if e.PassengerID != NoID {
+			attrs = append(attrs, slog.Int("passenger_id", e.PassengerID))
+		}
+		if len(e.Station) > 0 {
+			attrs = append(attrs, slog.String("station", e.Station))
+		}
+		logger.LogAttrs(context.Background(), e.Level, e.Message, attrs...)
+	}
+}
+
+// newEvent returns an event that isn't about any train or passenger yet.
+func newEvent(wallClock time.Duration, kind EventKind, level slog.Level, format string, args ...interface{}) Event {
+	return Event{
+		Time:        wallClock,
+		Kind:        kind,
+		Level:       level,
+		TrainID:     NoID,
+		PassengerID: NoID,
+		Message:     fmt.Sprintf(format, args...),
+	}
+}
+
+func (s *Simulation) publish(kind EventKind, level slog.Level, format string, args ...interface{}) {
+	if !s.Events.Wants(level) {
+		return
+	}
+	s.Events.Publish(newEvent(s.WallClock, kind, level, format, args...))
+}
+
+func (s *Simulation) publishTrain(kind EventKind, level slog.Level, train *Train, station *Station, format string, args ...interface{}) {
+	if !s.Events.Wants(level) {
+		return
+	}
+	e := newEvent(s.WallClock, kind, level, format, args...)
+	e.TrainID = train.ID
+	if station != nil {
+		e.Station = station.Name
+	}
+	s.Events.Publish(e)
+}
+
+func (s *Simulation) publishStation(kind EventKind, level slog.Level, station *Station, format string, args ...interface{}) {
+	if !s.Events.Wants(level) {
+		return
+	}
+	e := newEvent(s.WallClock, kind, level, format, args...)
+	e.Station = station.Name
+	s.Events.Publish(e)
+}
+
+func (s *Station) publishTrain(wallClock time.Duration, kind EventKind, train *Train, format string, args ...interface{}) {
+	if !s.Events.Wants(slog.LevelInfo) {
+		return
+	}
+	e := newEvent(wallClock, kind, slog.LevelInfo, format, args...)
+	e.TrainID = train.ID
+	e.Station = s.Name
+	s.Events.Publish(e)
+}
+
+func (s *Station) publishPassenger(wallClock time.Duration, kind EventKind, train *Train, p *Passenger, verb string) {
+	if !s.Events.Wants(slog.LevelDebug) {
+		return
+	}
+	e := newEvent(wallClock, kind, slog.LevelDebug, "%v %s [%d] at %s", p, verb, train.ID, s.Name)
+	e.TrainID = train.ID
+	e.PassengerID = p.ID
+	e.Station = s.Name
+	s.Events.Publish(e)
+}
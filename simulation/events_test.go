@@ -0,0 +1,131 @@
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestEventLogBounded(t *testing.T) {
+	assert := assert.New(t)
+
+	log := NewEventLog(3)
+	for x := 0; x < 5; x++ {
+		log.Publish(newEvent(time.Duration(x)*time.Second, EventTrainArrived, slog.LevelInfo, "event %d", x))
+	}
+	assert.Equal(5, log.Published)
+	assert.Equal(3, log.Len())
+
+	recent := log.Recent(10)
+	assert.Len(recent, 3)
+	assert.Equal("event 2", recent[0].Message)
+	assert.Equal("event 4", recent[2].Message)
+	assert.Equal("event 4", log.Recent(1)[0].Message)
+}
+
+func TestEventLogKeepsInfoAndUp(t *testing.T) {
+	assert := assert.New(t)
+
+	log := NewEventLog(3)
+	assert.False(log.Wants(slog.LevelDebug))
+	assert.True(log.Wants(slog.LevelInfo))
+	for x := 0; x < 5; x++ {
+		log.Publish(newEvent(time.Duration(x)*time.Second, EventPassengerBoarded, slog.LevelDebug, "boarded %d", x))
+	}
+	log.Publish(newEvent(5*time.Second, EventTrainArrived, slog.LevelInfo, "arrived"))
+	assert.Equal(1, log.Len())
+	assert.Equal("arrived", log.Recent(1)[0].Message)
+
+	log.Subscribe(EventFilter{MinimumLevel: slog.LevelDebug}, func(e Event) {})
+	assert.True(log.Wants(slog.LevelDebug))
+
+	var missing *EventLog
+	assert.False(missing.Wants(slog.LevelError))
+}
+
+func TestEventLogSubscriberFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	log := NewEventLog(10)
+	trainID := 4
+	var heard []Event
+	log.Subscribe(EventFilter{MinimumLevel: slog.LevelInfo, Kinds: []EventKind{EventTrainDeparted}, TrainID: &trainID}, func(e Event) {
+		heard = append(heard, e)
+	})
+
+	departed := newEvent(0, EventTrainDeparted, slog.LevelInfo, "departed")
+	departed.TrainID = 4
+	log.Publish(departed)
+	departed.TrainID = 5
+	log.Publish(departed)
+	boarded := newEvent(0, EventPassengerBoarded, slog.LevelDebug, "boarded")
+	boarded.TrainID = 4
+	log.Publish(boarded)
+
+	assert.Len(heard, 1)
+	assert.Equal(4, heard[0].TrainID)
+}
+
+func TestJSONLEventWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := bytes.NewBuffer(nil)
+	log := NewEventLog(10)
+	log.Subscribe(EventFilter{MinimumLevel: slog.LevelDebug}, NewJSONLEventWriter(buffer))
+
+	e := newEvent(90*time.Second, EventIncidentStarted, slog.LevelWarn, "incident")
+	e.TrainID = 7
+	e.Station = "14 Street"
+	log.Publish(e)
+
+	var line map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(strings.TrimSpace(buffer.String())), &line))
+	assert.Equal("WARN", line["level"])
+	assert.Equal("incident", line["msg"])
+	assert.Equal(90.0, line["sim_time_s"])
+	assert.Equal("incident_started", line["kind"])
+	assert.Equal(7.0, line["train_id"])
+	assert.Equal("14 Street", line["station"])
+	_, hasPassenger := line["passenger_id"]
+	assert.False(hasPassenger)
+	_, hasTime := line["time"]
+	assert.False(hasTime)
+}
+
+func TestSimulationPublishesTrainEvents(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.CalculateTotalAverageRidership()
+
+	var kinds []EventKind
+	sim.Events.Subscribe(EventFilter{Kinds: []EventKind{EventTrainReleased, EventTrainDeparted}}, func(e Event) {
+		kinds = append(kinds, e.Kind)
+	})
+
+	for sim.WallClock < sim.AverageTimeBetweenTrains+2*time.Minute {
+		sim.Step()
+	}
+	assert.True(len(kinds) >= 2, len(kinds))
+	assert.Equal(EventTrainReleased, kinds[0])
+	assert.Equal(EventTrainDeparted, kinds[1])
+}
+
+func TestTrainPassingThroughPublishesArrival(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	train := sim.Yard.Dequeue()
+	train.Service = ExpressLocalServices(sim.Stations, []string{"96 Street", "Times Square-42 Street"}, 0.5)[1]
+	train.ArrivesAtStation(time.Minute, sim.Stations[7])
+
+	arrival := sim.Events.Recent(1)[0]
+	assert.Equal(EventTrainArrived, arrival.Kind)
+	assert.Equal(train.ID, arrival.TrainID)
+	assert.Equal(sim.Stations[7].Name, arrival.Station)
+	assert.True(strings.Contains(arrival.Message, "passed through"))
+}
@@ -0,0 +1,386 @@
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// FareTrip is what a fare policy needs to know about a completed trip.
+type FareTrip struct {
+	Origin         string
+	Destination    string
+	DistanceMeters float64
+	TimeOfDay      time.Duration
+}
+
+// FarePolicy prices a trip before any concession discount.
+type FarePolicy interface {
+	Fare(trip FareTrip) float64
+}
+
+// FlatFare charges the same for every trip.
+type FlatFare struct {
+	Amount float64 `json:"amount"`
+}
+
+func (ff FlatFare) Fare(trip FareTrip) float64 {
+	return ff.Amount
+}
+
+// DistanceFare charges a base fare plus a rate per kilometer, up to an optional maximum.
+type DistanceFare struct {
+	BaseFare     float64 `json:"base_fare"`
+	PerKilometer float64 `json:"per_kilometer"`
+	MaximumFare  float64 `json:"maximum_fare,omitempty"`
+}
+
+func (df DistanceFare) Fare(trip FareTrip) float64 {
+	fare := df.BaseFare + df.PerKilometer*(trip.DistanceMeters/1000.0)
+	if df.MaximumFare > 0 {
+		return math.Min(fare, df.MaximumFare)
+	}
+	return fare
+}
+
+// ZoneFare charges a base fare plus a rate for every zone boundary crossed.
+// Stations missing from Zones are in zone 0.
+type ZoneFare struct {
+	Zones       map[string]int `json:"zones"`
+	BaseFare    float64        `json:"base_fare"`
+	PerZoneFare float64        `json:"per_zone_fare"`
+}
+
+func (zf ZoneFare) Fare(trip FareTrip) float64 {
+	zonesCrossed := zf.Zones[trip.Destination] - zf.Zones[trip.Origin]
+	if zonesCrossed < 0 {
+		zonesCrossed = -zonesCrossed
+	}
+	return zf.BaseFare + zf.PerZoneFare*float64(zonesCrossed)
+}
+
+// FarePeriod is a window of the day, e.g. the morning peak.
+type FarePeriod struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+}
+
+// Contains returns if the time of day falls in the period.
+func (fp FarePeriod) Contains(timeOfDay time.Duration) bool {
+	return timeOfDay >= fp.Start && timeOfDay < fp.End
+}
+
+// TimeOfDayFare scales another policy's fare up during peak periods and down otherwise.
+type TimeOfDayFare struct {
+	Policy            FarePolicy
+	PeakPeriods       []FarePeriod
+	PeakMultiplier    float64
+	OffPeakMultiplier float64
+}
+
+func (tdf TimeOfDayFare) Fare(trip FareTrip) float64 {
+	fare := tdf.Policy.Fare(trip)
+	for _, period := range tdf.PeakPeriods {
+		if period.Contains(trip.TimeOfDay) {
+			return fare * tdf.PeakMultiplier
+		}
+	}
+	return fare * tdf.OffPeakMultiplier
+}
+
+// FareConfig is a fare policy in a form that marshals, with exactly one of its fields set.
+type FareConfig struct {
+	Flat      *FlatFare            `json:"flat,omitempty"`
+	Distance  *DistanceFare        `json:"distance,omitempty"`
+	Zone      *ZoneFare            `json:"zone,omitempty"`
+	TimeOfDay *TimeOfDayFareConfig `json:"time_of_day,omitempty"`
+}
+
+// TimeOfDayFareConfig is a TimeOfDayFare in a form that marshals.
+type TimeOfDayFareConfig struct {
+	Policy            *FareConfig  `json:"policy"`
+	PeakPeriods       []FarePeriod `json:"peak_periods,omitempty"`
+	PeakMultiplier    float64      `json:"peak_multiplier"`
+	OffPeakMultiplier float64      `json:"off_peak_multiplier"`
+}
+
+// NewFareConfig returns the config for one of the package's fare policies, or nil for no policy.
+// It returns an error for other implementations of FarePolicy.
+func NewFareConfig(policy FarePolicy) (*FareConfig, error) {
+	switch typed := policy.(type) {
+	case nil:
+		{
+			return nil, nil
+		}
+	case FlatFare:
+		{
+			return &FareConfig{Flat: &typed}, nil
+		}
+	case *FlatFare:
+		{
+			return NewFareConfig(*typed)
+		}
+	case DistanceFare:
+		{
+			return &FareConfig{Distance: &typed}, nil
+		}
+	case *DistanceFare:
+		{
+			return NewFareConfig(*typed)
+		}
+	case ZoneFare:
+		{
+			return &FareConfig{Zone: &typed}, nil
+		}
+	case *ZoneFare:
+		{
+			return NewFareConfig(*typed)
+		}
+	case TimeOfDayFare:
+		{
+			inner, err := NewFareConfig(typed.Policy)
+			if err != nil {
+				return nil, err
+			}
+			return &FareConfig{TimeOfDay: &TimeOfDayFareConfig{
+				Policy:            inner,
+				PeakPeriods:       typed.PeakPeriods,
+				PeakMultiplier:    typed.PeakMultiplier,
+				OffPeakMultiplier: typed.OffPeakMultiplier,
+			}}, nil
+		}
+	case *TimeOfDayFare:
+		{
+			return NewFareConfig(*typed)
+		}
+	default:
+		{
+			return nil, fmt.Errorf("can't describe a %T fare policy", policy)
+		}
+	}
+}
+
+// FarePolicy returns the policy the config describes, nil for none.
+func (fc *FareConfig) FarePolicy() FarePolicy {
+	switch {
+	case fc == nil:
+		{
+			return nil
+		}
+	case fc.Flat != nil:
+		{
+			return *fc.Flat
+		}
+	case fc.Distance != nil:
+		{
+			return *fc.Distance
+		}
+	case fc.Zone != nil:
+		{
+			return *fc.Zone
+		}
+	case fc.TimeOfDay != nil:
+		{
+			return TimeOfDayFare{
+				Policy:            fc.TimeOfDay.Policy.FarePolicy(),
+				PeakPeriods:       fc.TimeOfDay.PeakPeriods,
+				PeakMultiplier:    fc.TimeOfDay.PeakMultiplier,
+				OffPeakMultiplier: fc.TimeOfDay.OffPeakMultiplier,
+			}
+		}
+	}
+	return nil
+}
+
+// Validate returns an error unless exactly one policy is set, all the way down.
+func (fc *FareConfig) Validate() error {
+	var set int
+	for _, isSet := range []bool{fc.Flat != nil, fc.Distance != nil, fc.Zone != nil, fc.TimeOfDay != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("set exactly one of flat, distance, zone and time_of_day")
+	}
+	if fc.TimeOfDay != nil {
+		if fc.TimeOfDay.Policy == nil {
+			return fmt.Errorf("time_of_day: policy is required")
+		}
+		if err := fc.TimeOfDay.Policy.Validate(); err != nil {
+			return fmt.Errorf("time_of_day: policy: %v", err)
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON replaces the config rather than merging into it, so decoding a distance fare
+// over a flat one doesn't leave both set.
+func (fc *FareConfig) UnmarshalJSON(data []byte) error {
+	type plain FareConfig
+	var decoded plain
+	if err := decodeStrictly(data, &decoded); err != nil {
+		return err
+	}
+	*fc = FareConfig(decoded)
+	return nil
+}
+
+// DefaultConcessions returns a reduced fare for seniors and riders with disabilities.
+func DefaultConcessions() []*Concession {
+	return []*Concession{
+		{Name: "Reduced Fare", Share: 0.08, Discount: 0.5},
+	}
+}
+
+// Concession is a group of riders who get a discount, e.g. seniors or students.
+type Concession struct {
+	Name  string  `json:"name"`
+	Share float64 `json:"share"`
+	// Discount is the fraction of the fare taken off, 1.0 rides free.
+	Discount float64 `json:"discount"`
+}
+
+// Apply returns the fare after the discount.
+func (c *Concession) Apply(fare float64) float64 {
+	return fare * (1.0 - c.Discount)
+}
+
+// UnmarshalJSON replaces the concession rather than merging into it, so a config's
+// concessions decoded over another's don't pick up the other's fields.
+func (c *Concession) UnmarshalJSON(data []byte) error {
+	type plain Concession
+	var decoded plain
+	if err := decodeStrictly(data, &decoded); err != nil {
+		return err
+	}
+	*c = Concession(decoded)
+	return nil
+}
+
+func (c *Concession) String() string {
+	return c.Name
+}
+
+func (s *Simulation) randomConcession() *Concession {
+	if len(s.Concessions) == 0 {
+		return nil
+	}
+
+	draw := s.Provider.Float64()
+	for _, concession := range s.Concessions {
+		draw -= concession.Share
+		if draw < 0 {
+			return concession
+		}
+	}
+	return nil
+}
+
+// DistanceBetween returns the track distance between two stations in meters.
+func (s *Simulation) DistanceBetween(origin, destination string) float64 {
+	from := s.StationByName(origin)
+	if from == nil {
+		return 0
+	}
+
+	for _, isOutbound := range []bool{true, false} {
+		var distance float64
+		station := from
+		for station.Name != destination {
+			track := station.TrackFor(isOutbound)
+			if track == nil {
+				break
+			}
+			distance += track.DistanceMeters
+			station = track.End
+		}
+		if station.Name == destination {
+			return distance
+		}
+	}
+	return 0
+}
+
+// TripFare returns what a passenger paid for a trip.
+func (s *Simulation) TripFare(p *Passenger, trip Trip) float64 {
+	if s.FarePolicy == nil {
+		return 0
+	}
+
+	fare := s.FarePolicy.Fare(FareTrip{
+		Origin:         trip.Origin,
+		Destination:    trip.Destination,
+		DistanceMeters: s.DistanceBetween(trip.Origin, trip.Destination),
+		TimeOfDay:      (s.StartOfDay + trip.EnteredAt) % (24 * time.Hour),
+	})
+	if p.Concession != nil {
+		return p.Concession.Apply(fare)
+	}
+	return fare
+}
+
+// StationRevenue is the fare revenue from trips starting at a station.
+type StationRevenue struct {
+	Name    string
+	Trips   int
+	Revenue float64
+}
+
+// RevenueStats is the fare revenue from completed trips.
+type RevenueStats struct {
+	Trips             int
+	TotalRevenue      float64
+	RevenuePerTrip    float64
+	TrainKilometers   float64
+	RevenuePerTrainKm float64
+
+	ByStation []*StationRevenue
+}
+
+func (rs *RevenueStats) String() string {
+	output := fmt.Sprintf("Fare Revenue: %0.2f from %d trips (%0.2f per trip, %0.2f per train-km over %0.1f train-km)\n", rs.TotalRevenue, rs.Trips, rs.RevenuePerTrip, rs.RevenuePerTrainKm, rs.TrainKilometers)
+	for _, station := range rs.ByStation {
+		output += fmt.Sprintf("  %s - Trips: %d Revenue: %0.2f\n", station.Name, station.Trips, station.Revenue)
+	}
+	return output
+}
+
+func (s *Simulation) computeRevenueStats() *RevenueStats {
+	stats := &RevenueStats{}
+	byStation := map[string]*StationRevenue{}
+	for _, station := range s.Stations {
+		stationRevenue := &StationRevenue{Name: station.Name}
+		byStation[station.Name] = stationRevenue
+		stats.ByStation = append(stats.ByStation, stationRevenue)
+	}
+
+	for x := 0; x < s.People.Len(); x++ {
+		p := s.People.Dequeue()
+		for _, trip := range p.Trips {
+			fare := s.TripFare(p, trip)
+			stats.Trips++
+			stats.TotalRevenue += fare
+			if stationRevenue, hasStation := byStation[trip.Origin]; hasStation {
+				stationRevenue.Trips++
+				stationRevenue.Revenue += fare
+			}
+		}
+		s.People.Enqueue(p)
+	}
+
+	stats.TrainKilometers = s.TrainKilometers()
+
+	if stats.Trips > 0 {
+		stats.RevenuePerTrip = stats.TotalRevenue / float64(stats.Trips)
+	}
+	if stats.TrainKilometers > 0 {
+		stats.RevenuePerTrainKm = stats.TotalRevenue / stats.TrainKilometers
+	}
+
+	sort.SliceStable(stats.ByStation, func(i, j int) bool {
+		return stats.ByStation[i].Revenue > stats.ByStation[j].Revenue
+	})
+	return stats
+}
@@ -0,0 +1,121 @@
+package simulation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestFarePolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	trip := FareTrip{Origin: "A", Destination: "C", DistanceMeters: 4000, TimeOfDay: 8 * time.Hour}
+
+	assert.Equal(2.90, FlatFare{Amount: 2.90}.Fare(trip))
+	assert.InDelta(3.0, DistanceFare{BaseFare: 1.0, PerKilometer: 0.5}.Fare(trip), 0.0001)
+	assert.InDelta(2.5, DistanceFare{BaseFare: 1.0, PerKilometer: 0.5, MaximumFare: 2.5}.Fare(trip), 0.0001)
+
+	zones := ZoneFare{Zones: map[string]int{"A": 1, "B": 1, "C": 3}, BaseFare: 2.0, PerZoneFare: 0.75}
+	assert.InDelta(3.5, zones.Fare(trip), 0.0001)
+
+	peak := TimeOfDayFare{
+		Policy:            FlatFare{Amount: 2.0},
+		PeakPeriods:       []FarePeriod{{Start: 7 * time.Hour, End: 10 * time.Hour}},
+		PeakMultiplier:    1.5,
+		OffPeakMultiplier: 0.8,
+	}
+	assert.InDelta(3.0, peak.Fare(trip), 0.0001)
+	trip.TimeOfDay = 12 * time.Hour
+	assert.InDelta(1.6, peak.Fare(trip), 0.0001)
+}
+
+func TestSimulationDistanceBetween(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	assert.Equal(868.0, sim.DistanceBetween("Harlem-148 Street", "145 Street"))
+	assert.Equal(868.0+773.0, sim.DistanceBetween("135 Street", "Harlem-148 Street"))
+	assert.Zero(sim.DistanceBetween("135 Street", "135 Street"))
+}
+
+func TestSimulationTripFareConcession(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.FarePolicy = FlatFare{Amount: 3.0}
+
+	trip := Trip{Origin: "135 Street", Destination: "96 Street"}
+	assert.Equal(3.0, sim.TripFare(&Passenger{}, trip))
+	assert.Equal(1.5, sim.TripFare(&Passenger{Concession: &Concession{Name: "Reduced", Discount: 0.5}}, trip))
+}
+
+func TestSimulationRandomConcessionWithoutConcessions(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	assert.Empty(sim.Concessions)
+
+	draws := sim.source.draws
+	assert.Nil(sim.randomConcession())
+	assert.Equal(draws, sim.source.draws)
+
+	sim.Concessions = DefaultConcessions()
+	sim.randomConcession()
+	assert.Equal(draws+1, sim.source.draws)
+}
+
+func TestFareConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := TimeOfDayFare{
+		Policy:            DistanceFare{BaseFare: 1.5, PerKilometer: 0.2, MaximumFare: 4},
+		PeakPeriods:       []FarePeriod{{Start: 7 * time.Hour, End: 9 * time.Hour}},
+		PeakMultiplier:    1.25,
+		OffPeakMultiplier: 1,
+	}
+	config, err := NewFareConfig(&policy)
+	assert.Nil(err)
+	assert.Nil(config.Validate())
+	assert.Equal(policy, config.FarePolicy())
+
+	contents, err := json.Marshal(config)
+	assert.Nil(err)
+	decoded := &FareConfig{Flat: &FlatFare{Amount: 2.90}}
+	assert.Nil(json.Unmarshal(contents, decoded))
+	assert.Nil(decoded.Flat)
+	assert.Equal(policy, decoded.FarePolicy())
+
+	assert.NotNil(json.Unmarshal([]byte(`{"flat": {"amonut": 3}}`), decoded))
+	assert.NotNil((&FareConfig{}).Validate())
+	assert.NotNil((&FareConfig{Flat: &FlatFare{}, Zone: &ZoneFare{}}).Validate())
+	assert.NotNil((&FareConfig{TimeOfDay: &TimeOfDayFareConfig{}}).Validate())
+
+	config, err = NewFareConfig(nil)
+	assert.Nil(err)
+	assert.Nil(config.FarePolicy())
+}
+
+func TestConfigCarriesFares(t *testing.T) {
+	assert := assert.New(t)
+
+	scenario := testReplicationScenario()
+	assert.Equal(&FareConfig{Flat: &FlatFare{Amount: 2.90}}, scenario.Config.FarePolicy)
+	assert.Empty(scenario.Config.Concessions)
+
+	assert.Nil(SetConfigValue(&scenario.Config, "fare_policy", `{"zone": {"zones": {"96 Street": 1}, "base_fare": 2, "per_zone_fare": 0.5}}`))
+	assert.Nil(SetConfigValue(&scenario.Config, "concessions", `[{"name": "Student", "share": 0.2, "discount": 0.25}]`))
+	assert.Nil(scenario.Config.Validate())
+	sim := scenario.NewSimulation(1)
+	assert.Equal(ZoneFare{Zones: map[string]int{"96 Street": 1}, BaseFare: 2, PerZoneFare: 0.5}, sim.FarePolicy)
+	assert.Len(sim.Concessions, 1)
+	assert.Equal(scenario.Config.Concessions, sim.Config().Concessions)
+
+	scenario.Config.Concessions[0].Share = 1.5
+	assert.NotNil(scenario.Config.Validate())
+	scenario.Config.Concessions = nil
+	scenario.Config.FarePolicy = &FareConfig{}
+	assert.NotNil(scenario.Config.Validate())
+	scenario.Config.FarePolicy = nil
+	assert.Nil(scenario.Config.Validate())
+	assert.Nil(scenario.NewSimulation(1).FarePolicy)
+}
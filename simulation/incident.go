@@ -0,0 +1,81 @@
+package simulation
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Incident is a train held in a station by an incident.
+type Incident struct {
+	Station    string
+	TrainID    int
+	IsOutbound bool
+	Start      time.Duration
+	// End is zero while the incident is still holding the train.
+	End time.Duration
+}
+
+// IsActive returns if the incident is still holding the train.
+func (i Incident) IsActive() bool {
+	return i.End == 0
+}
+
+// Duration returns how long the train was held, or has been held so far.
+func (i Incident) Duration(wallClock time.Duration) time.Duration {
+	if i.IsActive() {
+		return wallClock - i.Start
+	}
+	return i.End - i.Start
+}
+
+// recordIncidentStart notes a new incident, unless the train is already held by one;
+// a second incident then just extends the first.
+func (s *Simulation) recordIncidentStart(station *Station, train *Train) {
+	if s.openIncident(train) != nil {
+		return
+	}
+	s.Incidents = append(s.Incidents, Incident{
+		Station:    station.Name,
+		TrainID:    train.ID,
+		IsOutbound: train.IsOutbound,
+		Start:      s.WallClock,
+	})
+}
+
+func (s *Simulation) recordIncidentEnd(train *Train) {
+	if incident := s.openIncident(train); incident != nil {
+		incident.End = s.WallClock
+	}
+}
+
+func (s *Simulation) openIncident(train *Train) *Incident {
+	for index := len(s.Incidents) - 1; index >= 0; index-- {
+		if s.Incidents[index].TrainID == train.ID && s.Incidents[index].IsActive() {
+			return &s.Incidents[index]
+		}
+	}
+	return nil
+}
+
+// HoldTrain holds a train by hand, at a platform or out on a track, until ReleaseTrain.
+// Only the stepped engine honours holds by hand.
+func (s *Simulation) HoldTrain(train *Train) {
+	if train.HeldByHand {
+		return
+	}
+	s.publishTrain(EventTrainHeld, slog.LevelWarn, train, nil, "[%d] held by hand", train.ID)
+	train.HeldByHand = true
+	train.SendSignal(SignalHold)
+}
+
+// ReleaseTrain lets a train held by hand go again; if an incident is holding it too, it waits for that to be resolved.
+func (s *Simulation) ReleaseTrain(train *Train) {
+	if !train.HeldByHand {
+		return
+	}
+	s.publishTrain(EventTrainHoldReleased, slog.LevelInfo, train, nil, "[%d] released by hand", train.ID)
+	train.HeldByHand = false
+	if s.openIncident(train) == nil {
+		train.SendSignal(SignalGo)
+	}
+}
@@ -0,0 +1,233 @@
+package simulation
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Invariants the InvariantChecker checks.
+const (
+	InvariantPassengerConservation = "passenger conservation"
+	InvariantTrainConservation     = "train conservation"
+	InvariantTrackOrder            = "track order"
+	InvariantCapacity              = "capacity"
+)
+
+// invariantDetailLimit is how many violations of one invariant a check describes before summarizing the rest.
+const invariantDetailLimit = 10
+
+// InvariantViolation is the simulation getting into a state it never should.
+type InvariantViolation struct {
+	WallClock time.Duration
+	Invariant string
+	Message   string
+}
+
+func (iv InvariantViolation) String() string {
+	return fmt.Sprintf("%v - %s: %s", iv.WallClock, iv.Invariant, iv.Message)
+}
+
+// NewInvariantChecker returns a checker keeping the first 100 violations.
+func NewInvariantChecker() *InvariantChecker {
+	return &InvariantChecker{
+		MaxViolations: 100,
+	}
+}
+
+// InvariantChecker checks the simulation after every step, as an observer: every passenger is
+// in exactly one place, every train is in exactly one place, no train has passed another on a
+// track, and no train is over capacity. It's slow, so it's for hunting bugs rather than every run.
+// Each violation is also published as an error event.
+type InvariantChecker struct {
+	// Violations are the violations found, in order, up to MaxViolations; zero keeps them all.
+	Violations    []InvariantViolation
+	MaxViolations int
+	// Found counts every violation, including those past MaxViolations.
+	Found int
+
+	// check numbers the checks, and seenAt and seenIn are, by passenger ID, the last check that
+	// saw each passenger and where, so the passenger check doesn't need a map of them all.
+	check  int32
+	seenAt []int32
+	seenIn []int32
+}
+
+// Observe checks the step that just finished.
+func (ic *InvariantChecker) Observe(s *Simulation) {
+	for _, violation := range ic.Check(s) {
+		ic.Found++
+		if ic.MaxViolations <= 0 || len(ic.Violations) < ic.MaxViolations {
+			ic.Violations = append(ic.Violations, violation)
+		}
+		s.Events.Publish(newEvent(s.WallClock, EventInvariantViolated, slog.LevelError, "%s: %s", violation.Invariant, violation.Message))
+	}
+}
+
+// Err returns an error describing the first violation found, or nil if there weren't any.
+func (ic *InvariantChecker) Err() error {
+	if ic.Found == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d invariant violations, the first at %v", ic.Found, ic.Violations[0])
+}
+
+// Check returns how the simulation's state breaks the invariants, if it does.
+func (ic *InvariantChecker) Check(s *Simulation) []InvariantViolation {
+	var violations []InvariantViolation
+	counts := map[string]int{}
+	violate := func(invariant, format string, args ...interface{}) {
+		counts[invariant]++
+		if counts[invariant] <= invariantDetailLimit {
+			violations = append(violations, InvariantViolation{WallClock: s.WallClock, Invariant: invariant, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	ic.checkPassengers(s, violate)
+	checkTrains(s, violate)
+
+	for _, invariant := range []string{InvariantPassengerConservation, InvariantTrainConservation, InvariantTrackOrder, InvariantCapacity} {
+		if count := counts[invariant]; count > invariantDetailLimit {
+			violations = append(violations, InvariantViolation{
+				WallClock: s.WallClock,
+				Invariant: invariant,
+				Message:   fmt.Sprintf("and %d more", count-invariantDetailLimit),
+			})
+		}
+	}
+	return violations
+}
+
+func (ic *InvariantChecker) checkPassengers(s *Simulation, violate func(invariant, format string, args ...interface{})) {
+	if len(ic.seenAt) != s.TotalPassengerCount+1 {
+		ic.seenAt = make([]int32, s.TotalPassengerCount+1)
+		ic.seenIn = make([]int32, s.TotalPassengerCount+1)
+		ic.check = 0
+	}
+	ic.check++
+
+	var places []string
+	visit := func(p *Passenger) {
+		place := places[len(places)-1]
+		if p.ID < 1 || p.ID > s.TotalPassengerCount {
+			violate(InvariantPassengerConservation, "passenger %d %s isn't one of the %d generated", p.ID, place, s.TotalPassengerCount)
+			return
+		}
+		if ic.seenAt[p.ID] == ic.check {
+			violate(InvariantPassengerConservation, "passenger %d is both %s and %s", p.ID, places[ic.seenIn[p.ID]], place)
+			return
+		}
+		ic.seenAt[p.ID] = ic.check
+		ic.seenIn[p.ID] = int32(len(places) - 1)
+	}
+	visitQueue := func(place string, queue *QueueOfPassenger) {
+		places = append(places, place)
+		for x := 0; x < queue.Len(); x++ {
+			p := queue.Dequeue()
+			visit(p)
+			queue.Enqueue(p)
+		}
+	}
+
+	if s.People != nil {
+		visitQueue("in the general population", s.People)
+	}
+	for _, station := range s.Stations {
+		visitQueue("waiting at "+station.Name, station.WaitingPassengers)
+		if station.Layout == nil {
+			continue
+		}
+		places = append(places, "walking in to "+station.Name)
+		for _, m := range station.Layout.Movements {
+			if !m.Egress {
+				visit(m.Passenger)
+			}
+		}
+		places = append(places, "walking out of "+station.Name)
+		for _, m := range station.Layout.Movements {
+			if m.Egress {
+				visit(m.Passenger)
+			}
+		}
+	}
+	for _, train := range s.AllTrains() {
+		places = append(places, fmt.Sprintf("on train [%d]", train.ID))
+		for _, p := range train.Passengers {
+			visit(p)
+		}
+	}
+
+	var missing []string
+	for id := 1; id <= s.TotalPassengerCount; id++ {
+		if ic.seenAt[id] != ic.check {
+			missing = append(missing, fmt.Sprint(id))
+		}
+	}
+	if len(missing) > 0 {
+		if len(missing) > invariantDetailLimit {
+			missing = append(missing[:invariantDetailLimit], "...")
+		}
+		violate(InvariantPassengerConservation, "missing from the general population, stations and trains: passengers %s", strings.Join(missing, ", "))
+	}
+}
+
+func checkTrains(s *Simulation, violate func(invariant, format string, args ...interface{})) {
+	places := map[*Train]string{}
+	ids := map[int]*Train{}
+	place := func(train *Train, where string) {
+		if other, ok := places[train]; ok {
+			violate(InvariantTrainConservation, "train [%d] is both %s and %s", train.ID, other, where)
+			return
+		}
+		if other, ok := ids[train.ID]; ok {
+			violate(InvariantTrainConservation, "two trains are numbered [%d], %s and %s", train.ID, places[other], where)
+		}
+		places[train] = where
+		ids[train.ID] = train
+
+		if len(train.Passengers) > train.Capacity {
+			violate(InvariantCapacity, "train [%d] %s has %d passengers, over its capacity of %d", train.ID, where, len(train.Passengers), train.Capacity)
+		}
+	}
+
+	if s.Yard != nil {
+		for _, train := range s.Yard.Values() {
+			place(train, "in the yard")
+		}
+	}
+	for _, station := range s.Stations {
+		if station.OutBoundTrain != nil {
+			place(station.OutBoundTrain, fmt.Sprintf("at %s's outbound platform", station.Name))
+		}
+		if station.InBoundTrain != nil {
+			place(station.InBoundTrain, fmt.Sprintf("at %s's inbound platform", station.Name))
+		}
+		for _, track := range []*Track{station.OutBoundTrack, station.InBoundTrack} {
+			if track == nil {
+				continue
+			}
+			for x, train := range track.Trains {
+				where := fmt.Sprintf("%0.2fm along the track from %s to %s", train.Position, track.Begin.Name, track.End.Name)
+				place(train, where)
+				if train.Position < 0 || train.Position > track.DistanceMeters {
+					violate(InvariantTrackOrder, "train [%d] is %s, which is %0.2fm long", train.ID, where, track.DistanceMeters)
+				}
+				if x > 0 && train.Position > track.Trains[x-1].Position {
+					ahead := track.Trains[x-1]
+					violate(InvariantTrackOrder, "train [%d] at %0.2fm has passed train [%d] at %0.2fm on the track from %s to %s",
+						train.ID, train.Position, ahead.ID, ahead.Position, track.Begin.Name, track.End.Name)
+				}
+			}
+		}
+	}
+
+	for id := 0; id < s.TotalTrainCount; id++ {
+		if _, ok := ids[id]; !ok {
+			violate(InvariantTrainConservation, "train [%d] isn't in the yard or anywhere on the line", id)
+		}
+	}
+	if len(places) > s.TotalTrainCount {
+		violate(InvariantTrainConservation, "there are %d trains, %d were generated", len(places), s.TotalTrainCount)
+	}
+}
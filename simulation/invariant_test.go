@@ -0,0 +1,87 @@
+package simulation
+
+import (
+	"fmt"
+	"testing"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func violationsOf(violations []InvariantViolation, invariant string) []InvariantViolation {
+	var matching []InvariantViolation
+	for _, violation := range violations {
+		if violation.Invariant == invariant {
+			matching = append(matching, violation)
+		}
+	}
+	return matching
+}
+
+func TestInvariantCheckerCleanRun(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, engine := range []string{EngineStepped, EngineEvent} {
+		scenario := testCheckpointScenario()
+		scenario.Config.Engine = engine
+		sim := scenario.NewSimulation(1)
+		checker := NewInvariantChecker()
+		checker.MaxViolations = 0
+		sim.Observers = append(sim.Observers, checker)
+		sim.Simulate()
+
+		assert.Empty(checker.Violations, engine)
+		assert.Zero(checker.Found, engine)
+		assert.Nil(checker.Err(), engine)
+	}
+}
+
+func TestInvariantCheckerPassengers(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := createTestSimulation()
+	checker := NewInvariantChecker()
+	assert.Empty(checker.Check(sim))
+
+	// one passenger copied onto a platform, another lost.
+	duplicate := sim.People.Dequeue()
+	sim.People.Enqueue(duplicate)
+	sim.Stations[3].WaitingPassengers.Enqueue(duplicate)
+	lost := sim.People.Dequeue()
+
+	violations := checker.Check(sim)
+	assert.Len(violations, 2)
+	assert.Len(violationsOf(violations, InvariantPassengerConservation), 2)
+	assert.Equal(fmt.Sprintf("passenger %d is both in the general population and waiting at 125 Street", duplicate.ID), violations[0].Message)
+	assert.Equal(fmt.Sprintf("missing from the general population, stations and trains: passengers %d", lost.ID), violations[1].Message)
+}
+
+func TestInvariantCheckerTrains(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := createTestSimulation()
+	checker := NewInvariantChecker()
+
+	// one train lost from the yard, two out on a track with the second ahead of the first,
+	// and over capacity.
+	sim.Yard.Dequeue()
+	first, second := sim.Yard.Dequeue(), sim.Yard.Dequeue()
+	track := sim.Stations[2].OutBoundTrack
+	track.AddTrain(first)
+	track.AddTrain(second)
+	first.Position, second.Position = 100, 150
+	second.Capacity = 2
+	for x := 0; x < 3; x++ {
+		second.Passengers = append(second.Passengers, sim.People.Dequeue())
+	}
+
+	violations := checker.Check(sim)
+	assert.Len(violations, 3)
+	assert.Equal("train [0] isn't in the yard or anywhere on the line", violationsOf(violations, InvariantTrainConservation)[0].Message)
+	assert.Equal("train [2] at 150.00m has passed train [1] at 100.00m on the track from 135 Street to 125 Street", violationsOf(violations, InvariantTrackOrder)[0].Message)
+	assert.Len(violationsOf(violations, InvariantCapacity), 1)
+
+	checker.Observe(sim)
+	assert.Equal(3, checker.Found)
+	assert.NotNil(checker.Err())
+	assert.Equal(EventInvariantViolated, sim.Events.Recent(1)[0].Kind)
+}
@@ -0,0 +1,390 @@
+package simulation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// JournalVersion is the version of the journal format NewJournal writes, and the only one NewReplay reads.
+const JournalVersion = 1
+
+// DefaultKeyframeInterval is how many steps apart a replay keeps the checkpoints it steps back from.
+const DefaultKeyframeInterval = 300
+
+const journalMagic = "train-sim journal"
+
+var errReplayExhausted = errors.New("the step drew more random values than the journal recorded")
+
+// JournalStep is everything that happened in one step of a journaled run.
+type JournalStep struct {
+	// WallClock is the clock at the end of the step.
+	WallClock time.Duration
+	// Draws are the random values drawn during the step, in the order they were drawn.
+	Draws []uint64
+	// Events are the events published during the step, at every level.
+	Events []Event
+	// Trains are the trains out on the line at the end of the step.
+	Trains []JournalTrain
+	// Unfinished is set when the run stopped part way through the step, e.g. on a panic.
+	Unfinished bool
+}
+
+// JournalTrain is a train's state at the end of a step.
+type JournalTrain struct {
+	ID int
+	// Station is set if the train is in a station, From and To if it's between stations.
+	Station    string
+	From       string
+	To         string
+	IsOutbound bool
+	Position   float64
+	Speed      float64
+	Signal     Signal
+	Passengers int
+}
+
+func journalTrains(s *Simulation) []JournalTrain {
+	var trains []JournalTrain
+	for _, location := range s.TrainLocations() {
+		train := JournalTrain{
+			ID:         location.Train.ID,
+			IsOutbound: location.Train.IsOutbound,
+			Position:   location.Train.Position,
+			Speed:      location.Train.Speed,
+			Signal:     location.Train.Signal,
+			Passengers: len(location.Train.Passengers),
+		}
+		if location.Station != nil {
+			train.Station = location.Station.Name
+		} else {
+			train.From = location.Track.Begin.Name
+			train.To = location.Track.End.Name
+		}
+		trains = append(trains, train)
+	}
+	return trains
+}
+
+type journalHeader struct {
+	Magic   string
+	Version int
+}
+
+// NewJournal starts journaling a generated stepped simulation to w: its state now, then every
+// random value drawn, event published and train movement, a step at a time, so NewReplay can
+// re-drive the run exactly. Close the journal once the run is done, or from a deferred call so
+// a run that panics still ends with the step that panicked.
+func NewJournal(w io.Writer, s *Simulation) (*Journal, error) {
+	if err := s.canCheckpoint(); err != nil {
+		return nil, err
+	}
+	if s.source.record != nil {
+		return nil, fmt.Errorf("the simulation is already being journaled")
+	}
+	cp, err := newCheckpoint(s)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		sim:        s,
+		compressed: gzip.NewWriter(w),
+	}
+	j.encoder = gob.NewEncoder(j.compressed)
+	if err := j.encoder.Encode(journalHeader{Magic: journalMagic, Version: JournalVersion}); err != nil {
+		return nil, err
+	}
+	if err := j.encoder.Encode(cp); err != nil {
+		return nil, err
+	}
+
+	s.source.record = j.draw
+	if s.Events != nil {
+		s.Events.Subscribe(EventFilter{MinimumLevel: slog.LevelDebug}, j.event)
+	}
+	s.Observers = append(s.Observers, j)
+	return j, nil
+}
+
+// Journal writes a run's journal as it goes; see NewJournal.
+type Journal struct {
+	sim        *Simulation
+	compressed *gzip.Writer
+	encoder    *gob.Encoder
+	pending    JournalStep
+	closed     bool
+	err        error
+
+	// Steps counts the steps written so far.
+	Steps int
+}
+
+func (j *Journal) draw(value uint64) {
+	j.pending.Draws = append(j.pending.Draws, value)
+}
+
+func (j *Journal) event(e Event) {
+	if !j.closed {
+		j.pending.Events = append(j.pending.Events, e)
+	}
+}
+
+// Observe writes the step that just finished.
+func (j *Journal) Observe(s *Simulation) {
+	if j.closed {
+		return
+	}
+	j.pending.WallClock = s.WallClock
+	j.pending.Trains = journalTrains(s)
+	j.write()
+}
+
+func (j *Journal) write() {
+	if j.err == nil {
+		j.err = j.encoder.Encode(j.pending)
+		j.Steps++
+	}
+	j.pending = JournalStep{}
+}
+
+// Close stops journaling and finishes the journal. If the run isn't finished, whatever it did
+// of the next step is written as an unfinished step.
+func (j *Journal) Close() error {
+	if j.closed {
+		return j.err
+	}
+	if !j.sim.IsFinished() {
+		j.pending.WallClock = j.sim.WallClock
+		j.pending.Unfinished = true
+		j.write()
+	}
+	j.closed = true
+	j.sim.source.record = nil
+	if err := j.compressed.Close(); j.err == nil {
+		j.err = err
+	}
+	return j.err
+}
+
+// NewReplay reads a journal written by NewJournal and returns a replay of it, at the start of the run.
+// A journal cut short, e.g. by a crash, replays as far as it goes.
+func NewReplay(r io.Reader) (*Replay, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %v", err)
+	}
+	decoder := gob.NewDecoder(compressed)
+	var header journalHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("reading journal: %v", err)
+	}
+	if header.Magic != journalMagic {
+		return nil, fmt.Errorf("not a journal")
+	}
+	if header.Version != JournalVersion {
+		return nil, fmt.Errorf("journal is version %d, only version %d can be read", header.Version, JournalVersion)
+	}
+	var cp checkpoint
+	if err := decoder.Decode(&cp); err != nil {
+		return nil, fmt.Errorf("reading journal: %v", err)
+	}
+
+	replay := &Replay{
+		KeyframeInterval: DefaultKeyframeInterval,
+		offsets:          []uint64{cp.Draws},
+		keyframes:        map[int][]byte{},
+	}
+	for {
+		var step JournalStep
+		if err := decoder.Decode(&step); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading journal step %d: %v", len(replay.steps), err)
+		}
+		replay.steps = append(replay.steps, step)
+		replay.values = append(replay.values, step.Draws...)
+		replay.offsets = append(replay.offsets, replay.offsets[len(replay.offsets)-1]+uint64(len(step.Draws)))
+	}
+
+	start := new(bytes.Buffer)
+	if err := cp.write(start); err != nil {
+		return nil, err
+	}
+	replay.keyframes[0] = start.Bytes()
+	if err := replay.load(0); err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+// Replay re-drives a journaled run with the random values from its journal, a step at a time in
+// either direction, checking each step against what the journal recorded.
+type Replay struct {
+	// KeyframeInterval is how many steps apart the replay keeps checkpoints to step back from.
+	KeyframeInterval int
+
+	steps     []JournalStep
+	values    []uint64
+	offsets   []uint64
+	keyframes map[int][]byte
+
+	sim       *Simulation
+	step      int
+	published []Event
+}
+
+// Simulation returns the replayed simulation as of the current step. Stepping back replaces it,
+// so get it again after moving.
+func (r *Replay) Simulation() *Simulation {
+	return r.sim
+}
+
+// Step returns how many steps have been replayed.
+func (r *Replay) Step() int {
+	return r.step
+}
+
+// Len returns how many steps the journal has.
+func (r *Replay) Len() int {
+	return len(r.steps)
+}
+
+// Recorded returns what the journal recorded for the given step.
+func (r *Replay) Recorded(step int) JournalStep {
+	return r.steps[step]
+}
+
+// Forward replays the next step. An error means the step panicked, e.g. a collision, or didn't
+// do what the journal recorded; either way the replay stays at the start of the step.
+func (r *Replay) Forward() (err error) {
+	if r.step >= len(r.steps) {
+		return fmt.Errorf("at the end of the journal")
+	}
+	if r.step%r.keyframeInterval() == 0 {
+		if _, ok := r.keyframes[r.step]; !ok {
+			keyframe := new(bytes.Buffer)
+			if err := r.sim.WriteCheckpoint(keyframe); err != nil {
+				return err
+			}
+			r.keyframes[r.step] = keyframe.Bytes()
+		}
+	}
+
+	step := r.step
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("step %d at %v: %v", step, r.sim.WallClock, p)
+		}
+		if err != nil {
+			if rewindErr := r.replayTo(step, true); rewindErr != nil {
+				err = rewindErr
+			}
+		}
+	}()
+	r.published = nil
+	r.sim.source.replayLimit = r.offsets[step+1]
+	r.sim.advance()
+	r.step++
+	return r.check(step)
+}
+
+// Back steps back to before the last step replayed.
+func (r *Replay) Back() error {
+	if r.step == 0 {
+		return fmt.Errorf("at the start of the journal")
+	}
+	return r.Seek(r.step - 1)
+}
+
+// Seek replays to just after the given number of steps.
+func (r *Replay) Seek(step int) error {
+	if step < 0 || step > len(r.steps) {
+		return fmt.Errorf("step %d is outside the journal's %d steps", step, len(r.steps))
+	}
+	return r.replayTo(step, false)
+}
+
+// replayTo replays to the given step from the nearest keyframe, or from where the replay is
+// if that's nearer and `reload` isn't set.
+func (r *Replay) replayTo(step int, reload bool) error {
+	keyframe := 0
+	for at := range r.keyframes {
+		if at <= step && at > keyframe {
+			keyframe = at
+		}
+	}
+	if reload || step < r.step || keyframe > r.step {
+		if err := r.load(keyframe); err != nil {
+			return err
+		}
+	}
+	for r.step < step {
+		if err := r.Forward(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Replay) keyframeInterval() int {
+	if r.KeyframeInterval > 0 {
+		return r.KeyframeInterval
+	}
+	return DefaultKeyframeInterval
+}
+
+func (r *Replay) load(step int) error {
+	sim, err := ReadCheckpoint(bytes.NewReader(r.keyframes[step]))
+	if err != nil {
+		return err
+	}
+	sim.source.replay = r.values
+	sim.source.replayFrom = r.offsets[0]
+	sim.source.replayLimit = r.offsets[step]
+	if sim.Events != nil {
+		sim.Events.Subscribe(EventFilter{MinimumLevel: slog.LevelDebug}, func(e Event) {
+			r.published = append(r.published, e)
+		})
+	}
+	r.sim = sim
+	r.step = step
+	return nil
+}
+
+// check returns how the step just replayed differs from the journal, if it does.
+func (r *Replay) check(step int) error {
+	recorded := r.steps[step]
+	diverged := func(format string, args ...interface{}) error {
+		return fmt.Errorf("step %d at %v diverged from the journal: %s", step, recorded.WallClock, fmt.Sprintf(format, args...))
+	}
+	if recorded.Unfinished {
+		return diverged("the recorded run stopped part way through the step, the replay didn't")
+	}
+	if r.sim.WallClock != recorded.WallClock {
+		return diverged("the clock is %v", r.sim.WallClock)
+	}
+	if drawn := r.sim.source.draws - r.offsets[step]; drawn != uint64(len(recorded.Draws)) {
+		return diverged("%d random values drawn of %d recorded", drawn, len(recorded.Draws))
+	}
+	for index := 0; index < len(r.published) || index < len(recorded.Events); index++ {
+		if index >= len(r.published) {
+			return diverged("missing event %q", recorded.Events[index].Message)
+		}
+		if index >= len(recorded.Events) || r.published[index] != recorded.Events[index] {
+			return diverged("unexpected event %q", r.published[index].Message)
+		}
+	}
+	trains := journalTrains(r.sim)
+	for index := 0; index < len(trains) || index < len(recorded.Trains); index++ {
+		if index >= len(trains) || index >= len(recorded.Trains) || trains[index] != recorded.Trains[index] {
+			return diverged("trains are %+v, recorded %+v", trains, recorded.Trains)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package simulation
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestReplayMatchesJournaledRun(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testCheckpointScenario().NewSimulation(1)
+	sim.Generate()
+	buffer := new(bytes.Buffer)
+	journal, err := NewJournal(buffer, sim)
+	assert.Nil(err)
+	stats := sim.Finish()
+	assert.Nil(journal.Close())
+
+	replay, err := NewReplay(buffer)
+	assert.Nil(err)
+	assert.Equal(journal.Steps, replay.Len())
+	for replay.Step() < replay.Len() {
+		if err := replay.Forward(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.True(replay.Simulation().IsFinished())
+	replayed := replay.Simulation().ComputeStats()
+	assert.Equal(stats.Revenue.Trips, replayed.Revenue.Trips)
+	for _, metric := range StatsMetrics() {
+		assert.Equal(metric.Value(stats), metric.Value(replayed), metric.Name)
+	}
+}
+
+func TestReplayStepsBack(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	buffer := new(bytes.Buffer)
+	journal, err := NewJournal(buffer, sim)
+	assert.Nil(err)
+	sim.RunUntil(2 * time.Hour)
+	assert.Nil(journal.Close())
+
+	replay, err := NewReplay(buffer)
+	assert.Nil(err)
+	replay.KeyframeInterval = 60
+	assert.NotNil(replay.Back())
+
+	assert.Nil(replay.Seek(5000))
+	clock := replay.Simulation().WallClock
+	trains := journalTrains(replay.Simulation())
+	assert.NotEmpty(trains)
+	for x := 0; x < 100; x++ {
+		assert.Nil(replay.Forward())
+	}
+	for x := 0; x < 100; x++ {
+		assert.Nil(replay.Back())
+	}
+	assert.Equal(5000, replay.Step())
+	assert.Equal(clock, replay.Simulation().WallClock)
+	assert.Equal(trains, journalTrains(replay.Simulation()))
+	assert.Equal(replay.Recorded(4999).Trains, trains)
+
+	// the run was stopped part way, so the last step was left unfinished and doesn't replay.
+	last := replay.Len() - 1
+	assert.True(replay.Recorded(last).Unfinished)
+	assert.Nil(replay.Seek(last))
+	assert.NotNil(replay.Forward())
+	assert.Equal(last, replay.Step())
+}
+
+func TestReplayDetectsDivergence(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	buffer := new(bytes.Buffer)
+	journal, err := NewJournal(buffer, sim)
+	assert.Nil(err)
+	sim.RunUntil(10 * time.Minute)
+	assert.Nil(journal.Close())
+
+	replay, err := NewReplay(buffer)
+	assert.Nil(err)
+	replay.steps[42].Events = append(replay.steps[42].Events, Event{Message: "never happened"})
+	assert.Nil(replay.Seek(42))
+	assert.NotNil(replay.Forward())
+	assert.Equal(42, replay.Step())
+}
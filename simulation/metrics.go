@@ -0,0 +1,194 @@
+package simulation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the Prometheus text exposition format metrics are written in.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// NewMetrics returns metrics for a simulation to keep up to date; add them to its Observers.
+func NewMetrics() *Metrics {
+	return &Metrics{now: time.Now}
+}
+
+// Metrics are gauges and counters about a run for Prometheus to scrape, taken after every step:
+// trains in service and in the yard, passengers waiting and boarded at each station, incidents,
+// the mean speed of the trains out and how much faster than real time the run is going.
+// They're safe to scrape while the run goes; a scrape sees them as of the last step.
+type Metrics struct {
+	// Labels are added to every metric, e.g. the run they're from.
+	Labels map[string]string
+
+	mu      sync.Mutex
+	latest  *metricsSnapshot
+	now     func() time.Time
+	started time.Time
+	startAt time.Duration
+}
+
+type metricsSnapshot struct {
+	simTime          time.Duration
+	steps            int
+	trainsInService  int
+	yard             int
+	stations         []string
+	waiting          []int
+	boardings        []int
+	deniedBoardings  []int
+	incidents        int
+	incidentsActive  int
+	meanSpeed        float64
+	simulatedPerReal float64
+}
+
+// metricFamily is a metric and its samples, one per set of labels.
+type metricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []metricSample
+}
+
+type metricSample struct {
+	// Labels are name, value pairs.
+	Labels []string
+	Value  float64
+}
+
+// Observe takes the metrics after a step.
+func (m *Metrics) Observe(s *Simulation) {
+	inService := s.TrainsInService()
+	snapshot := &metricsSnapshot{
+		simTime:         s.WallClock,
+		trainsInService: len(inService),
+		yard:            s.Yard.Len(),
+		incidents:       len(s.Incidents),
+		incidentsActive: s.ActiveIncidents(),
+	}
+	for _, station := range s.Stations {
+		snapshot.stations = append(snapshot.stations, station.Name)
+		snapshot.waiting = append(snapshot.waiting, station.WaitingPassengers.Len())
+		snapshot.boardings = append(snapshot.boardings, station.Boardings)
+		snapshot.deniedBoardings = append(snapshot.deniedBoardings, station.DeniedBoardings)
+	}
+	if len(inService) > 0 {
+		for _, train := range inService {
+			snapshot.meanSpeed += train.Speed
+		}
+		snapshot.meanSpeed /= float64(len(inService))
+	}
+
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.latest == nil {
+		m.started, m.startAt = now, s.WallClock
+	} else {
+		snapshot.steps = m.latest.steps
+	}
+	snapshot.steps++
+	if elapsed := now.Sub(m.started); elapsed > 0 {
+		snapshot.simulatedPerReal = (s.WallClock - m.startAt).Seconds() / elapsed.Seconds()
+	}
+	m.latest = snapshot
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", MetricsContentType)
+	writeMetricFamilies(w, m.families())
+}
+
+// families returns the metrics as of the last step, or none before the first.
+func (m *Metrics) families() []metricFamily {
+	m.mu.Lock()
+	snapshot := m.latest
+	m.mu.Unlock()
+	if snapshot == nil {
+		return nil
+	}
+
+	labels := make([]string, 0, 2*len(m.Labels))
+	names := make([]string, 0, len(m.Labels))
+	for name := range m.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		labels = append(labels, name, m.Labels[name])
+	}
+	single := func(value float64) []metricSample {
+		return []metricSample{{Labels: labels, Value: value}}
+	}
+	byStation := func(values []int) []metricSample {
+		samples := make([]metricSample, len(values))
+		for index, value := range values {
+			samples[index] = metricSample{Labels: append(labels[:len(labels):len(labels)], "station", snapshot.stations[index]), Value: float64(value)}
+		}
+		return samples
+	}
+
+	return []metricFamily{
+		{Name: "train_sim_sim_time_seconds", Help: "Simulated time since the start of the run.", Type: "gauge", Samples: single(snapshot.simTime.Seconds())},
+		{Name: "train_sim_steps_total", Help: "Steps taken.", Type: "counter", Samples: single(float64(snapshot.steps))},
+		{Name: "train_sim_sim_to_real_time_ratio", Help: "Simulated time run per unit of real time, since the metrics were first taken.", Type: "gauge", Samples: single(snapshot.simulatedPerReal)},
+		{Name: "train_sim_trains_in_service", Help: "Trains out on the line.", Type: "gauge", Samples: single(float64(snapshot.trainsInService))},
+		{Name: "train_sim_yard_trains", Help: "Trains in the yard.", Type: "gauge", Samples: single(float64(snapshot.yard))},
+		{Name: "train_sim_train_speed_mean_meters_per_second", Help: "Mean speed of the trains out on the line.", Type: "gauge", Samples: single(snapshot.meanSpeed)},
+		{Name: "train_sim_waiting_passengers", Help: "Passengers waiting on the platforms, by station.", Type: "gauge", Samples: byStation(snapshot.waiting)},
+		{Name: "train_sim_boardings_total", Help: "Passengers boarded, by station.", Type: "counter", Samples: byStation(snapshot.boardings)},
+		{Name: "train_sim_denied_boardings_total", Help: "Passengers left on the platform by a full train, by station.", Type: "counter", Samples: byStation(snapshot.deniedBoardings)},
+		{Name: "train_sim_incidents_total", Help: "Station incidents started.", Type: "counter", Samples: single(float64(snapshot.incidents))},
+		{Name: "train_sim_incidents_active", Help: "Station incidents still holding a train.", Type: "gauge", Samples: single(float64(snapshot.incidentsActive))},
+	}
+}
+
+// writeMetricFamilies writes metrics in the Prometheus text format, putting together the samples of
+// families of the same name, e.g. from several runs.
+func writeMetricFamilies(w io.Writer, families []metricFamily) error {
+	var order []string
+	merged := map[string]*metricFamily{}
+	for _, family := range families {
+		if existing, ok := merged[family.Name]; ok {
+			existing.Samples = append(existing.Samples, family.Samples...)
+			continue
+		}
+		family := family
+		merged[family.Name] = &family
+		order = append(order, family.Name)
+	}
+
+	for _, name := range order {
+		family := merged[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.Name, family.Help, family.Name, family.Type); err != nil {
+			return err
+		}
+		for _, sample := range family.Samples {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", family.Name, formatMetricLabels(sample.Labels), strconv.FormatFloat(sample.Value, 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatMetricLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for index := 0; index+1 < len(labels); index += 2 {
+		pairs = append(pairs, labels[index]+`="`+metricLabelEscaper.Replace(labels[index+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,91 @@
+package simulation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func scrapeMetrics(handler http.Handler, path string) (string, string) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder.Body.String(), recorder.Header().Get("Content-Type")
+}
+
+func TestMetricsFollowTheRun(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	metrics := NewMetrics()
+	metrics.Labels = map[string]string{"run": `a "quoted" run`}
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metrics.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	sim.Observers = append(sim.Observers, metrics)
+
+	body, contentType := scrapeMetrics(metrics, "/metrics")
+	assert.Empty(body)
+	assert.Equal(MetricsContentType, contentType)
+
+	sim.RunUntil(time.Hour)
+	body, _ = scrapeMetrics(metrics, "/metrics")
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	assert.Equal("# HELP train_sim_sim_time_seconds Simulated time since the start of the run.", lines[0])
+	assert.Equal("# TYPE train_sim_sim_time_seconds gauge", lines[1])
+	assert.Equal(`train_sim_sim_time_seconds{run="a \"quoted\" run"} 3600`, lines[2])
+	assert.True(strings.Contains(body, "# TYPE train_sim_boardings_total counter\n"))
+	assert.True(strings.Contains(body, `train_sim_trains_in_service{run="a \"quoted\" run"} `+strconv.Itoa(len(sim.TrainsInService()))+"\n"))
+	assert.True(strings.Contains(body, `train_sim_yard_trains{run="a \"quoted\" run"} `+strconv.Itoa(sim.Yard.Len())+"\n"))
+	for _, station := range sim.Stations {
+		labels := `{run="a \"quoted\" run",station="` + station.Name + `"}`
+		assert.True(strings.Contains(body, "train_sim_waiting_passengers"+labels+" "+strconv.Itoa(station.WaitingPassengers.Len())+"\n"), station.Name)
+		assert.True(strings.Contains(body, "train_sim_boardings_total"+labels+" "+strconv.Itoa(station.Boardings)+"\n"), station.Name)
+	}
+
+	// a second of real time passes with each step, as the clock is faked.
+	steps := int(time.Hour / sim.StepLength)
+	assert.True(strings.Contains(body, `train_sim_steps_total{run="a \"quoted\" run"} `+strconv.Itoa(steps)+"\n"))
+	ratio := (time.Hour - sim.StepLength).Seconds() / float64(steps-1)
+	assert.True(strings.Contains(body, `train_sim_sim_to_real_time_ratio{run="a \"quoted\" run"} `+strconv.FormatFloat(ratio, 'g', -1, 64)+"\n"))
+}
+
+func TestMetricsScrapeWhileRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	metrics := NewMetrics()
+	sim.Observers = append(sim.Observers, metrics)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for scraper := 0; scraper < 4; scraper++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					scrapeMetrics(metrics, "/metrics")
+				}
+			}
+		}()
+	}
+	sim.RunUntil(2 * time.Hour)
+	close(done)
+	wg.Wait()
+
+	body, _ := scrapeMetrics(metrics, "/metrics")
+	assert.True(strings.Contains(body, "train_sim_sim_time_seconds 7200\n"))
+}
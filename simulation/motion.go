@@ -0,0 +1,129 @@
+package simulation
+
+import (
+	"math"
+	"time"
+)
+
+// newMotionProfile returns the run of a train from a stand to a stand over `distance` meters,
+// accelerating and braking at constant rates and cruising at `maximumSpeed` if it gets there.
+func newMotionProfile(distance, maximumSpeed, acceleration, braking float64) motionProfile {
+	return newMotionProfileFrom(distance, 0, maximumSpeed, acceleration, braking)
+}
+
+// newMotionProfileFrom returns the run of a train already doing `speed` to a stand `distance`
+// meters on, e.g. when the signals ahead clear while it's slowing down for them.
+func newMotionProfileFrom(distance, speed, maximumSpeed, acceleration, braking float64) motionProfile {
+	profile := motionProfile{
+		Distance:     distance,
+		Start:        speed,
+		Peak:         math.Max(maximumSpeed, speed),
+		Acceleration: acceleration,
+		Braking:      braking,
+	}
+	if speed > 0 && speed*speed/(2*braking) >= distance {
+		// it can only just stop in time, so it brakes from here, as hard as it has to.
+		profile.Peak = speed
+		profile.Braking = speed * speed / (2 * math.Max(distance, 0.001))
+		return profile
+	}
+	if profile.accelerationDistance()+profile.brakingDistance() > distance {
+		// too short to reach full speed, so it starts braking as soon as it stops accelerating.
+		profile.Peak = math.Sqrt((2*distance*acceleration*braking + speed*speed*braking) / (acceleration + braking))
+	}
+	return profile
+}
+
+// motionProfile is the speed of a train over a run, in closed form, so the event
+// engine can tell where a train is without stepping it along.
+type motionProfile struct {
+	Distance float64
+	// Start is the speed at the start of the run.
+	Start        float64
+	Peak         float64
+	Acceleration float64
+	Braking      float64
+}
+
+func (mp motionProfile) accelerationDistance() float64 {
+	return (mp.Peak*mp.Peak - mp.Start*mp.Start) / (2 * mp.Acceleration)
+}
+
+func (mp motionProfile) accelerationSeconds() float64 {
+	return (mp.Peak - mp.Start) / mp.Acceleration
+}
+
+func (mp motionProfile) brakingDistance() float64 {
+	return mp.Peak * mp.Peak / (2 * mp.Braking)
+}
+
+func (mp motionProfile) cruiseDistance() float64 {
+	return math.Max(mp.Distance-mp.accelerationDistance()-mp.brakingDistance(), 0)
+}
+
+// Arrives returns if the train ever gets to the end of the run; one that can't accelerate, or
+// can't brake, never does.
+func (mp motionProfile) Arrives() bool {
+	return mp.Distance <= 0 || (mp.Peak > 0 && mp.Acceleration > 0 && mp.Braking > 0)
+}
+
+// Seconds returns how long the run takes, which is forever if it never arrives.
+func (mp motionProfile) Seconds() float64 {
+	if mp.Distance <= 0 {
+		return 0
+	}
+	if !mp.Arrives() {
+		return math.Inf(1)
+	}
+	return mp.accelerationSeconds() + mp.cruiseDistance()/mp.Peak + mp.Peak/mp.Braking
+}
+
+// Duration returns how long the run takes, or the longest duration there is if it never arrives.
+func (mp motionProfile) Duration() time.Duration {
+	if !mp.Arrives() {
+		return math.MaxInt64
+	}
+	return secondsToDuration(mp.Seconds())
+}
+
+// TimeAt returns how long after the start the train reaches `distance` meters along.
+func (mp motionProfile) TimeAt(distance float64) time.Duration {
+	if distance <= 0 {
+		return 0
+	}
+	if distance >= mp.Distance || !mp.Arrives() {
+		return mp.Duration()
+	}
+	if distance <= mp.accelerationDistance() {
+		return secondsToDuration((math.Sqrt(mp.Start*mp.Start+2*mp.Acceleration*distance) - mp.Start) / mp.Acceleration)
+	}
+	if distance <= mp.accelerationDistance()+mp.cruiseDistance() {
+		return secondsToDuration(mp.accelerationSeconds() + (distance-mp.accelerationDistance())/mp.Peak)
+	}
+	return secondsToDuration(mp.Seconds() - math.Sqrt(2*(mp.Distance-distance)/mp.Braking))
+}
+
+// At returns how far along the train is, and how fast it's going, `elapsed` after the start.
+func (mp motionProfile) At(elapsed time.Duration) (distance, speed float64) {
+	if !mp.Arrives() {
+		return 0, 0
+	}
+	t := elapsed.Seconds()
+	total := mp.Seconds()
+	if t <= 0 && total > 0 {
+		return 0, mp.Start
+	}
+	if t >= total {
+		return mp.Distance, 0
+	}
+	accelerating := mp.accelerationSeconds()
+	if t <= accelerating {
+		return mp.Start*t + mp.Acceleration*t*t/2, mp.Start + mp.Acceleration*t
+	}
+	cruising := mp.cruiseDistance() / mp.Peak
+	if t <= accelerating+cruising {
+		return mp.accelerationDistance() + mp.Peak*(t-accelerating), mp.Peak
+	}
+	remaining := total - t
+	return mp.Distance - mp.Braking*remaining*remaining/2, mp.Braking * remaining
+}
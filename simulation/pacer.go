@@ -0,0 +1,85 @@
+package simulation
+
+import (
+	"fmt"
+	"time"
+)
+
+// pacerFrame is how often the interactive views run the steps they owe and redraw.
+const pacerFrame = 50 * time.Millisecond
+
+// pacerSpeeds are the speeds the interactive views run at, in steps per second of real time;
+// zero runs as many steps as fit in a frame.
+var pacerSpeeds = []int{1, 2, 5, 10, 30, 60, 300, 1800, 0}
+
+func newPacer(s *Simulation) pacer {
+	return pacer{sim: s, speed: 3}
+}
+
+// pacer runs a stepped simulation in real time for the interactive views, the terminal UI and
+// the web viewer: paused, a step at a time, or at one of pacerSpeeds.
+type pacer struct {
+	sim      *Simulation
+	paused   bool
+	finished bool
+	// speed indexes pacerSpeeds.
+	speed int
+	owed  float64
+}
+
+// runFor runs the steps owed for the real time elapsed at the current speed, returning true
+// if they finished the run.
+func (p *pacer) runFor(elapsed time.Duration) bool {
+	if p.paused || p.finished {
+		p.owed = 0
+		return false
+	}
+	speed := pacerSpeeds[p.speed]
+	if speed == 0 {
+		deadline := time.Now().Add(pacerFrame)
+		for !p.finished && time.Now().Before(deadline) {
+			p.step()
+		}
+		return p.finished
+	}
+	// if steps take longer than the speed allows, don't let what's owed pile up.
+	p.owed += float64(speed) * elapsed.Seconds()
+	if p.owed > float64(speed) {
+		p.owed = float64(speed)
+	}
+	for ; p.owed >= 1 && !p.finished; p.owed-- {
+		p.step()
+	}
+	return p.finished
+}
+
+// step runs one step, returning true if it finished the run; once the run's over it does nothing.
+func (p *pacer) step() bool {
+	if p.finished {
+		return false
+	}
+	if p.sim.advance() {
+		p.finished, p.paused = true, true
+		return true
+	}
+	return false
+}
+
+func (p *pacer) faster() {
+	if p.speed < len(pacerSpeeds)-1 {
+		p.speed++
+	}
+}
+
+func (p *pacer) slower() {
+	if p.speed > 0 {
+		p.speed--
+	}
+}
+
+func (p *pacer) speedLabel() string {
+	if steps := pacerSpeeds[p.speed]; steps > 0 {
+		return fmt.Sprintf("%d steps/s", steps)
+	}
+	return "as fast as it can"
+}
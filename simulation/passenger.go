@@ -59,6 +59,33 @@ func randomLastName(randomProvider *rand.Rand) string {
 	return lastNames[index]
 }
 
+const (
+	MobilityNone       MobilityNeed = 0
+	MobilityWheelchair MobilityNeed = 1
+	MobilityStroller   MobilityNeed = 2
+)
+
+// MobilityNeed is what, if anything, a passenger needs to get around without stairs.
+type MobilityNeed int
+
+func (mn MobilityNeed) String() string {
+	switch mn {
+	case MobilityNone:
+		{
+			return "None"
+		}
+	case MobilityWheelchair:
+		{
+			return "Wheelchair"
+		}
+	case MobilityStroller:
+		{
+			return "Stroller"
+		}
+	}
+	return "?"
+}
+
 func NewPassenger(provider *rand.Rand, id int) *Passenger {
 	return &Passenger{
 		ID:        id,
@@ -72,14 +99,71 @@ type Passenger struct {
 	FirstName string
 	LastName  string
 
+	EnteredStation time.Duration
 	StartedWaiting time.Duration
 	StartedRiding  time.Duration
 
 	IsOutBound  bool
+	Origin      string
 	Destination string
 
+	Mobility MobilityNeed
+	Reroutes int
+	Stranded int
+
+	Segment       *Segment
+	ChosenService string
+	Abandoned     int
+
+	Concession *Concession
+
 	Waiting  []time.Duration
 	InMotion []time.Duration
+	Journeys []time.Duration
+
+	GeneralizedCosts []float64
+
+	Trips []Trip
+}
+
+// Trip is a completed journey from one station to another.
+type Trip struct {
+	Origin      string
+	Destination string
+	EnteredAt   time.Duration
+	ExitedAt    time.Duration
+
+	Waiting  time.Duration
+	InMotion time.Duration
+}
+
+// WalkingPace returns how much longer than typical the passenger takes to walk somewhere.
+func (p *Passenger) WalkingPace() float64 {
+	if p.Segment == nil || p.Segment.WalkingSpeed <= 0 {
+		return 1.0
+	}
+	return 1.0 / p.Segment.WalkingSpeed
+}
+
+// WillBoard returns if the passenger will get on the given train, assuming it's heading their way.
+func (p *Passenger) WillBoard(train *Train) bool {
+	if !train.ServesStation(p.Destination) {
+		return false
+	}
+	if len(p.ChosenService) > 0 && train.Service != nil {
+		return train.Service.Name == p.ChosenService
+	}
+	return true
+}
+
+// NeedsStepFree returns if the passenger can only use elevators to get to and from the platform.
+func (p *Passenger) NeedsStepFree() bool {
+	return p.Mobility != MobilityNone
+}
+
+func (p *Passenger) Entering(wallClock time.Duration, origin *Station) {
+	p.EnteredStation = wallClock
+	p.Origin = origin.Name
 }
 
 func (p *Passenger) Boarding(wallClock time.Duration, train *Train) {
@@ -93,6 +177,51 @@ func (p *Passenger) Disembarking(wallClock time.Duration, train *Train) {
 	p.StartedRiding = 0
 }
 
+func (p *Passenger) Exiting(wallClock time.Duration) {
+	journey := wallClock - p.EnteredStation
+	waiting := lastDuration(p.Waiting)
+	inMotion := lastDuration(p.InMotion)
+	p.Journeys = append(p.Journeys, journey)
+	p.Trips = append(p.Trips, Trip{
+		Origin:      p.Origin,
+		Destination: p.Destination,
+		EnteredAt:   p.EnteredStation,
+		ExitedAt:    wallClock,
+		Waiting:     waiting,
+		InMotion:    inMotion,
+	})
+	p.EnteredStation = 0
+
+	if p.Segment != nil {
+		walking := journey - waiting - inMotion
+		if walking < 0 {
+			walking = 0
+		}
+		p.GeneralizedCosts = append(p.GeneralizedCosts, p.Segment.GeneralizedCost(waiting, inMotion, walking))
+	}
+}
+
+// GivingUp is called when the passenger stops waiting for a train and leaves.
+func (p *Passenger) GivingUp(wallClock time.Duration) {
+	p.Abandoned++
+	p.StartedWaiting = 0
+	p.EnteredStation = 0
+}
+
+// Stranding is called when a step-free passenger is set down at a station they can't get out of,
+// with no step-free station left ahead. Their trip isn't finished, so it isn't recorded or charged.
+func (p *Passenger) Stranding(wallClock time.Duration) {
+	p.Stranded++
+	p.EnteredStation = 0
+}
+
+func lastDuration(values []time.Duration) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	return values[len(values)-1]
+}
+
 func (p *Passenger) String() string {
 	return fmt.Sprintf("%s %s", p.FirstName, p.LastName)
 }
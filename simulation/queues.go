@@ -50,6 +50,17 @@ func (q *QueueOfTrain) Len() int {
 	return q.innerQueue.Length()
 }
 
+// Values returns the trains in the queue, front first, leaving the queue as it was.
+func (q *QueueOfTrain) Values() []*Train {
+	values := make([]*Train, 0, q.Len())
+	for x := 0; x < q.Len(); x++ {
+		t := q.Dequeue()
+		values = append(values, t)
+		q.Enqueue(t)
+	}
+	return values
+}
+
 func NewQueueOfPassenger() *QueueOfPassenger {
 	return &QueueOfPassenger{
 		innerQueue: collections.NewQueue(),
@@ -97,3 +108,14 @@ func (q *QueueOfPassenger) Dequeue() *Passenger {
 func (q *QueueOfPassenger) Len() int {
 	return q.innerQueue.Length()
 }
+
+// Values returns the passengers in the queue, front first, leaving the queue as it was.
+func (q *QueueOfPassenger) Values() []*Passenger {
+	values := make([]*Passenger, 0, q.Len())
+	for x := 0; x < q.Len(); x++ {
+		p := q.Dequeue()
+		values = append(values, p)
+		q.Enqueue(p)
+	}
+	return values
+}
@@ -0,0 +1,254 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// RecorderSchema identifies the layout of time-series files, bumped whenever it changes.
+//
+// Both formats are "long": one row per sample of one series for one entity.
+//
+//	time_s  seconds of simulated time since the start of the run
+//	series  one of the Series* names below
+//	entity  the station name for "waiting", the train ID for "load" and "speed", empty otherwise
+//	value   the sampled value
+//
+// CSV files start with "#" comment lines holding the schema and the run config as JSON,
+// then a "time_s,series,entity,value" header row. JSONL files start with a
+// {"type":"header","schema":...,"config":...} line, then one
+// {"type":"sample","time_s":...,"series":...,"entity":...,"value":...} line per sample.
+const RecorderSchema = "train-sim/timeseries/v1"
+
+// Series recorded by a Recorder.
+const (
+	SeriesTrainsInService = "trains_in_service"
+	SeriesYard            = "yard"
+	SeriesWaiting         = "waiting"
+	SeriesLoad            = "load"
+	SeriesSpeed           = "speed"
+	SeriesIncidentsActive = "incidents_active"
+)
+
+// AllSeries returns every series a Recorder can sample.
+func AllSeries() []string {
+	return []string{SeriesTrainsInService, SeriesYard, SeriesWaiting, SeriesLoad, SeriesSpeed, SeriesIncidentsActive}
+}
+
+// RecorderFormat is the file format a recorder writes.
+type RecorderFormat string
+
+const (
+	RecorderFormatCSV   RecorderFormat = "csv"
+	RecorderFormatJSONL RecorderFormat = "jsonl"
+)
+
+// Validate returns an error if the format isn't one a recorder can write.
+func (rf RecorderFormat) Validate() error {
+	if rf != RecorderFormatCSV && rf != RecorderFormatJSONL {
+		return fmt.Errorf("unknown recorder format: %q, use csv or jsonl", string(rf))
+	}
+	return nil
+}
+
+// StepObserver is told about every step of the simulation, after it has happened.
+type StepObserver interface {
+	Observe(s *Simulation)
+}
+
+// IntervalObserver is a StepObserver that only needs to see the simulation every so often,
+// so the event engine, which has no steps of its own, needn't show it every StepLength.
+type IntervalObserver interface {
+	StepObserver
+	ObserveInterval() time.Duration
+}
+
+// NewRecorder returns a recorder writing every series to `w` every `interval` of simulated time.
+func NewRecorder(w io.Writer, format RecorderFormat, interval time.Duration) (*Recorder, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		Writer:   w,
+		Format:   format,
+		Interval: interval,
+		Series:   AllSeries(),
+	}, nil
+}
+
+// Recorder samples time-series from the simulation at a fixed interval and writes them out.
+type Recorder struct {
+	Writer   io.Writer
+	Format   RecorderFormat
+	Interval time.Duration
+	Series   []string
+
+	csvWriter     *csv.Writer
+	wroteHeader   bool
+	hasSampled    bool
+	lastSampledAt time.Duration
+	err           error
+}
+
+// Sample is one value of one series at one time.
+type Sample struct {
+	Time   time.Duration
+	Series string
+	Entity string
+	Value  float64
+}
+
+type jsonlHeader struct {
+	Type   string   `json:"type"`
+	Schema string   `json:"schema"`
+	Series []string `json:"series"`
+	Config Config   `json:"config"`
+}
+
+type jsonlSample struct {
+	Type   string  `json:"type"`
+	TimeS  float64 `json:"time_s"`
+	Series string  `json:"series"`
+	Entity string  `json:"entity"`
+	Value  float64 `json:"value"`
+}
+
+// ObserveInterval returns how often the recorder samples.
+func (r *Recorder) ObserveInterval() time.Duration {
+	return r.Interval
+}
+
+// Observe samples the simulation if an interval has passed since the last sample.
+func (r *Recorder) Observe(s *Simulation) {
+	if r.err != nil {
+		return
+	}
+	if !r.wroteHeader {
+		r.err = r.writeHeader(s.Config())
+		r.wroteHeader = true
+	}
+	if r.hasSampled && s.WallClock-r.lastSampledAt < r.Interval {
+		return
+	}
+	r.hasSampled = true
+	r.lastSampledAt = s.WallClock
+
+	for _, sample := range r.Sample(s) {
+		if r.err = r.writeSample(sample); r.err != nil {
+			return
+		}
+	}
+}
+
+// Sample returns the current value of every series the recorder is configured for.
+func (r *Recorder) Sample(s *Simulation) []Sample {
+	var samples []Sample
+	add := func(series, entity string, value float64) {
+		samples = append(samples, Sample{Time: s.WallClock, Series: series, Entity: entity, Value: value})
+	}
+
+	inService := s.TrainsInService()
+	for _, series := range r.Series {
+		switch series {
+		case SeriesTrainsInService:
+			{
+				add(series, "", float64(len(inService)))
+			}
+		case SeriesYard:
+			{
+				add(series, "", float64(s.Yard.Len()))
+			}
+		case SeriesWaiting:
+			{
+				for _, station := range s.Stations {
+					add(series, station.Name, float64(station.WaitingPassengers.Len()))
+				}
+			}
+		case SeriesLoad:
+			{
+				for _, train := range inService {
+					add(series, strconv.Itoa(train.ID), float64(len(train.Passengers)))
+				}
+			}
+		case SeriesSpeed:
+			{
+				for _, train := range inService {
+					add(series, strconv.Itoa(train.ID), train.Speed)
+				}
+			}
+		case SeriesIncidentsActive:
+			{
+				add(series, "", float64(s.ActiveIncidents()))
+			}
+		}
+	}
+	return samples
+}
+
+// Close flushes anything buffered and returns the first error the recorder hit.
+func (r *Recorder) Close() error {
+	if r.csvWriter != nil {
+		r.csvWriter.Flush()
+		if r.err == nil {
+			r.err = r.csvWriter.Error()
+		}
+	}
+	return r.err
+}
+
+func (r *Recorder) writeHeader(config Config) error {
+	switch r.Format {
+	case RecorderFormatCSV:
+		{
+			configJSON, err := json.Marshal(config)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(r.Writer, "# schema: %s\n# config: %s\n", RecorderSchema, configJSON); err != nil {
+				return err
+			}
+			r.csvWriter = csv.NewWriter(r.Writer)
+			return r.csvWriter.Write([]string{"time_s", "series", "entity", "value"})
+		}
+	case RecorderFormatJSONL:
+		{
+			return json.NewEncoder(r.Writer).Encode(jsonlHeader{Type: "header", Schema: RecorderSchema, Series: r.Series, Config: config})
+		}
+	}
+	return fmt.Errorf("unknown recorder format: %q", r.Format)
+}
+
+func (r *Recorder) writeSample(sample Sample) error {
+	if r.Format == RecorderFormatCSV {
+		return r.csvWriter.Write([]string{
+			strconv.FormatFloat(sample.Time.Seconds(), 'f', -1, 64),
+			sample.Series,
+			sample.Entity,
+			strconv.FormatFloat(sample.Value, 'f', -1, 64),
+		})
+	}
+	return json.NewEncoder(r.Writer).Encode(jsonlSample{
+		Type:   "sample",
+		TimeS:  sample.Time.Seconds(),
+		Series: sample.Series,
+		Entity: sample.Entity,
+		Value:  sample.Value,
+	})
+}
+
+// ActiveIncidents returns how many trains are being held in stations by an incident.
+func (s *Simulation) ActiveIncidents() int {
+	var count int
+	for _, station := range s.Stations {
+		for _, train := range []*Train{station.OutBoundTrain, station.InBoundTrain} {
+			if train != nil && train.Signal == SignalHold {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,80 @@
+package simulation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestRecorderCSV(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.SetSeed(7)
+
+	buffer := bytes.NewBuffer(nil)
+	recorder, err := NewRecorder(buffer, RecorderFormatCSV, 10*time.Second)
+	assert.Nil(err)
+	recorder.Series = []string{SeriesTrainsInService, SeriesYard}
+	sim.Observers = append(sim.Observers, recorder)
+
+	for x := 0; x < 30; x++ {
+		sim.Step()
+	}
+	assert.Nil(recorder.Close())
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Equal("# schema: "+RecorderSchema, lines[0])
+	assert.True(strings.HasPrefix(lines[1], "# config: {\"seed\":7,"), lines[1])
+	assert.Equal("time_s,series,entity,value", lines[2])
+	// samples at 1s, 11s and 21s, two series each.
+	assert.Len(lines, 3+6)
+	assert.Equal("1,trains_in_service,,0", lines[3])
+	assert.Equal("1,yard,,32", lines[4])
+	assert.True(strings.HasPrefix(lines[5], "11,"), lines[5])
+}
+
+func TestRecorderJSONL(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	buffer := bytes.NewBuffer(nil)
+	recorder, err := NewRecorder(buffer, RecorderFormatJSONL, time.Minute)
+	assert.Nil(err)
+	sim.Observers = append(sim.Observers, recorder)
+	sim.Step()
+	assert.Nil(recorder.Close())
+
+	scanner := bufio.NewScanner(buffer)
+	assert.True(scanner.Scan())
+	var header jsonlHeader
+	assert.Nil(json.Unmarshal(scanner.Bytes(), &header))
+	assert.Equal("header", header.Type)
+	assert.Equal(RecorderSchema, header.Schema)
+	assert.Equal(sim.Seed, header.Config.Seed)
+
+	waiting := 0
+	for scanner.Scan() {
+		var sample jsonlSample
+		assert.Nil(json.Unmarshal(scanner.Bytes(), &sample))
+		assert.Equal("sample", sample.Type)
+		if sample.Series == SeriesWaiting {
+			waiting++
+		}
+	}
+	assert.Equal(len(sim.Stations), waiting)
+}
+
+func TestNewRecorderUnknownFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder, err := NewRecorder(bytes.NewBuffer(nil), RecorderFormat("xml"), time.Minute)
+	assert.Nil(recorder)
+	assert.NotNil(err)
+	assert.Nil(RecorderFormatCSV.Validate())
+	assert.Nil(RecorderFormatJSONL.Validate())
+}
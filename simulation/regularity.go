@@ -0,0 +1,179 @@
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"text/tabwriter"
+	"time"
+)
+
+// HeadwayRegularity is how evenly spaced trains were leaving one station in one direction.
+type HeadwayRegularity struct {
+	Station    string
+	IsOutbound bool
+	// StopsFromTerminus is how far along the line the station is in the direction of travel.
+	StopsFromTerminus int
+
+	Headways         int
+	ScheduledHeadway time.Duration
+	MeanHeadway      time.Duration
+	StdDevHeadway    time.Duration
+	// CoefficientOfVariation is the standard deviation of the headways over their mean; 0 is perfectly regular.
+	CoefficientOfVariation float64
+
+	// ExcessWaitTime is how much longer a passenger turning up at random waits than they would
+	// if trains ran exactly at the scheduled headway.
+	ExcessWaitTime time.Duration
+
+	// BunchedPairs counts trains that left less than the bunching threshold after the one in front.
+	BunchedPairs int
+}
+
+// AnalyzeHeadways returns the regularity of a set of headways against the scheduled headway.
+func AnalyzeHeadways(headways []time.Duration, scheduledHeadway, bunchingThreshold time.Duration) *HeadwayRegularity {
+	regularity := &HeadwayRegularity{
+		Headways:         len(headways),
+		ScheduledHeadway: scheduledHeadway,
+	}
+	if len(headways) == 0 {
+		return regularity
+	}
+
+	var sum, sumOfSquares float64
+	for _, headway := range headways {
+		seconds := headway.Seconds()
+		sum += seconds
+		sumOfSquares += seconds * seconds
+		if headway < bunchingThreshold {
+			regularity.BunchedPairs++
+		}
+	}
+
+	count := float64(len(headways))
+	mean := sum / count
+	variance := math.Max(sumOfSquares/count-mean*mean, 0)
+	regularity.MeanHeadway = secondsToDuration(mean)
+	regularity.StdDevHeadway = secondsToDuration(math.Sqrt(variance))
+	if mean > 0 {
+		regularity.CoefficientOfVariation = math.Sqrt(variance) / mean
+		// a random arrival waits E[h²] / 2E[h] on average, against half the headway if it's kept exactly.
+		actualWait := sumOfSquares / (2.0 * sum)
+		regularity.ExcessWaitTime = secondsToDuration(actualWait - scheduledHeadway.Seconds()/2.0)
+	}
+	return regularity
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RegularityStats are the headway regularity along the line, in each direction.
+type RegularityStats struct {
+	ScheduledHeadway  time.Duration
+	BunchingThreshold time.Duration
+
+	// Outbound and Inbound are in the order trains reach the stations.
+	Outbound []*HeadwayRegularity
+	Inbound  []*HeadwayRegularity
+
+	// OutboundDegradation and InboundDegradation are the fitted change in the coefficient
+	// of variation per stop travelled from the terminus.
+	OutboundDegradation float64
+	InboundDegradation  float64
+
+	BunchedPairs int
+}
+
+func (rs *RegularityStats) String() string {
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, "Headway Regularity (scheduled %v, bunched under %v): %d bunched pairs\n", rs.ScheduledHeadway, rs.BunchingThreshold, rs.BunchedPairs)
+	fmt.Fprintf(buffer, "CV change per stop: outbound %+0.3f inbound %+0.3f\n", rs.OutboundDegradation, rs.InboundDegradation)
+
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Station\tDirection\tStop\tHeadways\tMean\tStd Dev\tCV\tExcess Wait\tBunched")
+	for _, direction := range [][]*HeadwayRegularity{rs.Outbound, rs.Inbound} {
+		for _, regularity := range direction {
+			name := "Inbound"
+			if regularity.IsOutbound {
+				name = "Outbound"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%v\t%v\t%0.2f\t%v\t%d\n",
+				regularity.Station, name, regularity.StopsFromTerminus, regularity.Headways,
+				regularity.MeanHeadway.Round(time.Second), regularity.StdDevHeadway.Round(time.Second),
+				regularity.CoefficientOfVariation, regularity.ExcessWaitTime.Round(time.Second), regularity.BunchedPairs,
+			)
+		}
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+// EffectiveBunchingThreshold returns the BunchingThreshold, or half the scheduled headway if it isn't set.
+func (s *Simulation) EffectiveBunchingThreshold() time.Duration {
+	if s.BunchingThreshold > 0 {
+		return s.BunchingThreshold
+	}
+	return s.AverageTimeBetweenTrains / 2
+}
+
+func (s *Simulation) computeRegularityStats() *RegularityStats {
+	stats := &RegularityStats{
+		ScheduledHeadway:  s.AverageTimeBetweenTrains,
+		BunchingThreshold: s.EffectiveBunchingThreshold(),
+	}
+
+	for index, station := range s.Stations {
+		regularity := s.stationRegularity(station, true, index)
+		if regularity.Headways > 0 {
+			stats.Outbound = append(stats.Outbound, regularity)
+		}
+	}
+	for index := len(s.Stations) - 1; index >= 0; index-- {
+		regularity := s.stationRegularity(s.Stations[index], false, len(s.Stations)-1-index)
+		if regularity.Headways > 0 {
+			stats.Inbound = append(stats.Inbound, regularity)
+		}
+	}
+
+	for _, direction := range [][]*HeadwayRegularity{stats.Outbound, stats.Inbound} {
+		for _, regularity := range direction {
+			stats.BunchedPairs += regularity.BunchedPairs
+		}
+	}
+	stats.OutboundDegradation = regularityTrend(stats.Outbound)
+	stats.InboundDegradation = regularityTrend(stats.Inbound)
+	return stats
+}
+
+func (s *Simulation) stationRegularity(station *Station, isOutbound bool, stopsFromTerminus int) *HeadwayRegularity {
+	headways := station.Headways(isOutbound, s.StasisAt)
+	regularity := AnalyzeHeadways(headways, s.AverageTimeBetweenTrains, s.EffectiveBunchingThreshold())
+	regularity.Station = station.Name
+	regularity.IsOutbound = isOutbound
+	regularity.StopsFromTerminus = stopsFromTerminus
+	return regularity
+}
+
+// regularityTrend is the least squares slope of the coefficient of variation against stops from the terminus.
+func regularityTrend(stations []*HeadwayRegularity) float64 {
+	if len(stations) < 2 {
+		return 0
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for _, regularity := range stations {
+		x := float64(regularity.StopsFromTerminus)
+		y := regularity.CoefficientOfVariation
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	count := float64(len(stations))
+	denominator := count*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (count*sumXY - sumX*sumY) / denominator
+}
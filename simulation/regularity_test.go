@@ -0,0 +1,62 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestAnalyzeHeadwaysRegular(t *testing.T) {
+	assert := assert.New(t)
+
+	headways := []time.Duration{2 * time.Minute, 2 * time.Minute, 2 * time.Minute}
+	regularity := AnalyzeHeadways(headways, 2*time.Minute, time.Minute)
+	assert.Equal(3, regularity.Headways)
+	assert.Equal(2*time.Minute, regularity.MeanHeadway)
+	assert.InDelta(0, regularity.CoefficientOfVariation, 0.0001)
+	assert.InDelta(0, regularity.ExcessWaitTime.Seconds(), 0.001)
+	assert.Zero(regularity.BunchedPairs)
+}
+
+func TestAnalyzeHeadwaysBunched(t *testing.T) {
+	assert := assert.New(t)
+
+	// pairs of trains 30s apart every 4 minutes, against a 2 minute schedule.
+	headways := []time.Duration{30 * time.Second, 210 * time.Second, 30 * time.Second, 210 * time.Second}
+	regularity := AnalyzeHeadways(headways, 2*time.Minute, time.Minute)
+	assert.Equal(2*time.Minute, regularity.MeanHeadway)
+	assert.Equal(90*time.Second, regularity.StdDevHeadway)
+	assert.InDelta(0.75, regularity.CoefficientOfVariation, 0.0001)
+	// (30² + 210²) / (2 * 240) = 93.75s actual wait, against 60s scheduled.
+	assert.InDelta(33.75, regularity.ExcessWaitTime.Seconds(), 0.001)
+	assert.Equal(2, regularity.BunchedPairs)
+}
+
+func TestSimulationRegularityStatsDegradation(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.AverageTimeBetweenTrains = 2 * time.Minute
+
+	// trains leave the first three stations with headways that get more uneven along the line.
+	for index, spread := range []time.Duration{0, 20 * time.Second, 40 * time.Second} {
+		station := sim.Stations[index]
+		var departedAt time.Duration
+		for x := 0; x < 6; x++ {
+			headway := 2*time.Minute + spread
+			if x%2 == 1 {
+				headway = 2*time.Minute - spread
+			}
+			departedAt += headway
+			station.Departures = append(station.Departures, Departure{TrainID: x, IsOutbound: true, Stopped: true, DepartedAt: departedAt})
+		}
+	}
+
+	stats := sim.computeRegularityStats()
+	assert.Equal(time.Minute, stats.BunchingThreshold)
+	assert.Len(stats.Outbound, 3)
+	assert.Empty(stats.Inbound)
+	assert.Equal(0, stats.Outbound[0].StopsFromTerminus)
+	assert.True(stats.Outbound[2].CoefficientOfVariation > stats.Outbound[0].CoefficientOfVariation)
+	assert.True(stats.OutboundDegradation > 0)
+}
@@ -0,0 +1,230 @@
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+)
+
+// DeriveSeed returns the seed for replication `index` of a run seeded with `master`.
+// It's a splitmix64 step, so neighbouring indexes get unrelated random streams.
+func DeriveSeed(master int64, index int) int64 {
+	z := uint64(master) + uint64(index+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// NewReplicationRunner returns a runner of independent replications of `scenario`,
+// with seeds derived from `seed`.
+func NewReplicationRunner(scenario Scenario, seed int64) *ReplicationRunner {
+	return &ReplicationRunner{
+		Scenario:         scenario,
+		Seed:             seed,
+		MinReplications:  5,
+		MaxReplications:  30,
+		Confidence:       0.95,
+		TargetPrecision:  0.02,
+		PrecisionMetrics: []string{"Mean Wait (s)", "Mean Journey (s)"},
+		Workers:          runtime.GOMAXPROCS(0),
+	}
+}
+
+// ReplicationRunner runs replications of a scenario across worker goroutines, each with
+// its own simulation and random stream, until the means are known precisely enough.
+//
+// Results only depend on the seed, not on how the runs were scheduled: the stopping rule
+// is checked over the replications in order, and any run past the one it stops at is dropped.
+type ReplicationRunner struct {
+	Scenario Scenario
+	Seed     int64
+
+	MinReplications int
+	MaxReplications int
+
+	// Confidence is the level of the confidence intervals.
+	Confidence float64
+	// TargetPrecision is the confidence interval half-width, relative to the mean, at which
+	// the runner stops early. Zero always runs MaxReplications.
+	TargetPrecision float64
+	// PrecisionMetrics are the names of the StatsMetrics that must reach the target precision.
+	PrecisionMetrics []string
+
+	Workers int
+}
+
+// Run runs the replications and aggregates them.
+func (rr *ReplicationRunner) Run() *ReplicationResult {
+	stats := make([]*SimulationStats, rr.MaxReplications)
+	done := make([]bool, rr.MaxReplications)
+
+	var mu sync.Mutex
+	next, checked := 0, 0
+	stopAt := rr.MaxReplications
+	// claim hands out the next replication to run, or -1 once the runner has enough.
+	claim := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= stopAt {
+			return -1
+		}
+		next++
+		return next - 1
+	}
+	finish := func(index int, result *SimulationStats) {
+		mu.Lock()
+		defer mu.Unlock()
+		stats[index] = result
+		done[index] = true
+
+		// check every newly completed prefix in order, so where the runner stops doesn't
+		// depend on which runs happened to finish together.
+		for checked < stopAt && done[checked] {
+			checked++
+			if checked < stopAt && rr.isPrecise(stats[:checked]) {
+				stopAt = checked
+			}
+		}
+	}
+
+	workers := rr.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := claim(); index >= 0; index = claim() {
+				finish(index, rr.Scenario.NewSimulation(DeriveSeed(rr.Seed, index)).Simulate())
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := &ReplicationResult{
+		Scenario:   rr.Scenario.Name,
+		Confidence: rr.Confidence,
+		Stats:      stats[:stopAt],
+		Reached:    stopAt < rr.MaxReplications || rr.isPrecise(stats[:stopAt]),
+	}
+	for index := range result.Stats {
+		result.Seeds = append(result.Seeds, DeriveSeed(rr.Seed, index))
+	}
+	result.Metrics = EstimateMetrics(result.Stats, rr.Confidence)
+	return result
+}
+
+func (rr *ReplicationRunner) isPrecise(stats []*SimulationStats) bool {
+	if rr.TargetPrecision <= 0 || len(stats) < rr.MinReplications || len(stats) < 2 {
+		return false
+	}
+	for _, estimate := range EstimateMetrics(stats, rr.Confidence) {
+		for _, name := range rr.PrecisionMetrics {
+			if estimate.Name == name && estimate.RelativePrecision() > rr.TargetPrecision {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MetricEstimate is the mean of a metric over replications, with its confidence interval.
+type MetricEstimate struct {
+	Name         string
+	Replications int
+	Mean         float64
+	StdDev       float64
+	HalfWidth    float64
+}
+
+// Lower returns the bottom of the confidence interval.
+func (me *MetricEstimate) Lower() float64 {
+	return me.Mean - me.HalfWidth
+}
+
+// Upper returns the top of the confidence interval.
+func (me *MetricEstimate) Upper() float64 {
+	return me.Mean + me.HalfWidth
+}
+
+// RelativePrecision returns the interval half-width as a fraction of the mean.
+func (me *MetricEstimate) RelativePrecision() float64 {
+	if me.Mean == 0 {
+		if me.HalfWidth == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return me.HalfWidth / math.Abs(me.Mean)
+}
+
+// EstimateMetrics returns the mean and confidence interval of every StatsMetric over the runs.
+func EstimateMetrics(stats []*SimulationStats, confidence float64) []*MetricEstimate {
+	var estimates []*MetricEstimate
+	for _, metric := range StatsMetrics() {
+		values := make([]float64, len(stats))
+		for index := range stats {
+			values[index] = metric.Value(stats[index])
+		}
+		estimates = append(estimates, estimateMean(metric.Name, values, confidence))
+	}
+	return estimates
+}
+
+func estimateMean(name string, values []float64, confidence float64) *MetricEstimate {
+	estimate := &MetricEstimate{Name: name, Replications: len(values)}
+	if len(values) == 0 {
+		return estimate
+	}
+	n := float64(len(values))
+	for _, value := range values {
+		estimate.Mean += value / n
+	}
+	if len(values) < 2 {
+		estimate.HalfWidth = math.Inf(1)
+		return estimate
+	}
+	var sumSquares float64
+	for _, value := range values {
+		sumSquares += (value - estimate.Mean) * (value - estimate.Mean)
+	}
+	estimate.StdDev = math.Sqrt(sumSquares / (n - 1))
+	estimate.HalfWidth = StudentTQuantile(1-(1-confidence)/2, n-1) * estimate.StdDev / math.Sqrt(n)
+	return estimate
+}
+
+// ReplicationResult is the aggregate of a set of replications.
+type ReplicationResult struct {
+	Scenario   string
+	Confidence float64
+	Seeds      []int64
+	Stats      []*SimulationStats
+	Metrics    []*MetricEstimate
+
+	// Reached is whether the precision metrics got to the target precision.
+	Reached bool
+}
+
+func (rr *ReplicationResult) String() string {
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, "%s: %d replications, %0.0f%% intervals", rr.Scenario, len(rr.Stats), rr.Confidence*100.0)
+	if rr.Reached {
+		fmt.Fprintln(buffer, " (target precision reached)")
+	} else {
+		fmt.Fprintln(buffer, " (target precision not reached)")
+	}
+
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Metric\tMean\tStd Dev\tInterval\tPrecision")
+	for _, metric := range rr.Metrics {
+		fmt.Fprintf(w, "%s\t%0.2f\t%0.2f\t[%0.2f, %0.2f]\t±%0.1f%%\n",
+			metric.Name, metric.Mean, metric.StdDev, metric.Lower(), metric.Upper(), metric.RelativePrecision()*100.0)
+	}
+	w.Flush()
+	return buffer.String()
+}
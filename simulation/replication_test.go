@@ -0,0 +1,80 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+// testReplicationScenario is a short run that still gets past stasis, which is when the first
+// train gets back to the yard, so passengers ride.
+func testReplicationScenario() Scenario {
+	config := New(time.Second, 135*time.Minute, nil).Config()
+	config.TotalPassengerCount = 5000
+	config.TotalTrainCount = 8
+	config.AverageTimeBetweenTrains = time.Minute
+	return Scenario{Name: "small", Config: config}
+}
+
+func TestDeriveSeed(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(DeriveSeed(1, 0), DeriveSeed(1, 0))
+	seen := map[int64]bool{}
+	for index := 0; index < 100; index++ {
+		seen[DeriveSeed(1, index)] = true
+		seen[DeriveSeed(2, index)] = true
+	}
+	assert.Len(seen, 200)
+}
+
+func TestReplicationRunnerIsReproducible(t *testing.T) {
+	assert := assert.New(t)
+
+	serial := NewReplicationRunner(testReplicationScenario(), 7)
+	serial.MaxReplications = 4
+	serial.TargetPrecision = 0
+	serial.Workers = 1
+
+	parallel := NewReplicationRunner(testReplicationScenario(), 7)
+	parallel.MaxReplications = 4
+	parallel.TargetPrecision = 0
+	parallel.Workers = 3
+
+	a, b := serial.Run(), parallel.Run()
+	assert.Len(a.Stats, 4)
+	assert.Len(b.Stats, 4)
+	assert.Equal(a.Seeds, b.Seeds)
+	assert.False(a.Reached)
+	for index := range a.Metrics {
+		assert.Equal(a.Metrics[index].Mean, b.Metrics[index].Mean, a.Metrics[index].Name)
+		assert.Equal(a.Metrics[index].HalfWidth, b.Metrics[index].HalfWidth, a.Metrics[index].Name)
+	}
+}
+
+func TestReplicationRunnerStopsEarly(t *testing.T) {
+	assert := assert.New(t)
+
+	runner := NewReplicationRunner(testReplicationScenario(), 7)
+	runner.MinReplications = 3
+	runner.MaxReplications = 10
+	runner.TargetPrecision = 100
+	runner.Workers = 2
+
+	result := runner.Run()
+	assert.Len(result.Stats, 3)
+	assert.True(result.Reached)
+	assert.NotEmpty(result.String())
+}
+
+func TestEstimateMean(t *testing.T) {
+	assert := assert.New(t)
+
+	estimate := estimateMean("test", []float64{9, 10, 11}, 0.95)
+	assert.Equal(10.0, estimate.Mean)
+	assert.Equal(1.0, estimate.StdDev)
+	// t(0.975, 2) = 4.303
+	assert.InDelta(4.303/1.7320508, estimate.HalfWidth, 0.001)
+	assert.InDelta(estimate.HalfWidth/10.0, estimate.RelativePrecision(), 1e-9)
+}
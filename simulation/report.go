@@ -0,0 +1,293 @@
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"time"
+)
+
+// WaitHistogramBin is how wide each bar of the report's wait time histogram is.
+const WaitHistogramBin = time.Minute
+
+// NewReport returns a report of a finished run. Trajectories may be nil, in which case
+// the report leaves out the string line diagram.
+func (s *Simulation) NewReport(stats *SimulationStats, trajectories *TrajectoryRecorder) *Report {
+	report := &Report{
+		Title:        "Train Simulation Report",
+		Config:       s.Config(),
+		Stats:        stats,
+		Stations:     s.Stations,
+		Trajectories: trajectories,
+		Incidents:    s.Incidents,
+		EndTime:      s.WallClock,
+	}
+
+	for x := 0; x < s.People.Len(); x++ {
+		p := s.People.Dequeue()
+		for _, trip := range p.Trips {
+			if trip.EnteredAt >= s.StasisAt {
+				report.Waits = append(report.Waits, trip.Waiting)
+			}
+		}
+		s.People.Enqueue(p)
+	}
+	return report
+}
+
+// Report is everything needed to write a single, self-contained HTML page about a run.
+type Report struct {
+	Title        string
+	Config       Config
+	Stats        *SimulationStats
+	Stations     []*Station
+	Trajectories *TrajectoryRecorder
+	Incidents    []Incident
+	Waits        []time.Duration
+	EndTime      time.Duration
+}
+
+// WriteHTML writes the report as one HTML file with every chart inline, so it can be opened offline.
+func (r *Report) WriteHTML(w io.Writer) error {
+	configJSON, err := json.MarshalIndent(r.Config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var stringLine template.HTML
+	if r.Trajectories != nil && len(r.Trajectories.Trajectories) > 0 {
+		buffer := bytes.NewBuffer(nil)
+		if err := NewStringLineDiagram(r.Stations, r.Trajectories).WriteSVG(buffer); err != nil {
+			return err
+		}
+		stringLine = template.HTML(buffer.String())
+	}
+
+	var distributions []*DistributionSummary
+	if r.Stats.Distributions != nil {
+		d := r.Stats.Distributions
+		distributions = []*DistributionSummary{d.Wait, d.InVehicle, d.Journey, d.RoundTrip, d.Dwell, d.Headway}
+	}
+
+	return reportTemplate.Execute(w, map[string]interface{}{
+		"Title":         r.Title,
+		"Seed":          r.Config.Seed,
+		"Config":        string(configJSON),
+		"Stats":         r.Stats,
+		"Distributions": distributions,
+		"Summary":       r.Stats.String(),
+		"WaitHistogram": r.waitHistogram(),
+		"LoadProfile":   r.loadProfile(),
+		"StringLine":    stringLine,
+		"Timeline":      r.incidentTimeline(),
+		"Incidents":     r.Incidents,
+		"EndTime":       r.EndTime,
+	})
+}
+
+func (r *Report) waitHistogram() template.HTML {
+	var counts []float64
+	for _, wait := range r.Waits {
+		bin := int(wait / WaitHistogramBin)
+		for len(counts) <= bin {
+			counts = append(counts, 0)
+		}
+		counts[bin]++
+	}
+
+	labels := make([]string, len(counts))
+	for bin := range counts {
+		labels[bin] = fmt.Sprintf("%v", time.Duration(bin)*WaitHistogramBin)
+	}
+	return svgBarChart(labels, []reportSeries{{Name: "Trips", Color: stringLineOutboundColor, Values: counts}}, 900, 260)
+}
+
+func (r *Report) loadProfile() template.HTML {
+	if r.Stats == nil {
+		return ""
+	}
+
+	var labels []string
+	outbound := reportSeries{Name: "Outbound", Color: stringLineOutboundColor}
+	inbound := reportSeries{Name: "Inbound", Color: stringLineInboundColor}
+	inboundLoads := map[string]float64{}
+	for _, track := range r.Stats.Tracks {
+		if !track.IsOutbound {
+			inboundLoads[track.To+"|"+track.From] = track.MeanLoad
+		}
+	}
+	for _, track := range r.Stats.Tracks {
+		if track.IsOutbound {
+			labels = append(labels, track.From)
+			outbound.Values = append(outbound.Values, track.MeanLoad)
+			inbound.Values = append(inbound.Values, inboundLoads[track.From+"|"+track.To])
+		}
+	}
+	return svgBarChart(labels, []reportSeries{outbound, inbound}, 900, 320)
+}
+
+func (r *Report) incidentTimeline() template.HTML {
+	if len(r.Incidents) == 0 || r.EndTime <= 0 {
+		return ""
+	}
+
+	const width, rowHeight, labelWidth = 900, 14, 220
+	rows := map[string]int{}
+	var names []string
+	for _, station := range r.Stations {
+		rows[station.Name] = len(names)
+		names = append(names, station.Name)
+	}
+	height := rowHeight*len(names) + 30
+	x := func(t time.Duration) float64 {
+		return labelWidth + float64(width-labelWidth-10)*float64(t)/float64(r.EndTime)
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">`, width, height)
+	for row, name := range names {
+		fmt.Fprintf(buffer, `<text x="%d" y="%d" text-anchor="end">%s</text>`, labelWidth-6, row*rowHeight+11, html.EscapeString(name))
+	}
+	for _, incident := range r.Incidents {
+		end := incident.End
+		if incident.IsActive() {
+			end = r.EndTime
+		}
+		barWidth := math.Max(x(end)-x(incident.Start), 2)
+		fmt.Fprintf(buffer, `<rect x="%0.1f" y="%d" width="%0.1f" height="%d" fill="%s"><title>[%d] at %s from %v for %v</title></rect>`,
+			x(incident.Start), rows[incident.Station]*rowHeight+2, barWidth, rowHeight-4, stringLineHoldColor,
+			incident.TrainID, html.EscapeString(incident.Station), incident.Start, incident.Duration(r.EndTime))
+	}
+	fmt.Fprintf(buffer, `<text x="%d" y="%d">0s</text><text x="%d" y="%d" text-anchor="end">%v</text></svg>`,
+		labelWidth, height-6, width-10, height-6, r.EndTime)
+	return template.HTML(buffer.String())
+}
+
+type reportSeries struct {
+	Name   string
+	Color  string
+	Values []float64
+}
+
+// svgBarChart draws grouped vertical bars, one group per label.
+func svgBarChart(labels []string, series []reportSeries, width, height int) template.HTML {
+	const marginLeft, marginBottom, marginTop = 50, 90, 20
+	var max float64
+	for _, s := range series {
+		for _, value := range s.Values {
+			max = math.Max(max, value)
+		}
+	}
+	if len(labels) == 0 || max == 0 {
+		return template.HTML(`<p>No data.</p>`)
+	}
+
+	plotWidth := float64(width - marginLeft - 10)
+	plotHeight := float64(height - marginBottom - marginTop)
+	groupWidth := plotWidth / float64(len(labels))
+	barWidth := groupWidth / float64(len(series)+1)
+
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="10">`, width, height)
+	baseline := float64(marginTop) + plotHeight
+	fmt.Fprintf(buffer, `<line x1="%d" y1="%0.1f" x2="%d" y2="%0.1f" stroke="#999"/>`, marginLeft, baseline, width-10, baseline)
+	fmt.Fprintf(buffer, `<text x="%d" y="%d" text-anchor="end">%0.0f</text>`, marginLeft-4, marginTop+4, max)
+	fmt.Fprintf(buffer, `<text x="%d" y="%0.1f" text-anchor="end">0</text>`, marginLeft-4, baseline)
+
+	for index, label := range labels {
+		groupX := float64(marginLeft) + groupWidth*float64(index)
+		for seriesIndex, s := range series {
+			if index >= len(s.Values) {
+				continue
+			}
+			barHeight := plotHeight * s.Values[index] / max
+			fmt.Fprintf(buffer, `<rect x="%0.1f" y="%0.1f" width="%0.1f" height="%0.1f" fill="%s"><title>%s %s: %0.1f</title></rect>`,
+				groupX+barWidth*(float64(seriesIndex)+0.5), baseline-barHeight, barWidth, barHeight, s.Color,
+				html.EscapeString(s.Name), html.EscapeString(label), s.Values[index])
+		}
+		labelX := groupX + groupWidth/2
+		fmt.Fprintf(buffer, `<text x="%0.1f" y="%0.1f" text-anchor="end" transform="rotate(-60 %0.1f %0.1f)">%s</text>`,
+			labelX, baseline+12, labelX, baseline+12, html.EscapeString(label))
+	}
+	for index, s := range series {
+		fmt.Fprintf(buffer, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/><text x="%d" y="%d">%s</text>`,
+			width-110, marginTop+index*14, s.Color, width-96, marginTop+index*14+9, html.EscapeString(s.Name))
+	}
+	fmt.Fprint(buffer, `</svg>`)
+	return template.HTML(buffer.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"round": func(value time.Duration) time.Duration { return value.Round(time.Second) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; padding-bottom: 0.2em; margin-top: 2em; }
+table { border-collapse: collapse; font-size: 0.85em; }
+th, td { padding: 0.2em 0.6em; text-align: right; border-bottom: 1px solid #eee; }
+th:first-child, td:first-child { text-align: left; }
+pre { background: #f6f6f6; padding: 1em; font-size: 0.8em; overflow-x: auto; }
+.chart { overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>Seed {{ .Seed }}, simulated {{ .EndTime }}.</p>
+
+<h2>Config</h2>
+<pre>{{ .Config }}</pre>
+
+<h2>Summary</h2>
+{{ if .Distributions }}
+<table>
+<tr><th>Measure</th><th>Count</th><th>Mean</th><th>P50</th><th>P90</th><th>P95</th><th>P99</th><th>Max</th></tr>
+{{ range .Distributions }}
+<tr><td>{{ .Name }}</td><td>{{ .Count }}</td><td>{{ round .Mean }}</td><td>{{ round .P50 }}</td><td>{{ round .P90 }}</td><td>{{ round .P95 }}</td><td>{{ round .P99 }}</td><td>{{ round .Max }}</td></tr>
+{{ end }}
+</table>
+{{ end }}
+<details><summary>Full text summary</summary><pre>{{ .Summary }}</pre></details>
+
+<h2>Stations</h2>
+<table>
+<tr><th>Station</th><th>Boardings</th><th>Alightings</th><th>Denied</th><th>Peak Waiting</th><th>Mean Wait</th><th>P95 Wait</th></tr>
+{{ range .Stats.Stations }}
+<tr><td>{{ .Name }}</td><td>{{ .Boardings }}</td><td>{{ .Alightings }}</td><td>{{ .DeniedBoardings }}</td><td>{{ .PeakWaiting }} @ {{ .PeakWaitingAt }}</td><td>{{ round .MeanWait }}</td><td>{{ round .P95Wait }}</td></tr>
+{{ end }}
+</table>
+
+<h2>Wait Times</h2>
+<div class="chart">{{ .WaitHistogram }}</div>
+
+<h2>Load Profile</h2>
+<p>Mean passengers on board leaving each station.</p>
+<div class="chart">{{ .LoadProfile }}</div>
+
+{{ if .StringLine }}
+<h2>String Line</h2>
+<div class="chart">{{ .StringLine }}</div>
+{{ end }}
+
+<h2>Incidents</h2>
+{{ if .Incidents }}
+<div class="chart">{{ .Timeline }}</div>
+<table>
+<tr><th>Station</th><th>Train</th><th>Start</th><th>End</th></tr>
+{{ range .Incidents }}
+<tr><td>{{ .Station }}</td><td>{{ .TrainID }}</td><td>{{ .Start }}</td><td>{{ if .IsActive }}ongoing{{ else }}{{ .End }}{{ end }}</td></tr>
+{{ end }}
+</table>
+{{ else }}
+<p>No incidents.</p>
+{{ end }}
+</body>
+</html>
+`))
@@ -0,0 +1,58 @@
+package simulation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestSimulationIncidentRecord(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.AverageIncidentDelay = time.Minute
+
+	station := sim.Stations[3]
+	train := sim.Yard.Dequeue()
+	station.OutBoundTrain = train
+
+	train.Hold(sim.WallClock)
+	sim.recordIncidentStart(station, train)
+	sim.WallClock = 30 * time.Second
+	train.Hold(sim.WallClock)
+	sim.recordIncidentStart(station, train)
+	assert.Len(sim.Incidents, 1)
+	assert.True(sim.Incidents[0].IsActive())
+
+	sim.WallClock = 90 * time.Second
+	sim.ReleaseTrainsOnHold(station)
+	assert.False(sim.Incidents[0].IsActive())
+	assert.Equal(90*time.Second, sim.Incidents[0].Duration(sim.WallClock))
+	assert.Equal(station.Name, sim.Incidents[0].Station)
+}
+
+func TestReportWriteHTML(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.CalculateTotalAverageRidership()
+
+	trajectories := NewTrajectoryRecorder(10 * time.Second)
+	sim.Observers = append(sim.Observers, trajectories)
+	for sim.WallClock < 15*time.Minute {
+		sim.Step()
+	}
+	sim.Incidents = append(sim.Incidents, Incident{Station: sim.Stations[2].Name, TrainID: 1, Start: 5 * time.Minute, End: 6 * time.Minute})
+
+	buffer := bytes.NewBuffer(nil)
+	assert.Nil(sim.NewReport(sim.ComputeStats(), trajectories).WriteHTML(buffer))
+
+	output := buffer.String()
+	assert.True(strings.HasPrefix(output, "<!DOCTYPE html>"))
+	assert.True(strings.Contains(output, "<polyline"), "string line diagram")
+	assert.True(strings.Contains(output, "Times Square-42 Street"))
+	assert.True(strings.Contains(output, "&#34;seed&#34;"), "config")
+	assert.False(strings.Contains(output, "<script src"))
+	assert.False(strings.Contains(output, "<link"))
+}
@@ -0,0 +1,118 @@
+package simulation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrNoResult is returned by a ResultStore for a result it doesn't have.
+var ErrNoResult = errors.New("no such result")
+
+// ResultStore keeps what the server's runs produce, by run ID and result name, e.g. "stats.json".
+type ResultStore interface {
+	Save(id, name string, data []byte) error
+	Load(id, name string) ([]byte, error)
+	// Runs returns the IDs of every run with results saved.
+	Runs() ([]string, error)
+}
+
+// NewMemoryResultStore returns a store that keeps results in memory, for as long as the server runs.
+func NewMemoryResultStore() *MemoryResultStore {
+	return &MemoryResultStore{
+		results: map[string]map[string][]byte{},
+	}
+}
+
+// MemoryResultStore keeps results in memory.
+type MemoryResultStore struct {
+	mu      sync.Mutex
+	results map[string]map[string][]byte
+}
+
+// Save keeps a result.
+func (ms *MemoryResultStore) Save(id, name string, data []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.results[id] == nil {
+		ms.results[id] = map[string][]byte{}
+	}
+	ms.results[id][name] = data
+	return nil
+}
+
+// Load returns a result, or ErrNoResult.
+func (ms *MemoryResultStore) Load(id, name string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	data, ok := ms.results[id][name]
+	if !ok {
+		return nil, ErrNoResult
+	}
+	return data, nil
+}
+
+// Runs returns the IDs of every run with results saved.
+func (ms *MemoryResultStore) Runs() ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var ids []string
+	for id := range ms.results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// NewDiskResultStore returns a store that keeps each run's results in a directory of its own under `dir`,
+// so they outlast the server.
+func NewDiskResultStore(dir string) *DiskResultStore {
+	return &DiskResultStore{Dir: dir}
+}
+
+// DiskResultStore keeps results as files, at Dir/<run ID>/<result name>.
+type DiskResultStore struct {
+	Dir string
+}
+
+// Save writes a result, replacing it whole so a reader never sees half of it.
+func (ds *DiskResultStore) Save(id, name string, data []byte) error {
+	dir := filepath.Join(ds.Dir, filepath.Base(id))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, filepath.Base(name))
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Load reads a result, or returns ErrNoResult.
+func (ds *DiskResultStore) Load(id, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(ds.Dir, filepath.Base(id), filepath.Base(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoResult
+	}
+	return data, err
+}
+
+// Runs returns the IDs of every run with a directory of results.
+func (ds *DiskResultStore) Runs() ([]string, error) {
+	entries, err := os.ReadDir(ds.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,138 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// runChunk is how much simulated time RunContext runs between checks.
+const runChunk = time.Minute
+
+// RunProgress is how far along RunContext is.
+type RunProgress struct {
+	WallClock time.Duration
+	TotalTime time.Duration
+	// Percent is the share of TotalTime simulated so far; it stays at 100 while the line drains.
+	Percent  float64
+	Draining bool
+	// StepsPerSecond is the simulated steps run per second of real time since the run started.
+	StepsPerSecond float64
+	Elapsed        time.Duration
+}
+
+func (rp RunProgress) String() string {
+	if rp.Draining {
+		return fmt.Sprintf("%v draining (%0.0f steps/s)", rp.WallClock, rp.StepsPerSecond)
+	}
+	return fmt.Sprintf("%v of %v %0.1f%% (%0.0f steps/s)", rp.WallClock, rp.TotalTime, rp.Percent, rp.StepsPerSecond)
+}
+
+// StallError is returned by RunContext when no train has moved for StallTimeout.
+type StallError struct {
+	WallClock time.Duration
+	// Since is when a train last moved.
+	Since  time.Duration
+	Trains []TrainLocation
+}
+
+func (se *StallError) Error() string {
+	return fmt.Sprintf("no train has moved since %v, it's now %v: %s", se.Since, se.WallClock, describeTrains(se.Trains))
+}
+
+func describeTrains(locations []TrainLocation) string {
+	if len(locations) == 0 {
+		return "every train is in the yard"
+	}
+	var trains []string
+	for _, location := range locations {
+		direction := "inbound"
+		if location.Train.IsOutbound {
+			direction = "outbound"
+		}
+		var where string
+		if location.Station != nil {
+			where = "at " + location.Station.Name
+		} else {
+			where = fmt.Sprintf("%0.0fm from %s towards %s", location.Train.Position, location.Track.Begin.Name, location.Track.End.Name)
+		}
+		trains = append(trains, fmt.Sprintf("[%d] %s %s %s", location.Train.ID, location.State, direction, where))
+	}
+	return strings.Join(trains, ", ")
+}
+
+// RunContext is Simulate, except it stops with an error if the config can't make a run, if ctx is
+// done, if the line hasn't drained MaxDrainTime after TotalTime, or if no train moves for
+// StallTimeout, e.g. when trains are holding for each other forever. While it runs it reports to
+// Progress about every ProgressInterval.
+func (s *Simulation) RunContext(ctx context.Context) (*SimulationStats, error) {
+	s.Generate()
+	return s.FinishContext(ctx)
+}
+
+// FinishContext is Finish with the stopping rules and progress reports of RunContext.
+func (s *Simulation) FinishContext(ctx context.Context) (*SimulationStats, error) {
+	if err := s.Config().Validate(); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	startedAt := s.WallClock
+	var lastReport time.Time
+	report := func() {
+		if s.Progress == nil {
+			return
+		}
+		progress := RunProgress{
+			WallClock: s.WallClock,
+			TotalTime: s.TotalTime,
+			Percent:   100,
+			Draining:  s.WallClock >= s.TotalTime,
+			Elapsed:   time.Since(started),
+		}
+		if s.TotalTime > 0 && s.WallClock < s.TotalTime {
+			progress.Percent = 100 * float64(s.WallClock) / float64(s.TotalTime)
+		}
+		if progress.Elapsed > 0 && s.StepLength > 0 {
+			progress.StepsPerSecond = float64((s.WallClock-startedAt)/s.StepLength) / progress.Elapsed.Seconds()
+		}
+		lastReport = time.Now()
+		s.Progress(progress)
+	}
+
+	lastMovement, lastMoved := s.trainMovement(), s.WallClock
+	for !s.IsFinished() {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("stopped at %v: %w", s.WallClock, err)
+		}
+		if s.MaxDrainTime > 0 && s.WallClock >= s.TotalTime+s.MaxDrainTime {
+			return nil, fmt.Errorf("the line hasn't drained %v after the end of service, %d of %d trains are back: %s",
+				s.MaxDrainTime, s.Yard.Len(), s.TotalTrainCount, describeTrains(s.TrainLocations()))
+		}
+		if movement := s.trainMovement(); movement != lastMovement {
+			lastMovement, lastMoved = movement, s.WallClock
+		} else if s.StallTimeout > 0 && s.WallClock-lastMoved >= s.StallTimeout {
+			return nil, &StallError{WallClock: s.WallClock, Since: lastMoved, Trains: s.TrainLocations()}
+		}
+		if time.Since(lastReport) >= s.ProgressInterval {
+			report()
+		}
+
+		before := s.WallClock
+		s.RunUntil(s.WallClock + runChunk)
+		if s.WallClock == before && !s.IsFinished() {
+			return nil, fmt.Errorf("the run stopped advancing at %v", s.WallClock)
+		}
+	}
+	report()
+	return s.ComputeStats(), nil
+}
+
+// trainMovement changes whenever any train moves, including in and out of the yard.
+func (s *Simulation) trainMovement() float64 {
+	movement := float64(s.Yard.Len())
+	for _, train := range s.TrainsInService() {
+		movement += train.DistanceTraveled + train.Position
+	}
+	return movement
+}
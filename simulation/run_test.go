@@ -0,0 +1,105 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestRunContextMatchesSimulate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, engine := range []string{EngineStepped, EngineEvent} {
+		scenario := testReplicationScenario()
+		scenario.Config.Engine = engine
+		expected := scenario.NewSimulation(1).Simulate()
+
+		sim := scenario.NewSimulation(1)
+		var reports []RunProgress
+		sim.ProgressInterval = 0
+		sim.Progress = func(progress RunProgress) {
+			reports = append(reports, progress)
+		}
+		stats, err := sim.RunContext(context.Background())
+		assert.Nil(err, engine)
+		assert.Equal(expected.Revenue.Trips, stats.Revenue.Trips, engine)
+		assert.Equal(expected.AveragePassengerJourneyTime, stats.AveragePassengerJourneyTime, engine)
+
+		assert.NotEmpty(reports)
+		for index := 1; index < len(reports); index++ {
+			assert.True(reports[index].Percent >= reports[index-1].Percent)
+		}
+		last := reports[len(reports)-1]
+		assert.Equal(100.0, last.Percent)
+		assert.True(last.Draining)
+		assert.True(last.StepsPerSecond > 0)
+	}
+}
+
+func TestRunContextCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.ProgressInterval = 0
+	sim.Progress = func(progress RunProgress) {
+		if progress.WallClock >= 10*time.Minute {
+			cancel()
+		}
+	}
+	_, err := sim.RunContext(ctx)
+	assert.True(errors.Is(err, context.Canceled))
+	assert.True(sim.WallClock < 15*time.Minute)
+}
+
+func TestRunContextMaxDrainTime(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.MaxDrainTime = time.Minute
+	_, err := sim.RunContext(context.Background())
+	assert.NotNil(err)
+	assert.False(sim.AllTrainsReturned())
+	assert.True(sim.WallClock <= sim.TotalTime+2*time.Minute)
+}
+
+func TestRunContextStall(t *testing.T) {
+	assert := assert.New(t)
+
+	// the only train, held by hand, never gets out of the first station's platform.
+	scenario := testReplicationScenario()
+	scenario.Config.TotalTrainCount = 1
+	sim := scenario.NewSimulation(1)
+	sim.Generate()
+	sim.HoldTrain(sim.Yard.Peek())
+	sim.StallTimeout = 10 * time.Minute
+	_, err := sim.FinishContext(context.Background())
+	stall, ok := err.(*StallError)
+	if !ok {
+		t.Fatalf("expected a stall, got %v", err)
+	}
+	assert.True(sim.WallClock < sim.TotalTime)
+	assert.Equal(10*time.Minute, stall.WallClock-stall.Since)
+	assert.NotEmpty(stall.Trains)
+}
+
+func TestRunContextTrainsThatCantMove(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, engine := range []string{EngineStepped, EngineEvent} {
+		for _, field := range []string{"train_average_acceleration", "train_average_braking", "train_maximum_speed"} {
+			scenario := testReplicationScenario()
+			scenario.Config.Engine = engine
+			assert.Nil(SetConfigValue(&scenario.Config, field, "0"))
+			assert.NotNil(scenario.Config.Validate(), field)
+
+			sim := scenario.NewSimulation(1)
+			_, err := sim.RunContext(context.Background())
+			assert.NotNil(err, engine, field)
+			assert.Zero(sim.WallClock, engine, field)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package simulation
+
+import (
+	"math"
+	"strings"
+)
+
+// schematicMargin is the columns left either side of the line.
+const schematicMargin = 2
+
+// schematicHeat shades a platform from empty to a full trainload waiting.
+var schematicHeat = []rune(" ░▒▓█")
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+)
+
+// Schematic returns a schematic of the line `width` characters wide, for the terminal.
+func (s *Simulation) Schematic(width int) *Schematic {
+	schematic := NewSchematic(s.Stations, width)
+	schematic.PlatformCapacity = s.TrainCapacity
+	return schematic
+}
+
+// NewSchematic returns a schematic of the stations and the trains running between them.
+func NewSchematic(stations []*Station, width int) *Schematic {
+	return &Schematic{
+		Width:            width,
+		Color:            true,
+		PlatformCapacity: 256,
+		Stations:         stations,
+	}
+}
+
+// Schematic draws the line to scale for the terminal: the outbound track above the inbound one,
+// stations spaced by the distances between them, and every train at its chainage, colored green,
+// yellow or red as it fills up. Above and below the tracks each platform is shaded by how crowded it is.
+type Schematic struct {
+	Width int
+	// Color draws trains in ANSI colors by load; without it every train is drawn the same.
+	Color bool
+	// PlatformCapacity is how many waiting passengers shade a platform solid.
+	PlatformCapacity int
+
+	Stations []*Station
+}
+
+// Lines returns the schematic a line at a time, with the station names on the first and last lines.
+func (sc *Schematic) Lines() []string {
+	if len(sc.Stations) == 0 {
+		return nil
+	}
+	columns := sc.Width - 2*schematicMargin
+	if columns < len(sc.Stations) {
+		columns = len(sc.Stations)
+	}
+	width := columns + 2*schematicMargin
+	length := sc.Stations[len(sc.Stations)-1].Chainage
+	column := func(chainage float64) int {
+		if length <= 0 {
+			return schematicMargin
+		}
+		return schematicMargin + int(math.Round(chainage/length*float64(columns-1)))
+	}
+
+	outboundHeat, inboundHeat := schematicRow(width, ' '), schematicRow(width, ' ')
+	outbound, inbound := schematicRow(width, '─'), schematicRow(width, '─')
+	for _, station := range sc.Stations {
+		x := column(station.Chainage)
+		outbound[x], inbound[x] = '┼', '┼'
+		var outboundWaiting, inboundWaiting int
+		for _, p := range station.WaitingPassengers.Values() {
+			if p.IsOutBound {
+				outboundWaiting++
+			} else {
+				inboundWaiting++
+			}
+		}
+		outboundHeat[x], inboundHeat[x] = sc.heat(outboundWaiting), sc.heat(inboundWaiting)
+	}
+
+	// where trains share a column, the fullest one picks the color.
+	outboundLoads, inboundLoads := map[int]float64{}, map[int]float64{}
+	for _, location := range trainLocations(sc.Stations) {
+		x := column(location.Chainage)
+		track, loads, glyph := outbound, outboundLoads, '▶'
+		if !location.Train.IsOutbound {
+			track, loads, glyph = inbound, inboundLoads, '◀'
+		}
+		track[x] = glyph
+		var load float64
+		if location.Train.Capacity > 0 {
+			load = float64(len(location.Train.Passengers)) / float64(location.Train.Capacity)
+		}
+		if previous, ok := loads[x]; !ok || load > previous {
+			loads[x] = load
+		}
+	}
+
+	above, below := sc.labels(width, column)
+	return []string{
+		above,
+		string(outboundHeat),
+		sc.colored(outbound, outboundLoads),
+		sc.colored(inbound, inboundLoads),
+		string(inboundHeat),
+		below,
+	}
+}
+
+func schematicRow(width int, fill rune) []rune {
+	row := make([]rune, width)
+	for x := range row {
+		row[x] = fill
+	}
+	return row
+}
+
+func (sc *Schematic) heat(waiting int) rune {
+	if waiting == 0 || sc.PlatformCapacity <= 0 {
+		return schematicHeat[0]
+	}
+	level := 1 + waiting*(len(schematicHeat)-1)/sc.PlatformCapacity
+	if level >= len(schematicHeat) {
+		level = len(schematicHeat) - 1
+	}
+	return schematicHeat[level]
+}
+
+func (sc *Schematic) colored(row []rune, loads map[int]float64) string {
+	if !sc.Color {
+		return string(row)
+	}
+	var line strings.Builder
+	for x, r := range row {
+		load, ok := loads[x]
+		if !ok {
+			line.WriteRune(r)
+			continue
+		}
+		color := ansiGreen
+		if load >= 0.9 {
+			color = ansiRed
+		} else if load >= 0.5 {
+			color = ansiYellow
+		}
+		line.WriteString(color)
+		line.WriteRune(r)
+		line.WriteString(ansiReset)
+	}
+	return line.String()
+}
+
+// labels names the stations above the line and below it in turn, each starting at its station
+// and cut short where the next name on the same side starts.
+func (sc *Schematic) labels(width int, column func(float64) int) (string, string) {
+	rows := [2][]rune{schematicRow(width, ' '), schematicRow(width, ' ')}
+	// used is where the last name on each side ended.
+	var used [2]int
+	for index, station := range sc.Stations {
+		side := index % 2
+		start := column(station.Chainage)
+		end := width
+		next := index + 2
+		if next < len(sc.Stations) {
+			end = column(sc.Stations[next].Chainage) - 1
+		}
+		name := []rune(station.Name)
+		if next >= len(sc.Stations) && start+len(name) > end {
+			// the last names would run off the end, so they back up into any space left before them.
+			start = end - len(name)
+			if floor := used[side] + 1; start < floor {
+				start = floor
+			}
+			if start > column(station.Chainage) {
+				start = column(station.Chainage)
+			}
+		}
+		for offset, r := range name {
+			if start+offset >= end {
+				break
+			}
+			rows[side][start+offset] = r
+			used[side] = start + offset + 1
+		}
+	}
+	return strings.TrimRight(string(rows[0]), " "), strings.TrimRight(string(rows[1]), " ")
+}
@@ -0,0 +1,97 @@
+package simulation
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestSchematicScalesToWidth(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := createTestSimulation()
+	for _, width := range []int{40, 80, 200} {
+		schematic := sim.Schematic(width)
+		schematic.Color = false
+		lines := schematic.Lines()
+		assert.Len(lines, 6)
+		for _, line := range lines {
+			assert.True(utf8.RuneCountInString(line) <= width, line)
+		}
+		assert.Equal(width, utf8.RuneCountInString(lines[2]))
+	}
+
+	// wide enough, every station gets its own marker, spaced by the distance to the next.
+	schematic := sim.Schematic(400)
+	schematic.Color = false
+	outbound := []rune(schematic.Lines()[2])
+	var markers []int
+	for x, r := range outbound {
+		if r == '┼' {
+			markers = append(markers, x)
+		}
+	}
+	assert.Len(markers, len(sim.Stations))
+	assert.Equal(schematicMargin, markers[0])
+	assert.Equal(len(outbound)-schematicMargin-1, markers[len(markers)-1])
+	longest, shortest := 0, 0
+	for x := 1; x < len(sim.Stations); x++ {
+		distance := sim.Stations[x-1].OutBoundTrack.DistanceMeters
+		if distance > sim.Stations[longest].OutBoundTrack.DistanceMeters {
+			longest = x - 1
+		}
+		if distance < sim.Stations[shortest].OutBoundTrack.DistanceMeters {
+			shortest = x - 1
+		}
+	}
+	assert.True(markers[longest+1]-markers[longest] > markers[shortest+1]-markers[shortest])
+	assert.True(strings.HasPrefix(schematic.Lines()[0], "  "+sim.Stations[0].Name))
+}
+
+func TestSchematicTrainsAndCrowding(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := createTestSimulation()
+	sim.TrainCapacity = 8
+	schematic := sim.Schematic(100)
+	schematic.Color = false
+
+	// an empty outbound train halfway along the first track, and a full inbound one at the third station.
+	track := sim.Stations[0].OutBoundTrack
+	running := sim.Yard.Dequeue()
+	running.IsOutbound = true
+	track.AddTrain(running)
+	running.Position = track.DistanceMeters / 2
+	full := sim.Yard.Dequeue()
+	full.IsOutbound = false
+	full.Capacity = 2
+	full.Passengers = append(full.Passengers, sim.People.Dequeue(), sim.People.Dequeue())
+	sim.Stations[2].InBoundTrain = full
+
+	// a platform with a trainload waiting to go outbound.
+	for x := 0; x < 8; x++ {
+		p := sim.People.Dequeue()
+		p.IsOutBound = true
+		sim.Stations[1].WaitingPassengers.Enqueue(p)
+	}
+
+	lines := schematic.Lines()
+	columns := 100 - 2*schematicMargin
+	last := sim.Stations[len(sim.Stations)-1].Chainage
+	column := func(chainage float64) int {
+		return schematicMargin + int(chainage/last*float64(columns-1)+0.5)
+	}
+	assert.Equal('▶', []rune(lines[2])[column(track.DistanceMeters/2)])
+	assert.Equal('◀', []rune(lines[3])[column(sim.Stations[2].Chainage)])
+	assert.Equal('█', []rune(lines[1])[column(sim.Stations[1].Chainage)])
+	assert.Equal(' ', []rune(lines[4])[column(sim.Stations[1].Chainage)])
+
+	// in color the full train is red and the empty one green.
+	schematic.Color = true
+	lines = schematic.Lines()
+	assert.True(strings.Contains(lines[2], ansiGreen+"▶"+ansiReset))
+	assert.True(strings.Contains(lines[3], ansiRed+"◀"+ansiReset))
+	assert.Equal(100, utf8.RuneCountInString(truncate(lines[3], 100))-utf8.RuneCountInString(ansiRed+ansiReset))
+}
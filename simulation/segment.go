@@ -0,0 +1,191 @@
+package simulation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blendlabs/go-util"
+)
+
+const (
+	// WaitTimeWeight is how much worse a minute spent waiting on the platform feels than a minute riding.
+	WaitTimeWeight = 2.0
+	// WalkTimeWeight is how much worse a minute spent walking through the station feels than a minute riding.
+	WalkTimeWeight = 1.5
+	// DefaultValueOfTime is what an hour of a passenger's time is worth when riders aren't split into segments.
+	DefaultValueOfTime = 19.0
+)
+
+// DefaultSegments returns commuter, tourist and student segments.
+func DefaultSegments() []*Segment {
+	return []*Segment{
+		{
+			Name:           "Commuter",
+			Share:          0.60,
+			ArrivalProfile: [24]float64{0.1, 0.05, 0.05, 0.05, 0.1, 0.3, 0.8, 1.0, 1.0, 0.6, 0.3, 0.3, 0.4, 0.3, 0.3, 0.4, 0.7, 1.0, 1.0, 0.6, 0.3, 0.2, 0.2, 0.1},
+			WalkingSpeed:   1.1,
+			Patience:       20 * time.Minute,
+			ValueOfTime:    25.0,
+		},
+		{
+			Name:           "Tourist",
+			Share:          0.15,
+			ArrivalProfile: [24]float64{0.05, 0.05, 0.0, 0.0, 0.0, 0.05, 0.1, 0.2, 0.4, 0.7, 0.9, 1.0, 1.0, 1.0, 1.0, 0.9, 0.8, 0.7, 0.6, 0.6, 0.5, 0.4, 0.2, 0.1},
+			WalkingSpeed:   0.8,
+			Patience:       30 * time.Minute,
+			ValueOfTime:    15.0,
+		},
+		{
+			Name:           "Student",
+			Share:          0.25,
+			ArrivalProfile: [24]float64{0.05, 0.0, 0.0, 0.0, 0.0, 0.1, 0.5, 1.0, 0.7, 0.3, 0.3, 0.3, 0.4, 0.5, 0.8, 1.0, 0.7, 0.5, 0.4, 0.3, 0.3, 0.2, 0.1, 0.1},
+			WalkingSpeed:   1.2,
+			Patience:       25 * time.Minute,
+			ValueOfTime:    8.0,
+		},
+	}
+}
+
+// Segment is a group of passengers who travel alike.
+type Segment struct {
+	Name  string
+	Share float64
+
+	// ArrivalProfile is how likely the segment is to be travelling in each hour of the day,
+	// relative to its busiest hour (1.0).
+	ArrivalProfile [24]float64
+
+	// WalkingSpeed scales how fast the segment walks through stations; 1.0 is typical.
+	WalkingSpeed float64
+
+	// Patience is how long the segment will wait on the platform before giving up; zero waits forever.
+	Patience time.Duration
+
+	// ValueOfTime is what an hour of the segment's time is worth, in fare currency.
+	ValueOfTime float64
+}
+
+// ArrivalLikelihood returns how likely a passenger in the segment is to be travelling at the given
+// time of day, relative to the segment's busiest hour.
+func (sg *Segment) ArrivalLikelihood(timeOfDay time.Duration) float64 {
+	hour := int(timeOfDay/time.Hour) % 24
+	return sg.ArrivalProfile[hour]
+}
+
+// GeneralizedCost returns what a trip cost the segment in time, weighted by how unpleasant each part is.
+func (sg *Segment) GeneralizedCost(waiting, inMotion, walking time.Duration) float64 {
+	weightedHours := (WaitTimeWeight*waiting.Hours() + inMotion.Hours() + WalkTimeWeight*walking.Hours())
+	return sg.ValueOfTime * weightedHours
+}
+
+func (sg *Segment) String() string {
+	return sg.Name
+}
+
+// TimeOfDay returns the clock time the simulation is at, given it starts at StartOfDay.
+func (s *Simulation) TimeOfDay() time.Duration {
+	return (s.StartOfDay + s.WallClock) % (24 * time.Hour)
+}
+
+func (s *Simulation) randomSegment() *Segment {
+	if len(s.Segments) == 0 {
+		return nil
+	}
+
+	var total float64
+	for _, segment := range s.Segments {
+		total += segment.Share
+	}
+
+	draw := s.Provider.Float64() * total
+	for _, segment := range s.Segments {
+		draw -= segment.Share
+		if draw < 0 {
+			return segment
+		}
+	}
+	return s.Segments[len(s.Segments)-1]
+}
+
+// PassengersGiveUp sends passengers who've waited past their segment's patience back home.
+func (s *Simulation) PassengersGiveUp(station *Station) {
+	// the queue is in the order passengers started waiting, so if the front passenger
+	// hasn't run out of patience nobody has.
+	patience, hasPatience := s.minimumPatience()
+	if !hasPatience {
+		return
+	}
+	front := station.WaitingPassengers.Peek()
+	if front == nil || s.WallClock-front.StartedWaiting <= patience {
+		return
+	}
+
+	waitingCount := station.WaitingPassengers.Len()
+	for x := 0; x < waitingCount; x++ {
+		p := station.WaitingPassengers.Dequeue()
+		if p.Segment != nil && p.Segment.Patience > 0 && s.WallClock-p.StartedWaiting > p.Segment.Patience {
+			p.GivingUp(s.WallClock)
+			s.People.Enqueue(p)
+			continue
+		}
+		station.WaitingPassengers.Enqueue(p)
+	}
+}
+
+func (s *Simulation) minimumPatience() (patience time.Duration, hasPatience bool) {
+	for _, segment := range s.Segments {
+		if segment.Patience > 0 && (!hasPatience || segment.Patience < patience) {
+			patience = segment.Patience
+			hasPatience = true
+		}
+	}
+	return
+}
+
+// SegmentStats are the journey outcomes for one passenger segment.
+type SegmentStats struct {
+	Name      string
+	Trips     int
+	Abandoned int
+
+	AverageJourneyTime     time.Duration
+	AverageGeneralizedCost float64
+}
+
+func (ss *SegmentStats) String() string {
+	return fmt.Sprintf("%s - Trips: %d Abandoned: %d Mean Door-to-Door Time: %v Mean Generalized Cost: %0.2f", ss.Name, ss.Trips, ss.Abandoned, ss.AverageJourneyTime, ss.AverageGeneralizedCost)
+}
+
+func (s *Simulation) computeSegmentStats() []*SegmentStats {
+	bySegment := map[*Segment]*SegmentStats{}
+	journeys := map[*Segment][]time.Duration{}
+	costs := map[*Segment]float64{}
+
+	var stats []*SegmentStats
+	for _, segment := range s.Segments {
+		segmentStats := &SegmentStats{Name: segment.Name}
+		bySegment[segment] = segmentStats
+		stats = append(stats, segmentStats)
+	}
+
+	for x := 0; x < s.People.Len(); x++ {
+		p := s.People.Dequeue()
+		if segmentStats, hasSegment := bySegment[p.Segment]; hasSegment {
+			segmentStats.Trips += len(p.Journeys)
+			segmentStats.Abandoned += p.Abandoned
+			journeys[p.Segment] = append(journeys[p.Segment], p.Journeys...)
+			for _, cost := range p.GeneralizedCosts {
+				costs[p.Segment] += cost
+			}
+		}
+		s.People.Enqueue(p)
+	}
+
+	for segment, segmentStats := range bySegment {
+		segmentStats.AverageJourneyTime = util.MeanOfDuration(journeys[segment])
+		if segmentStats.Trips > 0 {
+			segmentStats.AverageGeneralizedCost = costs[segment] / float64(segmentStats.Trips)
+		}
+	}
+	return stats
+}
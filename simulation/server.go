@@ -0,0 +1,610 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverQueueLength is how many runs can wait for a worker before the server turns more away.
+const serverQueueLength = 256
+
+// RunState is where a server run is in its life.
+type RunState string
+
+// Run states.
+const (
+	RunQueued    RunState = "queued"
+	RunRunning   RunState = "running"
+	RunSucceeded RunState = "succeeded"
+	RunFailed    RunState = "failed"
+	RunCancelled RunState = "cancelled"
+)
+
+// IsDone returns if the run has stopped, one way or another.
+func (rs RunState) IsDone() bool {
+	return rs == RunSucceeded || rs == RunFailed || rs == RunCancelled
+}
+
+// Results each server run saves.
+const (
+	ResultStatus     = "run.json"
+	ResultStats      = "stats.json"
+	ResultTimeSeries = "timeseries.jsonl"
+	ResultEvents     = "events.jsonl"
+)
+
+// Server errors.
+var (
+	ErrNoRun         = errors.New("no such run")
+	ErrServerBusy    = errors.New("too many runs are waiting, try again later")
+	ErrServerClosed  = errors.New("the server is shutting down")
+	errBadRunRequest = errors.New("bad run request")
+)
+
+// RunRequest is the body of a request to start a run. Config is a JSON Config whose fields
+// override the server's DefaultConfig; without a seed the run is given its own.
+type RunRequest struct {
+	Name   string          `json:"name,omitempty"`
+	Config json.RawMessage `json:"config,omitempty"`
+	// TimeSeriesInterval is the simulated time between time-series samples, in nanoseconds like
+	// Config's durations; zero uses the server's.
+	TimeSeriesInterval time.Duration `json:"timeseries_interval,omitempty"`
+	// EventsLevel is the lowest severity of event kept, e.g. "debug"; the default is "info".
+	EventsLevel *slog.Level `json:"events_level,omitempty"`
+}
+
+// RunStatus is a server run as the API reports it.
+type RunStatus struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name,omitempty"`
+	State  RunState `json:"state"`
+	Config Config   `json:"config"`
+
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+
+	// SimTimeS is how much of the run has been simulated, in seconds, and Percent that as a share of the day.
+	SimTimeS float64 `json:"sim_time_s"`
+	Percent  float64 `json:"percent"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type serverRun struct {
+	status  RunStatus
+	request RunRequest
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// metrics are set while the run is running.
+	metrics *Metrics
+}
+
+// NewServer returns a server running submitted runs `workers` at a time and keeping their results
+// in `store`. Runs already in the store, e.g. on disk from before a restart, are listed again.
+func NewServer(defaults Config, store ResultStore, workers int) (*Server, error) {
+	sv := &Server{
+		DefaultConfig:      defaults,
+		Store:              store,
+		TimeSeriesInterval: time.Minute,
+		MaxDrainTime:       4 * time.Hour,
+		StallTimeout:       30 * time.Minute,
+		runs:               map[string]*serverRun{},
+		queue:              make(chan *serverRun, serverQueueLength),
+	}
+	if err := sv.load(); err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for worker := 0; worker < workers; worker++ {
+		sv.wg.Add(1)
+		go sv.work()
+	}
+	return sv, nil
+}
+
+// Server runs simulations on a pool of workers for other programs, over HTTP; see ServeHTTP.
+type Server struct {
+	// DefaultConfig is what each run's config overrides; its seed derives the seeds of runs without one.
+	DefaultConfig      Config
+	Store              ResultStore
+	TimeSeriesInterval time.Duration
+
+	// MaxDrainTime and StallTimeout are when each run gives up, as for Simulation.
+	MaxDrainTime time.Duration
+	StallTimeout time.Duration
+
+	mu     sync.Mutex
+	runs   map[string]*serverRun
+	order  []string
+	next   int
+	queue  chan *serverRun
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Submit queues a run, returning its status.
+func (sv *Server) Submit(request RunRequest) (RunStatus, error) {
+	config := sv.DefaultConfig.Clone()
+	config.Seed = 0
+	if len(request.Config) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(request.Config))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return RunStatus{}, fmt.Errorf("%w: config: %v", errBadRunRequest, err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return RunStatus{}, fmt.Errorf("%w: config: %v", errBadRunRequest, err)
+	}
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if sv.closed {
+		return RunStatus{}, ErrServerClosed
+	}
+	number := sv.next + 1
+	if config.Seed == 0 {
+		config.Seed = DeriveSeed(sv.DefaultConfig.Seed, number)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &serverRun{
+		status: RunStatus{
+			ID:        strconv.Itoa(number),
+			Name:      request.Name,
+			State:     RunQueued,
+			Config:    config,
+			Submitted: time.Now().UTC(),
+		},
+		request: request,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	select {
+	case sv.queue <- run:
+		{
+			sv.next = number
+			sv.runs[run.status.ID] = run
+			sv.order = append(sv.order, run.status.ID)
+			return run.status, sv.saveStatus(run)
+		}
+	default:
+		{
+			cancel()
+			return RunStatus{}, ErrServerBusy
+		}
+	}
+}
+
+// Status returns a run's status.
+func (sv *Server) Status(id string) (RunStatus, error) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	run, ok := sv.runs[id]
+	if !ok {
+		return RunStatus{}, ErrNoRun
+	}
+	return run.status, nil
+}
+
+// Statuses returns every run's status, in the order they were submitted.
+func (sv *Server) Statuses() []RunStatus {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	statuses := make([]RunStatus, 0, len(sv.order))
+	for _, id := range sv.order {
+		statuses = append(statuses, sv.runs[id].status)
+	}
+	return statuses
+}
+
+// Cancel stops a run that's queued or running; a run that's already done is left as it is.
+func (sv *Server) Cancel(id string) (RunStatus, error) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	run, ok := sv.runs[id]
+	if !ok {
+		return RunStatus{}, ErrNoRun
+	}
+	if run.status.State.IsDone() {
+		return run.status, nil
+	}
+	run.cancel()
+	if run.status.State == RunQueued {
+		// its worker will skip it, so it's done now.
+		sv.done(run, RunCancelled, "cancelled before it started")
+		return run.status, sv.saveStatus(run)
+	}
+	return run.status, nil
+}
+
+// Close cancels every run that hasn't finished and waits for the workers to stop.
+func (sv *Server) Close() {
+	sv.mu.Lock()
+	if sv.closed {
+		sv.mu.Unlock()
+		return
+	}
+	sv.closed = true
+	for _, id := range sv.order {
+		run := sv.runs[id]
+		if run.status.State.IsDone() {
+			continue
+		}
+		run.cancel()
+		if run.status.State == RunQueued {
+			sv.done(run, RunCancelled, "the server shut down before it started")
+			sv.saveStatus(run)
+		}
+	}
+	close(sv.queue)
+	sv.mu.Unlock()
+	sv.wg.Wait()
+}
+
+func (sv *Server) work() {
+	defer sv.wg.Done()
+	for run := range sv.queue {
+		sv.execute(run)
+	}
+}
+
+func (sv *Server) execute(run *serverRun) {
+	sv.mu.Lock()
+	if run.ctx.Err() != nil {
+		sv.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	run.status.State = RunRunning
+	run.status.Started = &started
+	sv.saveStatus(run)
+	sv.mu.Unlock()
+
+	err := sv.simulate(run)
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	switch {
+	case err == nil:
+		{
+			sv.done(run, RunSucceeded, "")
+		}
+	case run.ctx.Err() != nil:
+		{
+			sv.done(run, RunCancelled, err.Error())
+		}
+	default:
+		{
+			sv.done(run, RunFailed, err.Error())
+		}
+	}
+	if err := sv.saveStatus(run); err != nil && run.status.Error == "" {
+		run.status.State = RunFailed
+		run.status.Error = err.Error()
+	}
+}
+
+// simulate runs the run's simulation and saves what it produced, including the time-series and
+// events of a run that didn't finish.
+func (sv *Server) simulate(run *serverRun) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("the run panicked: %v", r)
+		}
+	}()
+
+	config := run.status.Config
+	sim := Scenario{Name: run.status.Name, Config: config}.NewSimulation(config.Seed)
+	sim.MaxDrainTime = sv.MaxDrainTime
+	sim.StallTimeout = sv.StallTimeout
+
+	level := slog.LevelInfo
+	if run.request.EventsLevel != nil {
+		level = *run.request.EventsLevel
+	}
+	events := new(bytes.Buffer)
+	sim.Events.Subscribe(EventFilter{MinimumLevel: level}, NewJSONLEventWriter(events))
+
+	interval := run.request.TimeSeriesInterval
+	if interval <= 0 {
+		interval = sv.TimeSeriesInterval
+	}
+	series := new(bytes.Buffer)
+	// JSON lines is always a format it can write.
+	recorder, _ := NewRecorder(series, RecorderFormatJSONL, interval)
+	metrics := NewMetrics()
+	metrics.Labels = map[string]string{"run": run.status.ID}
+	sim.Observers = append(sim.Observers, recorder, metrics)
+	sv.mu.Lock()
+	run.metrics = metrics
+	sv.mu.Unlock()
+
+	sim.Progress = func(progress RunProgress) {
+		sv.mu.Lock()
+		defer sv.mu.Unlock()
+		run.status.SimTimeS = progress.WallClock.Seconds()
+		run.status.Percent = progress.Percent
+	}
+
+	stats, err := sim.RunContext(run.ctx)
+	if closeErr := recorder.Close(); err == nil {
+		err = closeErr
+	}
+	if saveErr := sv.Store.Save(run.status.ID, ResultEvents, events.Bytes()); err == nil {
+		err = saveErr
+	}
+	if saveErr := sv.Store.Save(run.status.ID, ResultTimeSeries, series.Bytes()); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+	statsJSON, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return sv.Store.Save(run.status.ID, ResultStats, statsJSON)
+}
+
+// done marks a run finished; the server must be locked.
+func (sv *Server) done(run *serverRun, state RunState, message string) {
+	finished := time.Now().UTC()
+	run.status.State = state
+	run.status.Finished = &finished
+	run.status.Error = message
+	run.metrics = nil
+}
+
+// saveStatus stores a run's status, so it's listed again if the server restarts; the server must be locked.
+func (sv *Server) saveStatus(run *serverRun) error {
+	data, err := json.Marshal(run.status)
+	if err != nil {
+		return err
+	}
+	return sv.Store.Save(run.status.ID, ResultStatus, data)
+}
+
+// load lists the runs already in the store; any that hadn't finished were stopped by the server stopping.
+func (sv *Server) load() error {
+	ids, err := sv.Store.Runs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		data, err := sv.Store.Load(id, ResultStatus)
+		if errors.Is(err, ErrNoResult) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var status RunStatus
+		if err := json.Unmarshal(data, &status); err != nil {
+			return fmt.Errorf("run %s: %w", id, err)
+		}
+		if !status.State.IsDone() {
+			status.State = RunFailed
+			status.Error = "the server stopped before the run finished"
+		}
+		sv.runs[id] = &serverRun{status: status}
+		sv.order = append(sv.order, id)
+		if number, err := strconv.Atoi(id); err == nil && number > sv.next {
+			sv.next = number
+		}
+	}
+	sort.SliceStable(sv.order, func(i, j int) bool {
+		left, _ := strconv.Atoi(sv.order[i])
+		right, _ := strconv.Atoi(sv.order[j])
+		return left < right
+	})
+	return nil
+}
+
+// ServeHTTP serves the API, which speaks JSON:
+//
+//	POST /runs                  start a run described by a RunRequest, returning its RunStatus
+//	GET  /runs                  every run's RunStatus
+//	GET  /runs/{id}             a run's RunStatus
+//	POST /runs/{id}/cancel      cancel a queued or running run
+//	GET  /runs/{id}/stats       a succeeded run's SimulationStats
+//	GET  /runs/{id}/timeseries  a finished run's time-series as JSON lines, see RecorderSchema
+//	GET  /runs/{id}/events      a finished run's events as JSON lines, see NewJSONLEventWriter
+//	GET  /metrics               runs by state, and each running run's Metrics, for Prometheus
+//
+// Errors come back as {"error": "..."}.
+func (sv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/metrics" {
+		sv.serveMetrics(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "runs" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+		return
+	}
+
+	switch len(parts) {
+	case 1:
+		{
+			switch r.Method {
+			case http.MethodGet:
+				{
+					writeJSON(w, http.StatusOK, sv.Statuses())
+				}
+			case http.MethodPost:
+				{
+					sv.serveSubmit(w, r)
+				}
+			default:
+				{
+					methodNotAllowed(w, http.MethodGet, http.MethodPost)
+				}
+			}
+		}
+	case 2:
+		{
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
+			status, err := sv.Status(parts[1])
+			if err != nil {
+				writeError(w, http.StatusNotFound, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, status)
+		}
+	case 3:
+		{
+			switch parts[2] {
+			case "cancel":
+				{
+					if r.Method != http.MethodPost {
+						methodNotAllowed(w, http.MethodPost)
+						return
+					}
+					status, err := sv.Cancel(parts[1])
+					if errors.Is(err, ErrNoRun) {
+						writeError(w, http.StatusNotFound, err)
+						return
+					}
+					if err != nil {
+						writeError(w, http.StatusInternalServerError, err)
+						return
+					}
+					writeJSON(w, http.StatusOK, status)
+				}
+			case "stats":
+				{
+					sv.serveResult(w, r, parts[1], ResultStats, "application/json")
+				}
+			case "timeseries":
+				{
+					sv.serveResult(w, r, parts[1], ResultTimeSeries, "application/x-ndjson")
+				}
+			case "events":
+				{
+					sv.serveResult(w, r, parts[1], ResultEvents, "application/x-ndjson")
+				}
+			default:
+				{
+					writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+				}
+			}
+		}
+	}
+}
+
+func (sv *Server) serveSubmit(w http.ResponseWriter, r *http.Request) {
+	var request RunRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", errBadRunRequest, err))
+		return
+	}
+	status, err := sv.Submit(request)
+	switch {
+	case errors.Is(err, errBadRunRequest):
+		{
+			writeError(w, http.StatusBadRequest, err)
+		}
+	case errors.Is(err, ErrServerBusy), errors.Is(err, ErrServerClosed):
+		{
+			writeError(w, http.StatusServiceUnavailable, err)
+		}
+	case err != nil:
+		{
+			writeError(w, http.StatusInternalServerError, err)
+		}
+	default:
+		{
+			w.Header().Set("Location", "/runs/"+status.ID)
+			writeJSON(w, http.StatusAccepted, status)
+		}
+	}
+}
+
+func (sv *Server) serveResult(w http.ResponseWriter, r *http.Request, id, name, contentType string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	status, err := sv.Status(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if !status.State.IsDone() {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is %s", id, status.State))
+		return
+	}
+	data, err := sv.Store.Load(id, name)
+	if errors.Is(err, ErrNoResult) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s %s without a %s: %s", id, status.State, name, status.Error))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+func (sv *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	states := []RunState{RunQueued, RunRunning, RunSucceeded, RunFailed, RunCancelled}
+	counts := map[RunState]int{}
+	var running []*Metrics
+	sv.mu.Lock()
+	for _, id := range sv.order {
+		run := sv.runs[id]
+		counts[run.status.State]++
+		if run.metrics != nil {
+			running = append(running, run.metrics)
+		}
+	}
+	sv.mu.Unlock()
+
+	runs := metricFamily{Name: "train_sim_runs", Help: "Runs the server knows of, by state.", Type: "gauge"}
+	for _, state := range states {
+		runs.Samples = append(runs.Samples, metricSample{Labels: []string{"state", string(state)}, Value: float64(counts[state])})
+	}
+	families := []metricFamily{runs}
+	for _, metrics := range running {
+		families = append(families, metrics.families()...)
+	}
+	w.Header().Set("Content-Type", MetricsContentType)
+	writeMetricFamilies(w, families)
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+}
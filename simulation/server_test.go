@@ -0,0 +1,244 @@
+package simulation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func serverRequest(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func waitForRun(t *testing.T, server *Server, id string) RunStatus {
+	deadline := time.Now().Add(time.Minute)
+	for time.Now().Before(deadline) {
+		status, err := server.Status(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State.IsDone() {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("run %s didn't finish", id)
+	return RunStatus{}
+}
+
+func TestServerRunsAndServesResults(t *testing.T) {
+	assert := assert.New(t)
+
+	server, err := NewServer(testReplicationScenario().Config, NewMemoryResultStore(), 2)
+	assert.Nil(err)
+	defer server.Close()
+
+	response := serverRequest(server, http.MethodPost, "/runs", `{"name": "fewer trains", "config": {"total_train_count": 6, "seed": 3}, "events_level": "warn"}`)
+	assert.Equal(http.StatusAccepted, response.Code)
+	var submitted RunStatus
+	assert.Nil(json.Unmarshal(response.Body.Bytes(), &submitted))
+	assert.Equal("1", submitted.ID)
+	assert.Equal("/runs/1", response.Header().Get("Location"))
+	assert.Equal(6, submitted.Config.TotalTrainCount)
+	assert.Equal(int64(3), submitted.Config.Seed)
+	assert.Equal(testReplicationScenario().Config.TotalPassengerCount, submitted.Config.TotalPassengerCount)
+
+	status := waitForRun(t, server, submitted.ID)
+	assert.Equal(RunSucceeded, status.State, status.Error)
+	assert.NotNil(status.Started)
+	assert.NotNil(status.Finished)
+	assert.Equal(100.0, status.Percent)
+
+	response = serverRequest(server, http.MethodGet, "/runs/1", "")
+	assert.Equal(http.StatusOK, response.Code)
+	response = serverRequest(server, http.MethodGet, "/runs", "")
+	var statuses []RunStatus
+	assert.Nil(json.Unmarshal(response.Body.Bytes(), &statuses))
+	assert.Len(statuses, 1)
+
+	// the stats are those of the same run made directly.
+	response = serverRequest(server, http.MethodGet, "/runs/1/stats", "")
+	assert.Equal(http.StatusOK, response.Code)
+	var stats SimulationStats
+	assert.Nil(json.Unmarshal(response.Body.Bytes(), &stats))
+	direct := testReplicationScenario()
+	direct.Config.TotalTrainCount = 6
+	expected := direct.NewSimulation(3).Simulate()
+	for _, metric := range StatsMetrics() {
+		assert.Equal(metric.Value(expected), metric.Value(&stats), metric.Name)
+	}
+
+	response = serverRequest(server, http.MethodGet, "/runs/1/timeseries", "")
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/x-ndjson", response.Header().Get("Content-Type"))
+	assert.True(strings.HasPrefix(response.Body.String(), `{"type":"header"`))
+
+	response = serverRequest(server, http.MethodGet, "/runs/1/events", "")
+	assert.Equal(http.StatusOK, response.Code)
+	lines := bufio.NewScanner(bytes.NewReader(response.Body.Bytes()))
+	for lines.Scan() {
+		var event map[string]interface{}
+		assert.Nil(json.Unmarshal(lines.Bytes(), &event))
+		assert.NotEqual("INFO", event["level"])
+		assert.NotEqual("DEBUG", event["level"])
+	}
+
+	response = serverRequest(server, http.MethodGet, "/metrics", "")
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(MetricsContentType, response.Header().Get("Content-Type"))
+	assert.True(strings.Contains(response.Body.String(), `train_sim_runs{state="succeeded"} 1`+"\n"))
+	assert.False(strings.Contains(response.Body.String(), "train_sim_trains_in_service"))
+}
+
+func TestServerRejectsBadRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	server, err := NewServer(testReplicationScenario().Config, NewMemoryResultStore(), 1)
+	assert.Nil(err)
+	defer server.Close()
+
+	assert.Equal(http.StatusBadRequest, serverRequest(server, http.MethodPost, "/runs", `{"config": {"total_trian_count": 6}}`).Code)
+	assert.Equal(http.StatusBadRequest, serverRequest(server, http.MethodPost, "/runs", `{"config": {"engine": "warp"}}`).Code)
+	assert.Equal(http.StatusBadRequest, serverRequest(server, http.MethodPost, "/runs", `{"config": {"step_length": 0}}`).Code)
+	assert.Equal(http.StatusBadRequest, serverRequest(server, http.MethodPost, "/runs", `not json`).Code)
+	assert.Equal(http.StatusNotFound, serverRequest(server, http.MethodGet, "/runs/42", "").Code)
+	assert.Equal(http.StatusNotFound, serverRequest(server, http.MethodGet, "/runs/42/stats", "").Code)
+	assert.Equal(http.StatusNotFound, serverRequest(server, http.MethodGet, "/trains", "").Code)
+	response := serverRequest(server, http.MethodDelete, "/runs", "")
+	assert.Equal(http.StatusMethodNotAllowed, response.Code)
+	assert.Equal("GET, POST", response.Header().Get("Allow"))
+	assert.True(strings.Contains(response.Body.String(), `"error"`))
+	assert.Empty(server.Statuses())
+}
+
+func TestServerRequestsDontChangeTheDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	defaults := testReplicationScenario().Config
+	defaults.Services = []Service{
+		{Name: "Express", SkipStations: []string{"Bank"}, Share: 0.5},
+		{Name: "Local", Share: 0.5},
+	}
+	server, err := NewServer(defaults, NewMemoryResultStore(), 1)
+	assert.Nil(err)
+	defer server.Close()
+
+	status, err := server.Submit(RunRequest{Config: json.RawMessage(`{"services": [{"name": "Shuttle", "share": 1}]}`)})
+	assert.Nil(err)
+	assert.Equal([]Service{{Name: "Shuttle", Share: 1}}, status.Config.Services)
+	assert.Equal("Express", server.DefaultConfig.Services[0].Name)
+	assert.Equal([]string{"Bank"}, server.DefaultConfig.Services[0].SkipStations)
+
+	assert.Equal(http.StatusBadRequest, serverRequest(server, http.MethodPost, "/runs", `{"config": {"services": [{"name": "Nowhere", "share": 0}]}}`).Code)
+	assert.Equal(http.StatusBadRequest, serverRequest(server, http.MethodPost, "/runs", `{"config": {"services": [{"name": "Shuttle", "shaer": 1}]}}`).Code)
+}
+
+func TestServerCancelsRuns(t *testing.T) {
+	assert := assert.New(t)
+
+	// one worker, so the second run waits behind the first.
+	config := testReplicationScenario().Config
+	config.TotalTime = 24 * time.Hour
+	server, err := NewServer(config, NewMemoryResultStore(), 1)
+	assert.Nil(err)
+	defer server.Close()
+
+	running, err := server.Submit(RunRequest{})
+	assert.Nil(err)
+	queued, err := server.Submit(RunRequest{})
+	assert.Nil(err)
+	assert.NotEqual(running.Config.Seed, queued.Config.Seed)
+	for {
+		status, _ := server.Status(running.ID)
+		if status.State == RunRunning {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	response := serverRequest(server, http.MethodGet, "/runs/"+running.ID+"/stats", "")
+	assert.Equal(http.StatusConflict, response.Code)
+
+	// the running run's metrics are scraped along with the server's.
+	response = serverRequest(server, http.MethodGet, "/metrics", "")
+	assert.True(strings.Contains(response.Body.String(), `train_sim_runs{state="running"} 1`+"\n"))
+	assert.True(strings.Contains(response.Body.String(), `train_sim_runs{state="queued"} 1`+"\n"))
+	for !strings.Contains(response.Body.String(), `train_sim_sim_time_seconds{run="`+running.ID+`"}`) {
+		time.Sleep(time.Millisecond)
+		response = serverRequest(server, http.MethodGet, "/metrics", "")
+	}
+
+	response = serverRequest(server, http.MethodPost, "/runs/"+queued.ID+"/cancel", "")
+	assert.Equal(http.StatusOK, response.Code)
+	status, _ := server.Status(queued.ID)
+	assert.Equal(RunCancelled, status.State)
+
+	_, err = server.Cancel(running.ID)
+	assert.Nil(err)
+	status = waitForRun(t, server, running.ID)
+	assert.Equal(RunCancelled, status.State)
+	assert.True(status.SimTimeS < config.TotalTime.Seconds())
+
+	// what it got through before it was cancelled is kept, but there are no stats.
+	assert.Equal(http.StatusOK, serverRequest(server, http.MethodGet, "/runs/"+running.ID+"/timeseries", "").Code)
+	assert.Equal(http.StatusNotFound, serverRequest(server, http.MethodGet, "/runs/"+running.ID+"/stats", "").Code)
+}
+
+func TestServerKeepsResultsOnDisk(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := os.MkdirTemp("", "train-sim-server")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	server, err := NewServer(testReplicationScenario().Config, NewDiskResultStore(dir), 1)
+	assert.Nil(err)
+	submitted, err := server.Submit(RunRequest{Name: "kept"})
+	assert.Nil(err)
+	waitForRun(t, server, submitted.ID)
+	server.Close()
+
+	// a run that was going when the server stopped.
+	interrupted, _ := json.Marshal(RunStatus{ID: "2", State: RunRunning})
+	assert.Nil(NewDiskResultStore(dir).Save("2", ResultStatus, interrupted))
+
+	restarted, err := NewServer(testReplicationScenario().Config, NewDiskResultStore(dir), 1)
+	assert.Nil(err)
+	defer restarted.Close()
+	statuses := restarted.Statuses()
+	assert.Len(statuses, 2)
+	assert.Equal("kept", statuses[0].Name)
+	assert.Equal(RunSucceeded, statuses[0].State)
+	assert.Equal(RunFailed, statuses[1].State)
+	assert.Equal(http.StatusOK, serverRequest(restarted, http.MethodGet, "/runs/1/stats", "").Code)
+
+	next, err := restarted.Submit(RunRequest{})
+	assert.Nil(err)
+	assert.Equal("3", next.ID)
+}
+
+func TestServerRunsGiveUpDraining(t *testing.T) {
+	assert := assert.New(t)
+
+	// trains are still out when service ends, so a run that can't wait for them fails right then.
+	config := testReplicationScenario().Config
+	server, err := NewServer(config, NewMemoryResultStore(), 1)
+	assert.Nil(err)
+	defer server.Close()
+	server.MaxDrainTime = time.Nanosecond
+
+	submitted, err := server.Submit(RunRequest{})
+	assert.Nil(err)
+	status := waitForRun(t, server, submitted.ID)
+	assert.Equal(RunFailed, status.State)
+	assert.True(status.SimTimeS < (config.TotalTime + time.Minute).Seconds())
+}
@@ -0,0 +1,214 @@
+package simulation
+
+import (
+	"math"
+	"time"
+)
+
+// ExpressLocalServices returns an express service that only stops at the given stations
+// and a local service that stops everywhere, with `expressShare` of the fleet running express.
+func ExpressLocalServices(stations []*Station, expressStops []string, expressShare float64) []*Service {
+	stops := map[string]bool{}
+	for _, name := range expressStops {
+		stops[name] = true
+	}
+
+	express := &Service{Name: "Express", Share: expressShare}
+	for _, station := range stations {
+		if !stops[station.Name] {
+			express.SkipStations = append(express.SkipStations, station.Name)
+		}
+	}
+
+	return []*Service{
+		{Name: "Local", Share: 1.0 - expressShare},
+		express,
+	}
+}
+
+// Service is a stopping pattern trains can run, e.g. a local that stops everywhere
+// or an express that runs through some stations without stopping.
+// Trains always stop at the termini to turn around.
+type Service struct {
+	Name         string   `json:"name"`
+	SkipStations []string `json:"skip_stations,omitempty"`
+
+	// Share is the fraction of the fleet running this service.
+	Share float64 `json:"share"`
+}
+
+// copy returns a copy of the service that doesn't share its skipped stations.
+func (sv *Service) copy() Service {
+	copied := *sv
+	copied.SkipStations = append([]string(nil), sv.SkipStations...)
+	return copied
+}
+
+// UnmarshalJSON replaces the service rather than merging into it, so a config's
+// services decoded over another's don't pick up the other's skipped stations.
+func (sv *Service) UnmarshalJSON(data []byte) error {
+	type plain Service
+	var decoded plain
+	if err := decodeStrictly(data, &decoded); err != nil {
+		return err
+	}
+	*sv = Service(decoded)
+	return nil
+}
+
+// StopsAt returns if the service stops at the named station.
+func (sv *Service) StopsAt(name string) bool {
+	for _, skipped := range sv.SkipStations {
+		if skipped == name {
+			return false
+		}
+	}
+	return true
+}
+
+func (sv *Service) String() string {
+	return sv.Name
+}
+
+// AssignServices spreads the services across the fleet in proportion to their shares,
+// interleaving them so that each service runs at a roughly even headway.
+func AssignServices(trainCount int, services []*Service) []*Service {
+	if len(services) == 0 {
+		return make([]*Service, trainCount)
+	}
+
+	var total float64
+	for _, service := range services {
+		total += service.Share
+	}
+
+	assigned := make([]int, len(services))
+	var assignments []*Service
+	for x := 0; x < trainCount; x++ {
+		best := 0
+		var bestDeficit float64 = math.Inf(-1)
+		for index, service := range services {
+			deficit := (service.Share/total)*float64(x+1) - float64(assigned[index])
+			if deficit > bestDeficit {
+				best = index
+				bestDeficit = deficit
+			}
+		}
+		assigned[best]++
+		assignments = append(assignments, services[best])
+	}
+	return assignments
+}
+
+// RunTime returns how long a train takes to go `distanceMeters` from a stand to a stand,
+// accelerating to at most `maximumSpeed` and braking at the end.
+func RunTime(distanceMeters, maximumSpeed, acceleration, braking float64) time.Duration {
+	if distanceMeters <= 0 {
+		return 0
+	}
+
+	accelerationDistance := (maximumSpeed * maximumSpeed) / (2.0 * acceleration)
+	brakingDistance := (maximumSpeed * maximumSpeed) / (2.0 * braking)
+
+	var seconds float64
+	if accelerationDistance+brakingDistance <= distanceMeters {
+		cruiseDistance := distanceMeters - accelerationDistance - brakingDistance
+		seconds = maximumSpeed/acceleration + maximumSpeed/braking + cruiseDistance/maximumSpeed
+	} else {
+		peakSpeed := math.Sqrt((2.0 * distanceMeters * acceleration * braking) / (acceleration + braking))
+		seconds = peakSpeed/acceleration + peakSpeed/braking
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ServiceOption is one way a passenger could get to their destination.
+type ServiceOption struct {
+	Service         *Service
+	ExpectedWait    time.Duration
+	InMotion        time.Duration
+	GeneralizedCost float64
+}
+
+// ServiceOptions returns the services that stop at both the origin and the destination,
+// with the expected wait, ride time and generalized cost of each for the passenger.
+func (s *Simulation) ServiceOptions(origin *Station, p *Passenger) []ServiceOption {
+	var options []ServiceOption
+	for _, service := range s.Services {
+		if !service.StopsAt(origin.Name) || !service.StopsAt(p.Destination) {
+			continue
+		}
+
+		var headway time.Duration
+		if service.Share > 0 {
+			headway = time.Duration(float64(s.AverageTimeBetweenTrains) / service.Share)
+		}
+
+		option := ServiceOption{
+			Service:      service,
+			ExpectedWait: headway / 2,
+			InMotion:     s.rideTime(service, origin, p.IsOutBound, p.Destination),
+		}
+		if p.Segment != nil {
+			option.GeneralizedCost = p.Segment.GeneralizedCost(option.ExpectedWait, option.InMotion, 0)
+		} else {
+			option.GeneralizedCost = WaitTimeWeight*option.ExpectedWait.Hours() + option.InMotion.Hours()
+		}
+		options = append(options, option)
+	}
+	return options
+}
+
+func (s *Simulation) rideTime(service *Service, origin *Station, isOutbound bool, destination string) time.Duration {
+	var total time.Duration
+	station := origin
+	for station.Name != destination {
+		track := station.TrackFor(isOutbound)
+		if track == nil {
+			break
+		}
+		total += RunTime(track.DistanceMeters, s.TrainMaximumSpeed, s.TrainAverageAcceleration, s.TrainAverageBraking)
+		station = track.End
+		if station.Name != destination && service.StopsAt(station.Name) {
+			total += s.AverageTimeInStation
+		}
+	}
+	return total
+}
+
+// ChooseService picks which service a passenger will ride with a logit model over
+// the generalized cost of each option.
+func (s *Simulation) ChooseService(origin *Station, p *Passenger) {
+	p.ChosenService = ""
+	if len(s.Services) < 2 {
+		return
+	}
+
+	options := s.ServiceOptions(origin, p)
+	if len(options) == 0 {
+		return
+	}
+
+	lowest := options[0].GeneralizedCost
+	for _, option := range options {
+		if option.GeneralizedCost < lowest {
+			lowest = option.GeneralizedCost
+		}
+	}
+
+	var total float64
+	weights := make([]float64, len(options))
+	for index, option := range options {
+		weights[index] = math.Exp(-s.RouteChoiceSensitivity * (option.GeneralizedCost - lowest))
+		total += weights[index]
+	}
+
+	draw := s.Provider.Float64() * total
+	for index, option := range options {
+		draw -= weights[index]
+		if draw < 0 {
+			p.ChosenService = option.Service.Name
+			return
+		}
+	}
+	p.ChosenService = options[len(options)-1].Service.Name
+}
@@ -0,0 +1,79 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestRunTime(t *testing.T) {
+	assert := assert.New(t)
+
+	// 10 m/s, 1 m/s^2 each way: 50m to get up to speed, 50m to stop, 100m cruising.
+	assert.Equal(30*time.Second, RunTime(200, 10, 1, 1))
+
+	// too short to reach top speed: peaks at 5 m/s.
+	assert.Equal(10*time.Second, RunTime(25, 10, 1, 1))
+	assert.Zero(RunTime(0, 10, 1, 1))
+}
+
+func TestAssignServices(t *testing.T) {
+	assert := assert.New(t)
+
+	local := &Service{Name: "Local", Share: 0.75}
+	express := &Service{Name: "Express", Share: 0.25}
+	assignments := AssignServices(8, []*Service{local, express})
+	assert.Len(assignments, 8)
+
+	var expressCount int
+	for index, service := range assignments {
+		if service == express {
+			expressCount++
+			if index > 0 {
+				assert.Equal(local, assignments[index-1])
+			}
+		}
+	}
+	assert.Equal(2, expressCount)
+
+	for _, service := range AssignServices(3, nil) {
+		assert.Nil(service)
+	}
+}
+
+func TestTrainStopsAt(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	services := ExpressLocalServices(sim.Stations, []string{"96 Street", "Times Square-42 Street"}, 0.5)
+	train := sim.Yard.Dequeue()
+	train.Service = services[1]
+
+	assert.True(train.StopsAt(sim.Stations[8]))
+	assert.False(train.StopsAt(sim.Stations[7]))
+	assert.True(train.StopsAt(sim.InBoundTerminus()))
+	assert.True(train.StopsAt(sim.OutBoundTerminus()))
+	assert.Zero(train.DwellTime(sim.Stations[7]))
+}
+
+func TestSimulationChooseService(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.Services = ExpressLocalServices(sim.Stations, []string{"96 Street", "Times Square-42 Street", "14 Street"}, 0.5)
+	sim.RouteChoiceSensitivity = 1000.0
+
+	origin := sim.Stations[6]
+	p := &Passenger{ID: 1, Segment: DefaultSegments()[0], Destination: "14 Street", IsOutBound: true}
+
+	options := sim.ServiceOptions(origin, p)
+	assert.Len(options, 2)
+	assert.True(options[1].InMotion < options[0].InMotion)
+
+	sim.ChooseService(origin, p)
+	assert.Equal("Express", p.ChosenService)
+
+	p.Destination = "72 Street"
+	sim.ChooseService(origin, p)
+	assert.Equal("Local", p.ChosenService)
+}
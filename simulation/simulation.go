@@ -2,13 +2,17 @@ package simulation
 
 import (
 	"fmt"
+	"log/slog"
+	"math"
 	"math/rand"
+	"os"
+	"strconv"
 	"time"
-
-	"github.com/blendlabs/go-util"
 )
 
 func New(stepLength time.Duration, totalTime time.Duration, pauseTime *time.Duration) *Simulation {
+	seed := time.Now().Unix()
+	source := newCountingSource(seed)
 	return &Simulation{
 		StepLength: stepLength,
 		TotalTime:  totalTime,
@@ -17,7 +21,7 @@ func New(stepLength time.Duration, totalTime time.Duration, pauseTime *time.Dura
 		Stasis:   false,
 		Complete: false,
 
-		Provider: rand.New(rand.NewSource(time.Now().Unix())),
+		Seed: seed,
 
 		TotalPassengerCount: 1 << 20,
 		TotalTrainCount:     32,
@@ -32,6 +36,23 @@ func New(stepLength time.Duration, totalTime time.Duration, pauseTime *time.Dura
 
 		AverageTimeBetweenTrains: 150 * time.Second,
 		AverageTimeInStation:     30 * time.Second,
+
+		StepFreeBoardingTime: 15 * time.Second,
+
+		RouteChoiceSensitivity: 1.0,
+
+		FarePolicy: FlatFare{Amount: 2.90},
+
+		OperatingCosts: DefaultOperatingCostModel(),
+
+		Events: NewEventLog(DefaultEventLogCapacity),
+
+		MaxDrainTime:     4 * time.Hour,
+		StallTimeout:     30 * time.Minute,
+		ProgressInterval: time.Second,
+
+		Provider: rand.New(source),
+		source:   source,
 	}
 }
 
@@ -39,6 +60,8 @@ type Simulation struct {
 	StepLength time.Duration
 	TotalTime  time.Duration
 	PauseTime  *time.Duration
+	// DisplayWidth is how wide a terminal Display draws for; zero uses $COLUMNS, or 100 without it.
+	DisplayWidth int
 
 	TotalPassengerCount int
 	TotalTrainCount     int
@@ -58,12 +81,61 @@ type Simulation struct {
 	// AverageTimeBetweenTrains is the average time between trains leaving the yard.
 	AverageTimeBetweenTrains time.Duration
 
+	// BunchingThreshold is the headway below which two trains count as bunched.
+	// Zero uses half of AverageTimeBetweenTrains.
+	BunchingThreshold time.Duration
+
 	// AverageTimeInStation is the average time the train waits in the station.
 	AverageTimeInStation time.Duration
 
+	// UseStationLayouts gives each station entrances and vertical circulation
+	// so passengers take time to walk between the street and the platform.
+	UseStationLayouts bool
+
+	// WheelchairShare and StrollerShare are the fractions of passengers that need a step-free route.
+	WheelchairShare float64
+	StrollerShare   float64
+
+	// StepFreeBoardingTime is the extra dwell a step-free rider adds getting on or off a train.
+	StepFreeBoardingTime time.Duration
+
+	// ElevatorOutages are scheduled windows where elevators are out of service.
+	ElevatorOutages []ElevatorOutage
+
+	// StepFreeUnableToTravel counts step-free riders who couldn't start their trip at all; StepFreeStats
+	// adds those stranded part way.
+	StepFreeUnableToTravel int
+
+	// StartOfDay is the time of day the simulation starts at.
+	StartOfDay time.Duration
+
+	// Segments are the kinds of passenger riding the line.
+	Segments []*Segment
+
+	// Services are the stopping patterns trains run. With none set every train stops everywhere.
+	Services []*Service
+
+	// RouteChoiceSensitivity is how strongly passengers prefer the cheapest service option,
+	// per unit of generalized cost.
+	RouteChoiceSensitivity float64
+
+	// FarePolicy prices each completed trip for revenue projections.
+	FarePolicy FarePolicy
+
+	// Concessions are the discounted fare groups and the share of passengers in each, none by default.
+	// Drawing a rider's concession uses the random provider, so setting them changes a seeded run.
+	Concessions []*Concession
+
+	// OperatingCosts are the unit costs used to price the service that was run.
+	OperatingCosts *OperatingCostModel
+
+	// Incidents are the station incidents that have held trains, in the order they started.
+	Incidents []Incident
+
 	WallClock time.Duration
 
 	Stasis   bool
+	StasisAt time.Duration
 	Complete bool
 
 	Stations []*Station
@@ -73,20 +145,41 @@ type Simulation struct {
 	TotalAverageRidership int
 	LastTrainReleased     time.Duration
 
+	// Seed is what Provider was last seeded with; see SetSeed.
+	Seed     int64
 	Provider *rand.Rand
 
-	LogEntries []string
-}
+	// Engine is how the run advances, EngineStepped or EngineEvent; empty is stepped.
+	Engine string
+
+	// Observers are told about every step, e.g. to record time-series.
+	Observers []StepObserver
 
-func (s *Simulation) logf(format string, args ...interface{}) {
-	message := fmt.Sprintf(format, args...)
-	s.LogEntries = append(s.LogEntries, fmt.Sprintf("%v - %s\n", s.WallClock, message))
+	// Events are the recent things that happened, for display and for subscribers.
+	Events *EventLog
+
+	// MaxDrainTime is how long RunContext waits after TotalTime for every train to get back to the yard; zero waits forever.
+	MaxDrainTime time.Duration
+	// StallTimeout is how long RunContext waits for a train to move before giving up; zero waits forever.
+	StallTimeout time.Duration
+	// Progress, if set, is told how RunContext is getting on about every ProgressInterval of real time.
+	Progress         func(RunProgress)
+	ProgressInterval time.Duration
+
+	// source is what Provider draws from, counting draws so checkpoints can restore it.
+	source *countingSource
+	// events is the event engine, once it's started.
+	events *eventEngine
 }
 
 func (s *Simulation) GeneratePassengers() {
 	s.People = NewQueueOfPassenger()
 	for x := 0; x < s.TotalPassengerCount; x++ {
-		s.People.Enqueue(NewPassenger(s.Provider, x+1))
+		p := NewPassenger(s.Provider, x+1)
+		p.Mobility = s.randomMobilityNeed()
+		p.Segment = s.randomSegment()
+		p.Concession = s.randomConcession()
+		s.People.Enqueue(p)
 	}
 }
 
@@ -169,13 +262,27 @@ func (s *Simulation) GenerateStations() {
 	s.Stations[31].LinkWith(s.Stations[32], 552)
 	s.Stations[32].LinkWith(s.Stations[33], 411)
 	//-----Terminus------
+
+	s.ComputeChainage()
+	for _, station := range s.Stations {
+		station.Events = s.Events
+	}
+}
+
+func (s *Simulation) GenerateStationLayouts() {
+	for _, station := range s.Stations {
+		station.Layout = DefaultStationLayout(station.Name, station.RidersPerDayMean)
+	}
 }
 
 func (s *Simulation) GenerateTrains() {
 	s.Yard = NewQueueOfTrain()
+	services := AssignServices(s.TotalTrainCount, s.Services)
 	for x := 0; x < s.TotalTrainCount; x++ {
 		t := NewTrain(x, "IRT 3", s.TrainMaximumSpeed, s.TrainAverageAcceleration, s.TrainAverageBraking, s.AverageTimeInStation)
+		t.Service = services[x]
 		t.Capacity = s.TrainCapacity
+		t.StepFreeBoardingTime = s.StepFreeBoardingTime
 		s.Yard.Enqueue(t)
 	}
 }
@@ -197,6 +304,11 @@ func (s *Simulation) ShouldReleaseTrainFromYard() bool {
 		return false
 	}
 
+	// wait for the last train released to clear the platform.
+	if s.Stations[0].OutBoundTrain != nil {
+		return false
+	}
+
 	return s.WallClock-s.LastTrainReleased >= s.AverageTimeBetweenTrains
 }
 
@@ -263,11 +375,17 @@ func (s *Simulation) StationIncident(station *Station) {
 	didIncidentOccur := s.Provider.Float64() < ridershipRatio*nominalLikelihood
 
 	if didIncidentOccur {
-		s.logf("Station Incident at %s, holding train for %v", station.Name, s.AverageIncidentDelay)
-		trainAffected.Hold(s.WallClock)
+		s.StartIncident(station, trainAffected)
 	}
 }
 
+// StartIncident holds a train at its platform for AverageIncidentDelay, as if an incident had happened there.
+func (s *Simulation) StartIncident(station *Station, train *Train) {
+	s.publishTrain(EventIncidentStarted, slog.LevelWarn, train, station, "Station Incident at %s, holding train for %v", station.Name, s.AverageIncidentDelay)
+	train.Hold(s.WallClock)
+	s.recordIncidentStart(station, train)
+}
+
 func (s *Simulation) ReleaseTrainsOnHold(station *Station) {
 	if station.OutBoundTrain == nil && station.InBoundTrain == nil {
 		return
@@ -278,11 +396,12 @@ func (s *Simulation) ReleaseTrainsOnHold(station *Station) {
 }
 
 func (s *Simulation) ReleaseTrainOnHold(station *Station, train *Train) {
-	if train != nil {
+	if train != nil && !train.HeldByHand {
 		if train.Signal == SignalHold {
 			if s.WallClock-train.HeldAtStation >= s.AverageIncidentDelay {
-				s.logf("Station Incident resolved at %s", station.Name)
+				s.publishTrain(EventIncidentResolved, slog.LevelInfo, train, station, "Station Incident resolved at %s", station.Name)
 				train.SendSignal(SignalGo)
+				s.recordIncidentEnd(train)
 			}
 		}
 	}
@@ -304,6 +423,10 @@ func (s *Simulation) PassengersArrive(station *Station) {
 	pdf := station.PassengerArrivalPDF(s.Provider, s.StepLength)
 	if s.Provider.Float64() <= pdf {
 		passenger := s.People.Dequeue()
+		if passenger.Segment != nil && s.Provider.Float64() > passenger.Segment.ArrivalLikelihood(s.TimeOfDay()) {
+			s.People.Enqueue(passenger)
+			return
+		}
 		s.PassengerArrivesAtStation(station, passenger)
 	}
 }
@@ -315,32 +438,119 @@ func (s *Simulation) PassengerArrivesAtStation(station *Station, passenger *Pass
 	//figure out outbound | inbound
 	passenger.IsOutBound = s.DestinationIsOutbound(station, passenger.Destination)
 
-	if passenger.IsOutBound && station.OutBoundTrain != nil && len(station.OutBoundTrain.Passengers) < station.OutBoundTrain.Capacity {
-		passenger.Waiting = append(passenger.Waiting, 0)
+	if passenger.NeedsStepFree() && !s.PlanStepFreeTrip(station, passenger) {
+		if s.Events.Wants(slog.LevelWarn) {
+			e := newEvent(s.WallClock, EventStepFreeUnavailable, slog.LevelWarn, "%v rider %v can't travel step-free from %s", passenger.Mobility, passenger, station.Name)
+			e.PassengerID = passenger.ID
+			e.Station = station.Name
+			s.Events.Publish(e)
+		}
+		s.StepFreeUnableToTravel++
+		s.People.Enqueue(passenger)
+		return
+	}
+
+	passenger.Entering(s.WallClock, station)
+
+	if station.Layout != nil {
+		station.Layout.BeginAccess(s.WallClock, passenger, station.Layout.ChooseEntrance(s.Provider, passenger))
+		return
+	}
+	s.PassengerReachesPlatform(station, passenger)
+}
+
+func (s *Simulation) PassengerReachesPlatform(station *Station, passenger *Passenger) {
+	s.ChooseService(station, passenger)
+
+	if passenger.IsOutBound && s.CanBoardWaitingTrain(station, station.OutBoundTrain, passenger) {
+		passenger.StartedWaiting = s.WallClock
+		passenger.Boarding(s.WallClock, station.OutBoundTrain)
+		station.OutBoundTrain.AddBoardingTime(passenger)
 		station.OutBoundTrain.Passengers = append(station.OutBoundTrain.Passengers, passenger)
-	} else if !passenger.IsOutBound && station.InBoundTrain != nil && len(station.InBoundTrain.Passengers) < station.InBoundTrain.Capacity {
-		passenger.Waiting = append(passenger.Waiting, 0)
+		station.Boardings++
+		station.publishPassenger(s.WallClock, EventPassengerBoarded, station.OutBoundTrain, passenger, "boarded")
+	} else if !passenger.IsOutBound && s.CanBoardWaitingTrain(station, station.InBoundTrain, passenger) {
+		passenger.StartedWaiting = s.WallClock
+		passenger.Boarding(s.WallClock, station.InBoundTrain)
+		station.InBoundTrain.AddBoardingTime(passenger)
 		station.InBoundTrain.Passengers = append(station.InBoundTrain.Passengers, passenger)
+		station.Boardings++
+		station.publishPassenger(s.WallClock, EventPassengerBoarded, station.InBoundTrain, passenger, "boarded")
 	} else {
 		passenger.StartedWaiting = s.WallClock
 		station.WaitingPassengers.Enqueue(passenger)
 	}
 }
 
+// CanBoardWaitingTrain returns if a passenger reaching the platform can step straight onto the train in the station.
+func (s *Simulation) CanBoardWaitingTrain(station *Station, train *Train, passenger *Passenger) bool {
+	if train == nil || !train.StopsAt(station) {
+		return false
+	}
+	if len(train.Passengers) >= train.Capacity {
+		return false
+	}
+	return passenger.WillBoard(train)
+}
+
+func (s *Simulation) StationCirculation(station *Station) {
+	if station.Layout == nil {
+		return
+	}
+
+	reachedPlatform, exited := station.Layout.Step(s.WallClock, s.StepLength)
+	for _, passenger := range reachedPlatform {
+		s.PassengerReachesPlatform(station, passenger)
+	}
+	for _, passenger := range exited {
+		station.PassengerExits(s.WallClock, passenger)
+	}
+}
+
 func (s *Simulation) IsComplete() {
-	s.logf("Simulation Complete, draining line.")
+	s.publish(EventComplete, slog.LevelInfo, "Simulation Complete, draining line.")
 	s.Complete = true
 }
 
 func (s *Simulation) IsAtStasis() {
-	s.logf("Simulation At Stasis, starting passenger arrivals.")
+	s.publish(EventStasisReached, slog.LevelInfo, "Simulation At Stasis, starting passenger arrivals.")
 	s.Stasis = true
+	s.StasisAt = s.WallClock
 }
 
 func (s *Simulation) AllTrainsReturned() bool {
 	return s.Yard.Len() == s.TotalTrainCount
 }
 
+// AllTrains returns every train, whether it's in the yard or out on the line.
+func (s *Simulation) AllTrains() []*Train {
+	var trains []*Train
+	if s.Yard != nil {
+		trains = s.Yard.Values()
+	}
+	return append(trains, s.TrainsInService()...)
+}
+
+// TrainsInService returns the trains out on the line, in stations or on the tracks.
+func (s *Simulation) TrainsInService() []*Train {
+	var trains []*Train
+	for _, station := range s.Stations {
+		if station.OutBoundTrain != nil {
+			trains = append(trains, station.OutBoundTrain)
+		}
+		if station.InBoundTrain != nil {
+			trains = append(trains, station.InBoundTrain)
+		}
+		if station.OutBoundTrack != nil {
+			trains = append(trains, station.OutBoundTrack.Trains...)
+		}
+		if station.InBoundTrack != nil {
+			trains = append(trains, station.InBoundTrack.Trains...)
+		}
+	}
+	return trains
+}
+
 func (s *Simulation) OutBoundTerminus() *Station {
 	return s.Stations[len(s.Stations)-1]
 }
@@ -354,15 +564,20 @@ func (s *Simulation) Step() {
 		s.LastTrainReleased = s.WallClock
 		t := s.Yard.Dequeue()
 		t.HasLeftYard(s.WallClock)
+		s.publishTrain(EventTrainReleased, slog.LevelInfo, t, s.Stations[0], "Releasing [%d] from yard, %d left in yard", t.ID, s.Yard.Len())
 		t.ArrivesAtStation(s.WallClock, s.Stations[0])
-		s.logf("Releasing [%d] from yard, %d left in yard", t.ID, s.Yard.Len())
 	}
 
+	s.ApplyElevatorOutages()
+
 	for _, station := range s.Stations {
 		s.PassengersArrive(station)
+		s.StationCirculation(station)
+		s.PassengersGiveUp(station)
 		station.CheckWaitingTrains(s.WallClock)
 		s.StationIncident(station)
 		s.ReleaseTrainsOnHold(station)
+		station.RecordOccupancy(s.WallClock)
 	}
 
 	// do outbound trains
@@ -382,7 +597,7 @@ func (s *Simulation) Step() {
 	station = s.InBoundTerminus()
 	if station.InBoundTrain != nil {
 		train := station.InBoundTrain
-		s.logf("Returning [%d] to the yard", train.ID)
+		s.publishTrain(EventTrainReturned, slog.LevelInfo, train, station, "Returning [%d] to the yard", train.ID)
 		station.TrainDeparts(train)
 		train.ReturnsToYard(s.WallClock, station)
 		s.Yard.Enqueue(train)
@@ -392,82 +607,101 @@ func (s *Simulation) Step() {
 	}
 
 	s.WallClock += s.StepLength
+
+	for _, observer := range s.Observers {
+		observer.Observe(s)
+	}
 }
 
+// Run simulates the whole day and prints the stats.
 func (s *Simulation) Run() {
+	stats := s.Simulate()
+	fmt.Printf("Simulation Stats:\n%v", stats)
+}
+
+// Simulate runs the whole day, until every train is back in the yard, and returns the stats without printing them.
+func (s *Simulation) Simulate() *SimulationStats {
+	s.Generate()
+	return s.Finish()
+}
+
+// Generate sets up the passengers, trains and stations for a run.
+func (s *Simulation) Generate() {
 	s.GeneratePassengers()
 	s.GenerateTrains()
 	s.GenerateStations()
+	if s.UseStationLayouts {
+		s.GenerateStationLayouts()
+	}
 	s.CalculateTotalAverageRidership()
+}
 
-	for s.WallClock < s.TotalTime {
-		s.Step()
-		if s.PauseTime != nil {
-			s.Display()
-			time.Sleep(*s.PauseTime)
-		}
+// RunUntil runs a generated simulation until the wall clock reaches `until`, or the run is over,
+// so it can be checkpointed or inspected part way through.
+func (s *Simulation) RunUntil(until time.Duration) {
+	if s.Engine == EngineEvent {
+		s.eventEngine().runUntil(until)
+		return
 	}
-
-	s.IsComplete()
-
-	for !s.AllTrainsReturned() {
-		s.Step()
-		if s.PauseTime != nil {
-			s.Display()
-			time.Sleep(*s.PauseTime)
-		}
+	for s.WallClock < until && !s.advance() {
 	}
-
-	stats := s.ComputeStats()
-	fmt.Printf("Simulation Stats:\n%v", stats)
 }
 
-// --------------------------------------------------------------------------------
-// Stats & Display Methods
-// --------------------------------------------------------------------------------
-
-func (s *Simulation) ComputeStats() *SimulationStats {
-	return &SimulationStats{
-		AveragePassengerWaitingTime: s.computeMeanPassengerWaitingTime(),
-		AveragePassengerTripTime:    s.computeMeanPassengerTripTime(),
-		AverageTrainRoundTripTime:   s.computeMeanRoundTripTime(),
+// Finish runs a generated simulation until every train is back in the yard and returns the stats.
+func (s *Simulation) Finish() *SimulationStats {
+	if s.Engine == EngineEvent {
+		s.eventEngine().runUntil(math.MaxInt64)
+		return s.ComputeStats()
 	}
+	for !s.advance() {
+	}
+	return s.ComputeStats()
 }
 
-func (s *Simulation) computeMeanPassengerWaitingTime() time.Duration {
-	var times []time.Duration
-	for x := 0; x < s.People.Len(); x++ {
-		p := s.People.Dequeue()
-		if len(p.Waiting) != 0 {
-			times = append(times, util.MeanOfDuration(p.Waiting))
-		}
-		s.People.Enqueue(p)
-	}
-	return util.MeanOfDuration(times)
+// IsFinished returns if the day is over and every train is back in the yard.
+func (s *Simulation) IsFinished() bool {
+	return s.Complete && s.AllTrainsReturned()
 }
 
-func (s *Simulation) computeMeanPassengerTripTime() time.Duration {
-	var times []time.Duration
-	for x := 0; x < s.People.Len(); x++ {
-		p := s.People.Dequeue()
-		if len(p.InMotion) != 0 {
-			times = append(times, util.MeanOfDuration(p.InMotion))
+// advance takes the next step of the run, returning true instead once the run is over.
+func (s *Simulation) advance() bool {
+	if s.WallClock >= s.TotalTime {
+		if !s.Complete {
+			s.IsComplete()
+		}
+		if s.AllTrainsReturned() {
+			return true
 		}
-		s.People.Enqueue(p)
 	}
-	return util.MeanOfDuration(times)
+	s.Step()
+	if s.PauseTime != nil {
+		s.Display()
+		time.Sleep(*s.PauseTime)
+	}
+	return false
 }
 
-func (s *Simulation) computeMeanRoundTripTime() time.Duration {
-	var times []time.Duration
-	for x := 0; x < s.Yard.Len(); x++ {
-		t := s.Yard.Dequeue()
-		if len(t.RoundTripTimes) != 0 {
-			times = append(times, util.MeanOfDuration(t.RoundTripTimes))
-		}
-		s.Yard.Enqueue(t)
-	}
-	return util.MeanOfDuration(times)
+// --------------------------------------------------------------------------------
+// Stats & Display Methods
+// --------------------------------------------------------------------------------
+
+func (s *Simulation) ComputeStats() *SimulationStats {
+	distributions := s.computeDistributionStats()
+	stats := &SimulationStats{
+		AveragePassengerWaitingTime: distributions.Wait.Mean,
+		AveragePassengerTripTime:    distributions.InVehicle.Mean,
+		AveragePassengerJourneyTime: distributions.Journey.Mean,
+		AverageTrainRoundTripTime:   distributions.RoundTrip.Mean,
+		Distributions:               distributions,
+		Stations:                    s.computeStationStats(),
+		Tracks:                      s.computeTrackStats(),
+		Regularity:                  s.computeRegularityStats(),
+		StepFree:                    s.computeStepFreeStats(),
+		Segments:                    s.computeSegmentStats(),
+		Revenue:                     s.computeRevenueStats(),
+	}
+	stats.CostBenefit = s.computeCostBenefit(stats.Revenue)
+	return stats
 }
 
 func (s *Simulation) Display() {
@@ -482,6 +716,11 @@ func (s *Simulation) Display() {
 	}
 	fmt.Printf("Clock: %v%s\n\n", s.WallClock, status)
 
+	for _, line := range s.Schematic(s.displayWidth()).Lines() {
+		fmt.Println(line)
+	}
+	fmt.Println()
+
 	for _, station := range s.Stations {
 		if station.OutBoundTrain != nil && station.InBoundTrain != nil {
 			outWaiting := s.WallClock - station.OutBoundTrain.ArrivedAtStation
@@ -496,6 +735,9 @@ func (s *Simulation) Display() {
 		} else {
 			fmt.Printf("%s - Waiting: %d\n", station.Name, station.WaitingPassengers.Len())
 		}
+		if station.Layout != nil {
+			fmt.Printf("  Entering: %d Exiting: %d\n", station.Layout.AccessCount(), station.Layout.EgressCount())
+		}
 		if station.OutBoundTrack != nil {
 			for _, train := range station.OutBoundTrack.Trains {
 				fmt.Printf("%v ", train)
@@ -509,29 +751,20 @@ func (s *Simulation) Display() {
 
 	fmt.Println()
 	fmt.Println("Log Entries:")
-	for _, entry := range last(s.LogEntries, 10) {
-		fmt.Print(entry)
+	recent := s.Events.Recent(10)
+	for x := len(recent) - 1; x >= 0; x-- {
+		fmt.Println(recent[x])
 	}
 }
 
-func last(values []string, count int) []string {
-	var lastValues []string
-	var valuesLen = len(values)
-	if valuesLen == 0 {
-		return lastValues
+func (s *Simulation) displayWidth() int {
+	if s.DisplayWidth > 0 {
+		return s.DisplayWidth
 	}
-
-	if valuesLen <= count {
-		for x := valuesLen - 1; x >= 0; x-- {
-			lastValues = append(lastValues, values[x])
-		}
-	} else {
-		for x := valuesLen - 1; x >= valuesLen-(count+1); x-- {
-			lastValues = append(lastValues, values[x])
-		}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
 	}
-
-	return lastValues
+	return 100
 }
 
 func clear() {
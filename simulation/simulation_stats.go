@@ -5,12 +5,76 @@ import (
 	"time"
 )
 
+// SimulationStats are the outcomes of a run. The averages are over every trip
+// (or round trip) after the warm-up, not means of per-passenger means.
 type SimulationStats struct {
 	AveragePassengerTripTime    time.Duration
 	AveragePassengerWaitingTime time.Duration
+	AveragePassengerJourneyTime time.Duration
 	AverageTrainRoundTripTime   time.Duration
+
+	Distributions *DistributionStats
+	Stations      []*StationStats
+	Tracks        []*TrackStats
+	Regularity    *RegularityStats
+
+	StepFree *StepFreeStats
+	Segments []*SegmentStats
+	Revenue  *RevenueStats
+
+	CostBenefit *CostBenefitSummary
 }
 
 func (ss *SimulationStats) String() string {
-	return fmt.Sprintf("Mean Passenger Wait Time: %v\nMean Passenger Trip Time: %v\nMean Train Round Trip Time: %v\n", ss.AveragePassengerWaitingTime, ss.AveragePassengerTripTime, ss.AverageTrainRoundTripTime)
+	output := fmt.Sprintf("Mean Passenger Wait Time: %v\nMean Passenger Trip Time: %v\nMean Passenger Door-to-Door Time: %v\nMean Train Round Trip Time: %v\n", ss.AveragePassengerWaitingTime, ss.AveragePassengerTripTime, ss.AveragePassengerJourneyTime, ss.AverageTrainRoundTripTime)
+	if ss.Distributions != nil {
+		output += ss.Distributions.String()
+	}
+	if len(ss.Stations) > 0 {
+		output += StationStatsTable(ss.Stations)
+	}
+	if len(ss.Tracks) > 0 {
+		output += TrackStatsTable(ss.Tracks)
+		if peak := PeakLoadTrack(ss.Tracks); peak != nil {
+			output += fmt.Sprintf("Peak Load Point: %s (mean load %0.1f, %0.0f%% of capacity)\n", peak.Name(), peak.MeanLoad, peak.LoadFactor*100.0)
+		}
+	}
+	if ss.Regularity != nil {
+		output += ss.Regularity.String()
+	}
+	if ss.StepFree != nil {
+		output += ss.StepFree.String()
+	}
+	for _, segment := range ss.Segments {
+		output += segment.String() + "\n"
+	}
+	if ss.Revenue != nil {
+		output += ss.Revenue.String()
+	}
+	if ss.CostBenefit != nil {
+		output += ss.CostBenefit.String()
+	}
+	return output
+}
+
+// StepFreeStats compares riders who need step-free routes against everyone else. UnableToTravel
+// counts the trips that couldn't be made step-free, whether refused at the start or Stranded part way.
+type StepFreeStats struct {
+	Trips          int
+	Rerouted       int
+	Stranded       int
+	UnableToTravel int
+
+	AverageWaitingTime      time.Duration
+	AverageJourneyTime      time.Duration
+	AverageOtherWaitingTime time.Duration
+	AverageOtherJourneyTime time.Duration
+}
+
+func (sfs *StepFreeStats) String() string {
+	return fmt.Sprintf("Step-Free Trips: %d (Rerouted: %d Stranded: %d Unable To Travel: %d)\nStep-Free Mean Wait Time: %v (Others: %v)\nStep-Free Mean Door-to-Door Time: %v (Others: %v)\n",
+		sfs.Trips, sfs.Rerouted, sfs.Stranded, sfs.UnableToTravel,
+		sfs.AverageWaitingTime, sfs.AverageOtherWaitingTime,
+		sfs.AverageJourneyTime, sfs.AverageOtherJourneyTime,
+	)
 }
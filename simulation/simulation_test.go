@@ -1,6 +1,7 @@
 package simulation
 
 import (
+	"log/slog"
 	"testing"
 	"time"
 
@@ -27,11 +28,12 @@ func TestSimulationNew(t *testing.T) {
 	assert.Nil(sim.PauseTime)
 }
 
-func TestSimulationLogf(t *testing.T) {
+func TestSimulationPublish(t *testing.T) {
 	assert := assert.New(t)
 	sim := New(1*time.Second, 1*time.Hour, nil)
-	sim.logf("test")
-	assert.NotEmpty(sim.LogEntries)
+	sim.publish(EventStasisReached, slog.LevelInfo, "test")
+	assert.Equal(1, sim.Events.Len())
+	assert.Equal(EventStasisReached, sim.Events.Recent(1)[0].Kind)
 }
 
 func TestSimulationGeneratePassengers(t *testing.T) {
@@ -140,6 +142,17 @@ func TestSimulationShouldReleaseTrainFromYardEmptyYard(t *testing.T) {
 	assert.False(sim.ShouldReleaseTrainFromYard())
 }
 
+func TestSimulationShouldReleaseTrainFromYardPlatformOccupied(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.AverageTimeBetweenTrains = 1 * time.Minute
+	sim.LastTrainReleased = 1 * time.Minute
+	sim.WallClock = 2 * time.Hour
+	sim.Stations[0].OutBoundTrain = sim.Yard.Dequeue()
+
+	assert.False(sim.ShouldReleaseTrainFromYard())
+}
+
 func TestSimulationStopsToDestination(t *testing.T) {
 	assert := assert.New(t)
 
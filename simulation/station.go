@@ -2,6 +2,7 @@ package simulation
 
 import (
 	"fmt"
+	"log/slog"
 	"math"
 	"math/rand"
 	"time"
@@ -25,6 +26,25 @@ type Station struct {
 	WaitingPassengers *QueueOfPassenger
 	GeneralPopulation *QueueOfPassenger
 
+	// Chainage is the distance along the line from the inbound terminus, in meters.
+	Chainage float64
+
+	// Layout is the entrances and circulation between the street and the platform.
+	// A nil layout means passengers appear on and leave the platform instantly.
+	Layout *StationLayout
+
+	// Events is where the station publishes trains and passengers coming and going; it may be nil.
+	Events *EventLog
+
+	// Departures are the trains that have left the station, in the order they left.
+	Departures []Departure
+
+	Boardings       int
+	Alightings      int
+	DeniedBoardings int
+	PeakWaiting     int
+	PeakWaitingAt   time.Duration
+
 	OutBoundTrain *Train
 	InBoundTrain  *Train
 
@@ -47,6 +67,14 @@ func (s *Station) LinkWith(next *Station, distanceMeters float64) {
 	}
 }
 
+// TrackFor returns the track leaving the station in the given direction.
+func (s *Station) TrackFor(isOutbound bool) *Track {
+	if isOutbound {
+		return s.OutBoundTrack
+	}
+	return s.InBoundTrack
+}
+
 func (s *Station) IsOutboundTerminus() bool {
 	return s.OutBoundTrack == nil
 }
@@ -66,12 +94,12 @@ func (s *Station) CheckForCollision(train *Train) {
 }
 
 func (s *Station) TrainEnters(train *Train) {
-	s.CheckForCollision(train)
-
 	if s.IsOutboundTerminus() { // flip the train around
 		train.IsOutbound = false
 	}
 
+	s.CheckForCollision(train)
+
 	if train.IsOutbound {
 		s.OutBoundTrain = train
 	} else {
@@ -89,6 +117,52 @@ func (s *Station) CheckWaitingTrains(wallClock time.Duration) {
 	}
 }
 
+// RecordOccupancy notes how many passengers are on the platform.
+func (s *Station) RecordOccupancy(wallClock time.Duration) {
+	if waiting := s.WaitingPassengers.Len(); waiting > s.PeakWaiting {
+		s.PeakWaiting = waiting
+		s.PeakWaitingAt = wallClock
+	}
+}
+
+// Departure is a train leaving a station.
+type Departure struct {
+	TrainID    int
+	IsOutbound bool
+	Stopped    bool
+	ArrivedAt  time.Duration
+	DepartedAt time.Duration
+}
+
+// RecordDeparture notes a train leaving the station for headway and dwell stats.
+func (s *Station) RecordDeparture(wallClock time.Duration, train *Train) {
+	s.Departures = append(s.Departures, Departure{
+		TrainID:    train.ID,
+		IsOutbound: train.IsOutbound,
+		Stopped:    train.StopsAt(s),
+		ArrivedAt:  train.ArrivedAtStation,
+		DepartedAt: wallClock,
+	})
+}
+
+// Headways returns the time between successive departures in the given direction,
+// counting only pairs where the first train left at or after `since`.
+func (s *Station) Headways(isOutbound bool, since time.Duration) []time.Duration {
+	var headways []time.Duration
+	var previous *Departure
+	for index := range s.Departures {
+		departure := &s.Departures[index]
+		if departure.IsOutbound != isOutbound {
+			continue
+		}
+		if previous != nil && previous.DepartedAt >= since {
+			headways = append(headways, departure.DepartedAt-previous.DepartedAt)
+		}
+		previous = departure
+	}
+	return headways
+}
+
 func (s *Station) TrainDeparts(train *Train) {
 	if train.IsOutbound {
 		if s.OutBoundTrack != nil {
@@ -105,6 +179,58 @@ func (s *Station) TrainDeparts(train *Train) {
 	}
 }
 
+// HasStepFreeAccess returns if a passenger who can't use stairs can get between the street and the platform.
+func (s *Station) HasStepFreeAccess() bool {
+	if s.Layout == nil {
+		return true
+	}
+	return s.Layout.HasStepFreeRoute()
+}
+
+// NextStepFreeStation returns the closest station further along the given direction
+// that has step-free access, or nil if there isn't one.
+func (s *Station) NextStepFreeStation(isOutbound bool) *Station {
+	station := s
+	for {
+		track := station.TrackFor(isOutbound)
+		if track == nil {
+			return nil
+		}
+		station = track.End
+		if station.HasStepFreeAccess() {
+			return station
+		}
+	}
+}
+
+// PassengerAlights starts a passenger leaving the station after getting off a train.
+func (s *Station) PassengerAlights(wallClock time.Duration, p *Passenger) {
+	if s.Layout != nil {
+		s.Layout.BeginEgress(wallClock, p, s.Layout.ExitFor(p))
+		return
+	}
+	s.PassengerExits(wallClock, p)
+}
+
+// PassengerExits returns a passenger to the general population once they've reached the street.
+func (s *Station) PassengerExits(wallClock time.Duration, p *Passenger) {
+	p.Exiting(wallClock)
+	s.GeneralPopulation.Enqueue(p)
+}
+
+// PassengerStranded returns a step-free passenger who can't get out of the station to the general
+// population, without finishing their trip.
+func (s *Station) PassengerStranded(wallClock time.Duration, p *Passenger) {
+	p.Stranding(wallClock)
+	if s.Events.Wants(slog.LevelWarn) {
+		e := newEvent(wallClock, EventStepFreeUnavailable, slog.LevelWarn, "%v rider %v is stranded at %s with no step-free way out", p.Mobility, p, s.Name)
+		e.PassengerID = p.ID
+		e.Station = s.Name
+		s.Events.Publish(e)
+	}
+	s.GeneralPopulation.Enqueue(p)
+}
+
 func (s *Station) PassengerArrivalPDF(provider *rand.Rand, stepLength time.Duration) float64 {
 	q := float64(time.Hour/stepLength) * 24.0
 
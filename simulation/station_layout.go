@@ -0,0 +1,369 @@
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	CirculationStairs    CirculationKind = 0
+	CirculationEscalator CirculationKind = 1
+	CirculationElevator  CirculationKind = 2
+)
+
+type CirculationKind int
+
+func (ck CirculationKind) String() string {
+	switch ck {
+	case CirculationStairs:
+		{
+			return "Stairs"
+		}
+	case CirculationEscalator:
+		{
+			return "Escalator"
+		}
+	case CirculationElevator:
+		{
+			return "Elevator"
+		}
+	}
+	return "?"
+}
+
+func NewCirculation(kind CirculationKind, name string, traversalTime time.Duration, capacityPerMinute float64) *Circulation {
+	return &Circulation{
+		Kind:              kind,
+		Name:              name,
+		TraversalTime:     traversalTime,
+		CapacityPerMinute: capacityPerMinute,
+	}
+}
+
+// Circulation is a stair, escalator or elevator between the street and the platform.
+// It admits at most CapacityPerMinute passengers, each of which then takes TraversalTime to get through.
+type Circulation struct {
+	Kind              CirculationKind
+	Name              string
+	TraversalTime     time.Duration
+	CapacityPerMinute float64
+
+	// OutOfService stops the element from admitting anyone, e.g. for an elevator outage.
+	OutOfService bool
+
+	Queue []*Movement
+
+	allowance float64
+}
+
+// Admit lets through as many queued movements as the step's throughput allows.
+func (c *Circulation) Admit(wallClock, stepLength time.Duration) []*Movement {
+	if c.OutOfService {
+		c.allowance = 0
+		return nil
+	}
+
+	perStep := c.CapacityPerMinute * (float64(stepLength) / float64(time.Minute))
+	c.allowance += perStep
+	if maxAllowance := perStep + 1.0; c.allowance > maxAllowance {
+		c.allowance = maxAllowance
+	}
+
+	var admitted []*Movement
+	for len(c.Queue) > 0 && c.allowance >= 1.0 {
+		m := c.Queue[0]
+		c.Queue = c.Queue[1:]
+		c.allowance -= 1.0
+		m.Admitted(wallClock, c)
+		admitted = append(admitted, m)
+	}
+	return admitted
+}
+
+func (c *Circulation) String() string {
+	if c.OutOfService {
+		return fmt.Sprintf("%s %s (out of service, %d queued)", c.Kind, c.Name, len(c.Queue))
+	}
+	return fmt.Sprintf("%s %s (%d queued)", c.Kind, c.Name, len(c.Queue))
+}
+
+// Entrance is a street entrance and the circulation elements between it and the platform,
+// listed in the order they are traversed on the way in.
+type Entrance struct {
+	Name     string
+	WalkTime time.Duration
+	Path     []*Circulation
+}
+
+// Movement is a passenger walking through the station, either in from the street (access)
+// or out from the platform (egress).
+type Movement struct {
+	Passenger *Passenger
+	Egress    bool
+
+	Steps   []*Circulation
+	LeadOut time.Duration
+
+	// Pace scales walking and stair times for how fast the passenger walks.
+	Pace float64
+
+	Index   int
+	ReadyAt time.Duration
+	Queued  bool
+}
+
+// Admitted is called when a circulation element lets the movement through.
+func (m *Movement) Admitted(wallClock time.Duration, c *Circulation) {
+	m.Queued = false
+	m.Index = m.Index + 1
+	m.ReadyAt = wallClock + m.traversalTime(c)
+	if m.Index == len(m.Steps) {
+		m.ReadyAt += m.LeadOut
+	}
+}
+
+func (m *Movement) traversalTime(c *Circulation) time.Duration {
+	if c.Kind == CirculationStairs {
+		return m.walkTime(c.TraversalTime)
+	}
+	return c.TraversalTime
+}
+
+func (m *Movement) walkTime(d time.Duration) time.Duration {
+	if m.Pace <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * m.Pace)
+}
+
+// IsFinished returns if the movement has cleared every step.
+func (m *Movement) IsFinished(wallClock time.Duration) bool {
+	return !m.Queued && m.Index == len(m.Steps) && wallClock >= m.ReadyAt
+}
+
+// DefaultStationLayout returns a layout sized to a station's ridership.
+func DefaultStationLayout(name string, ridersPerDay int) *StationLayout {
+	layout := &StationLayout{
+		PlatformWalkTime: 20 * time.Second,
+	}
+
+	entranceCount := 1 + ridersPerDay/50000
+	if entranceCount > 4 {
+		entranceCount = 4
+	}
+
+	for x := 0; x < entranceCount; x++ {
+		entrance := &Entrance{
+			Name:     fmt.Sprintf("%s Entrance %d", name, x+1),
+			WalkTime: 30 * time.Second,
+		}
+		entrance.Path = append(entrance.Path, NewCirculation(CirculationStairs, fmt.Sprintf("Stairs %d", x+1), 15*time.Second, 50))
+		if ridersPerDay >= 20000 {
+			entrance.Path = append(entrance.Path, NewCirculation(CirculationEscalator, fmt.Sprintf("Escalator %d", x+1), 30*time.Second, 100))
+		}
+		layout.Entrances = append(layout.Entrances, entrance)
+	}
+
+	if ridersPerDay >= 10000 {
+		layout.Entrances = append(layout.Entrances, &Entrance{
+			Name:     fmt.Sprintf("%s Elevator Entrance", name),
+			WalkTime: 30 * time.Second,
+			Path: []*Circulation{
+				NewCirculation(CirculationElevator, "Elevator", 60*time.Second, 8),
+			},
+		})
+	}
+
+	return layout
+}
+
+// StationLayout describes how passengers get between the street and the platform.
+type StationLayout struct {
+	Entrances        []*Entrance
+	PlatformWalkTime time.Duration
+
+	Movements []*Movement
+
+	// started, if set, is told about every movement as it begins.
+	started func(m *Movement)
+}
+
+// Circulations returns every circulation element in the layout.
+func (sl *StationLayout) Circulations() []*Circulation {
+	var all []*Circulation
+	for _, entrance := range sl.Entrances {
+		all = append(all, entrance.Path...)
+	}
+	return all
+}
+
+// HasStepFreeRoute returns if at least one entrance can currently be used without stairs.
+func (sl *StationLayout) HasStepFreeRoute() bool {
+	for _, entrance := range sl.Entrances {
+		if entrance.IsStepFree() {
+			return true
+		}
+	}
+	return false
+}
+
+// ChooseEntrance picks an entrance for an arriving passenger, preferring ones without elevators
+// unless the passenger needs a step-free route.
+func (sl *StationLayout) ChooseEntrance(provider *rand.Rand, p *Passenger) *Entrance {
+	candidates := sl.entranceCandidates(p)
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[provider.Intn(len(candidates))]
+}
+
+// ExitFor picks the entrance a departing passenger leaves through.
+func (sl *StationLayout) ExitFor(p *Passenger) *Entrance {
+	candidates := sl.entranceCandidates(p)
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[p.ID%len(candidates)]
+}
+
+func (sl *StationLayout) entranceCandidates(p *Passenger) []*Entrance {
+	var candidates []*Entrance
+	if p.NeedsStepFree() {
+		for _, entrance := range sl.Entrances {
+			if entrance.IsStepFree() {
+				candidates = append(candidates, entrance)
+			}
+		}
+		return candidates
+	}
+
+	for _, entrance := range sl.Entrances {
+		if !entrance.hasElevator() {
+			candidates = append(candidates, entrance)
+		}
+	}
+	if len(candidates) == 0 {
+		return sl.Entrances
+	}
+	return candidates
+}
+
+// IsStepFree returns if the entrance only uses working elevators (or nothing at all) to reach the platform.
+func (e *Entrance) IsStepFree() bool {
+	for _, c := range e.Path {
+		if c.Kind != CirculationElevator || c.OutOfService {
+			return false
+		}
+	}
+	return true
+}
+
+// Elevators returns the elevators along the entrance's path.
+func (e *Entrance) Elevators() []*Circulation {
+	var elevators []*Circulation
+	for _, c := range e.Path {
+		if c.Kind == CirculationElevator {
+			elevators = append(elevators, c)
+		}
+	}
+	return elevators
+}
+
+func (e *Entrance) hasElevator() bool {
+	for _, c := range e.Path {
+		if c.Kind == CirculationElevator {
+			return true
+		}
+	}
+	return false
+}
+
+// BeginAccess starts a passenger walking from the street to the platform.
+func (sl *StationLayout) BeginAccess(wallClock time.Duration, p *Passenger, entrance *Entrance) {
+	m := &Movement{
+		Passenger: p,
+		Pace:      p.WalkingPace(),
+		ReadyAt:   wallClock,
+	}
+	m.LeadOut = m.walkTime(sl.PlatformWalkTime)
+	if entrance != nil {
+		m.Steps = entrance.Path
+		m.ReadyAt += m.walkTime(entrance.WalkTime)
+	}
+	if len(m.Steps) == 0 {
+		m.ReadyAt += m.LeadOut
+	}
+	sl.Movements = append(sl.Movements, m)
+	if sl.started != nil {
+		sl.started(m)
+	}
+}
+
+// BeginEgress starts a passenger walking from the platform out to the street.
+func (sl *StationLayout) BeginEgress(wallClock time.Duration, p *Passenger, entrance *Entrance) {
+	m := &Movement{
+		Passenger: p,
+		Egress:    true,
+		Pace:      p.WalkingPace(),
+	}
+	m.ReadyAt = wallClock + m.walkTime(sl.PlatformWalkTime)
+	if entrance != nil {
+		for x := len(entrance.Path) - 1; x >= 0; x-- {
+			m.Steps = append(m.Steps, entrance.Path[x])
+		}
+		m.LeadOut = m.walkTime(entrance.WalkTime)
+	}
+	if len(m.Steps) == 0 {
+		m.ReadyAt += m.LeadOut
+	}
+	sl.Movements = append(sl.Movements, m)
+	if sl.started != nil {
+		sl.started(m)
+	}
+}
+
+// Step advances every movement through the layout, returning the passengers that
+// reached the platform and the passengers that left the station.
+func (sl *StationLayout) Step(wallClock, stepLength time.Duration) (reachedPlatform, exited []*Passenger) {
+	var stillMoving []*Movement
+	for _, m := range sl.Movements {
+		if m.IsFinished(wallClock) {
+			if m.Egress {
+				exited = append(exited, m.Passenger)
+			} else {
+				reachedPlatform = append(reachedPlatform, m.Passenger)
+			}
+			continue
+		}
+
+		if !m.Queued && wallClock >= m.ReadyAt && m.Index < len(m.Steps) {
+			m.Queued = true
+			circulation := m.Steps[m.Index]
+			circulation.Queue = append(circulation.Queue, m)
+		}
+		stillMoving = append(stillMoving, m)
+	}
+	sl.Movements = stillMoving
+
+	for _, circulation := range sl.Circulations() {
+		circulation.Admit(wallClock, stepLength)
+	}
+	return
+}
+
+// AccessCount returns the number of passengers walking in to the platform.
+func (sl *StationLayout) AccessCount() int {
+	var count int
+	for _, m := range sl.Movements {
+		if !m.Egress {
+			count++
+		}
+	}
+	return count
+}
+
+// EgressCount returns the number of passengers walking out to the street.
+func (sl *StationLayout) EgressCount() int {
+	return len(sl.Movements) - sl.AccessCount()
+}
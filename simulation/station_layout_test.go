@@ -0,0 +1,226 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestStationLayoutAccess(t *testing.T) {
+	assert := assert.New(t)
+
+	layout := &StationLayout{PlatformWalkTime: 10 * time.Second}
+	entrance := &Entrance{
+		Name:     "Main",
+		WalkTime: 5 * time.Second,
+		Path:     []*Circulation{NewCirculation(CirculationStairs, "Stairs", 5*time.Second, 60)},
+	}
+	layout.Entrances = append(layout.Entrances, entrance)
+
+	p := &Passenger{ID: 1}
+	layout.BeginAccess(0, p, entrance)
+
+	var reached []*Passenger
+	var wallClock time.Duration
+	for ; wallClock < time.Minute && len(reached) == 0; wallClock += time.Second {
+		reached, _ = layout.Step(wallClock, time.Second)
+	}
+	assert.Len(reached, 1)
+	assert.Equal(21*time.Second, wallClock)
+	assert.Zero(layout.AccessCount())
+}
+
+func TestStationLayoutEgressCongestion(t *testing.T) {
+	assert := assert.New(t)
+
+	layout := &StationLayout{}
+	entrance := &Entrance{
+		Name: "Main",
+		Path: []*Circulation{NewCirculation(CirculationStairs, "Stairs", 0, 60)},
+	}
+	layout.Entrances = append(layout.Entrances, entrance)
+
+	for x := 0; x < 10; x++ {
+		layout.BeginEgress(0, &Passenger{ID: x}, layout.ExitFor(&Passenger{ID: x}))
+	}
+	assert.Equal(10, layout.EgressCount())
+
+	var exited int
+	var wallClock time.Duration
+	for ; wallClock < 5*time.Second; wallClock += time.Second {
+		_, out := layout.Step(wallClock, time.Second)
+		exited += len(out)
+	}
+	assert.True(exited < 10, exited)
+
+	for ; wallClock < time.Minute; wallClock += time.Second {
+		_, out := layout.Step(wallClock, time.Second)
+		exited += len(out)
+	}
+	assert.Equal(10, exited)
+}
+
+func TestSimulationPassengerArrivesAtStationWithLayout(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.GenerateStationLayouts()
+
+	p := sim.People.Dequeue()
+	station := sim.Stations[8]
+	sim.PassengerArrivesAtStation(station, p)
+	assert.Zero(station.WaitingPassengers.Len())
+	assert.Equal(1, station.Layout.AccessCount())
+
+	for x := 0; x < 600 && station.Layout.AccessCount() > 0; x++ {
+		sim.StationCirculation(station)
+		sim.WallClock += sim.StepLength
+	}
+	assert.Zero(station.Layout.AccessCount())
+	assert.Equal(1, station.WaitingPassengers.Len())
+}
+
+func TestStationLayoutStepFreeRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	layout := DefaultStationLayout("Test", 40000)
+	assert.True(layout.HasStepFreeRoute())
+
+	wheelchair := &Passenger{ID: 1, Mobility: MobilityWheelchair}
+	exit := layout.ExitFor(wheelchair)
+	assert.NotNil(exit)
+	assert.True(exit.IsStepFree())
+
+	for _, elevator := range exit.Elevators() {
+		elevator.OutOfService = true
+	}
+	assert.False(layout.HasStepFreeRoute())
+	assert.Nil(layout.ExitFor(wheelchair))
+	assert.NotNil(layout.ExitFor(&Passenger{ID: 1}))
+}
+
+func TestSimulationElevatorOutageReroutes(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.GenerateStationLayouts()
+
+	origin := sim.Stations[8]  // times square
+	closed := sim.Stations[10] // 14 street
+	sim.ScheduleElevatorOutage(closed.Name, "", 0, time.Hour)
+	sim.ApplyElevatorOutages()
+	assert.False(closed.HasStepFreeAccess())
+
+	p := &Passenger{ID: 1, Mobility: MobilityWheelchair, Destination: closed.Name}
+	assert.True(sim.PlanStepFreeTrip(origin, p))
+	assert.NotEqual(closed.Name, p.Destination)
+	assert.Equal(1, p.Reroutes)
+	assert.True(sim.StationByName(p.Destination).HasStepFreeAccess())
+
+	sim.WallClock = 2 * time.Hour
+	sim.ApplyElevatorOutages()
+	assert.True(closed.HasStepFreeAccess())
+}
+
+func TestConfigCarriesElevatorOutages(t *testing.T) {
+	assert := assert.New(t)
+
+	var config Config
+	assert.Nil(SetConfigValue(&config, "elevator_outages", `[{"station": "14 Street", "start": 0, "end": 3600000000000}]`))
+	assert.Equal([]ElevatorOutage{{Station: "14 Street", End: time.Hour}}, config.ElevatorOutages)
+
+	scenario := testReplicationScenario()
+	scenario.Config.ElevatorOutages = config.ElevatorOutages
+	sim := scenario.NewSimulation(1)
+	assert.Equal(config.ElevatorOutages, sim.ElevatorOutages)
+	assert.Equal(config.ElevatorOutages, sim.Config().ElevatorOutages)
+
+	scenario.Config.ElevatorOutages[0].End = 0
+	assert.NotNil(scenario.Config.Validate())
+}
+
+func TestSimulationPlanStepFreeTripNoOriginAccess(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.GenerateStationLayouts()
+
+	origin := sim.Stations[0] // harlem-148, no elevator
+	assert.False(origin.HasStepFreeAccess())
+
+	p := &Passenger{ID: 1, Mobility: MobilityStroller, Destination: sim.Stations[8].Name}
+	assert.False(sim.PlanStepFreeTrip(origin, p))
+}
+
+func TestSimulationRandomMobilityNeed(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	// nobody needs step-free access by default, and finding that out takes no draws.
+	sim.SetSeed(1)
+	assert.Equal(MobilityNone, sim.randomMobilityNeed())
+	draw := sim.Provider.Float64()
+	sim.SetSeed(1)
+	assert.Equal(draw, sim.Provider.Float64())
+
+	sim.WheelchairShare = 1
+	assert.Equal(MobilityWheelchair, sim.randomMobilityNeed())
+	sim.WheelchairShare, sim.StrollerShare = 0, 1
+	assert.Equal(MobilityStroller, sim.randomMobilityNeed())
+}
+
+func TestSimulationStepFreeStatsPerTrip(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.WheelchairShare = 0.1
+	sim.StasisAt = time.Hour
+
+	// a mean of each rider's mean would make it 5 minutes; every trip counts once, for 3.
+	frequent := sim.People.Dequeue()
+	frequent.Mobility = MobilityWheelchair
+	for index := 0; index < 3; index++ {
+		start := time.Duration(2+index) * time.Hour
+		frequent.Trips = append(frequent.Trips, Trip{EnteredAt: start, ExitedAt: start + 10*time.Minute, Waiting: time.Minute})
+	}
+	sim.People.Enqueue(frequent)
+	occasional := sim.People.Dequeue()
+	occasional.Mobility = MobilityWheelchair
+	occasional.Trips = append(occasional.Trips,
+		Trip{EnteredAt: 30 * time.Minute, ExitedAt: 90 * time.Minute, Waiting: 45 * time.Minute},
+		Trip{EnteredAt: 2 * time.Hour, ExitedAt: 2*time.Hour + 14*time.Minute, Waiting: 9 * time.Minute},
+	)
+	sim.People.Enqueue(occasional)
+
+	stats := sim.computeStepFreeStats()
+	assert.Equal(3*time.Minute, stats.AverageWaitingTime)
+	assert.Equal(11*time.Minute, stats.AverageJourneyTime)
+}
+
+func TestTrainStrandsStepFreeRidersWithNowhereToGetOut(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.GenerateStationLayouts()
+	sim.WheelchairShare = 0.1
+
+	terminus := sim.Stations[0] // harlem-148, no elevator, and nothing further inbound
+	assert.False(terminus.HasStepFreeAccess())
+
+	train := sim.Yard.Dequeue()
+	train.IsOutbound = false
+	rider := sim.People.Dequeue()
+	rider.Mobility = MobilityWheelchair
+	rider.Destination = terminus.Name
+	rider.EnteredStation = time.Minute
+	rider.Boarding(2*time.Minute, train)
+	train.Passengers = append(train.Passengers, rider)
+
+	train.DisembarkPassengers(10*time.Minute, terminus)
+	assert.Empty(train.Passengers)
+	assert.Equal(1, rider.Stranded)
+	assert.Empty(rider.Trips)
+	assert.Empty(rider.Journeys)
+	assert.Zero(terminus.Layout.EgressCount())
+
+	stats := sim.computeStepFreeStats()
+	assert.Equal(1, stats.Stranded)
+	assert.Equal(1, stats.UnableToTravel)
+	assert.Zero(stats.Trips)
+}
@@ -18,3 +18,23 @@ func TestStationPassengerArrivalPDF(t *testing.T) {
 	assert.True(pdf > 0, pdf)
 	assert.True(pdf <= 1.0, pdf)
 }
+
+func TestStationCollisionAtTheTerminus(t *testing.T) {
+	assert := assert.New(t)
+
+	first, terminus := NewStation("first", 0, nil), NewStation("terminus", 0, nil)
+	first.LinkWith(terminus, 1000)
+
+	turning := NewTrain(1, "IRT 3", 20, 1, 1, 30*time.Second)
+	turning.IsOutbound = true
+	terminus.TrainEnters(turning)
+
+	// a second train into the occupied platform is a collision, rather than taking the first one's place.
+	next := NewTrain(2, "IRT 3", 20, 1, 1, 30*time.Second)
+	next.IsOutbound = true
+	defer func() {
+		assert.NotNil(recover())
+		assert.Equal(turning, terminus.InBoundTrain)
+	}()
+	terminus.TrainEnters(next)
+}
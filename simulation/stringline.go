@@ -0,0 +1,157 @@
+package simulation
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"time"
+)
+
+// NewStringLineDiagram returns a time–distance diagram of the recorded trajectories.
+func NewStringLineDiagram(stations []*Station, trajectories *TrajectoryRecorder) *StringLineDiagram {
+	return &StringLineDiagram{
+		Width:        1600,
+		Height:       900,
+		Stations:     stations,
+		Trajectories: trajectories,
+	}
+}
+
+// StringLineDiagram draws every train as a line of distance along the line against time.
+// Flat stretches are dwells, holds are drawn in red, and trains running close together
+// show up as lines bunched together.
+type StringLineDiagram struct {
+	Width  int
+	Height int
+
+	Stations     []*Station
+	Trajectories *TrajectoryRecorder
+}
+
+const (
+	stringLineMarginLeft   = 220
+	stringLineMarginRight  = 20
+	stringLineMarginTop    = 20
+	stringLineMarginBottom = 40
+
+	stringLineOutboundColor = "#1f5fa8"
+	stringLineInboundColor  = "#2e8b57"
+	stringLineHoldColor     = "#d62728"
+)
+
+// WriteSVG writes the diagram as a standalone SVG document.
+func (sld *StringLineDiagram) WriteSVG(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	start, end := sld.timeRange()
+	maxChainage := sld.maxChainage()
+
+	plotWidth := float64(sld.Width - stringLineMarginLeft - stringLineMarginRight)
+	plotHeight := float64(sld.Height - stringLineMarginTop - stringLineMarginBottom)
+	x := func(t time.Duration) float64 {
+		if end <= start {
+			return stringLineMarginLeft
+		}
+		return stringLineMarginLeft + plotWidth*float64(t-start)/float64(end-start)
+	}
+	y := func(chainage float64) float64 {
+		if maxChainage <= 0 {
+			return stringLineMarginTop
+		}
+		return stringLineMarginTop + plotHeight*chainage/maxChainage
+	}
+
+	fmt.Fprintf(buffered, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="10">`+"\n", sld.Width, sld.Height, sld.Width, sld.Height)
+	fmt.Fprintf(buffered, `<rect width="%d" height="%d" fill="white"/>`+"\n", sld.Width, sld.Height)
+
+	for _, station := range sld.Stations {
+		stationY := y(station.Chainage)
+		fmt.Fprintf(buffered, `<line x1="%d" y1="%0.1f" x2="%d" y2="%0.1f" stroke="#ddd"/>`+"\n", stringLineMarginLeft, stationY, sld.Width-stringLineMarginRight, stationY)
+		fmt.Fprintf(buffered, `<text x="%d" y="%0.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", stringLineMarginLeft-6, stationY, html.EscapeString(station.Name))
+	}
+
+	axisY := sld.Height - stringLineMarginBottom
+	for tick := start.Truncate(15 * time.Minute); tick <= end; tick += 15 * time.Minute {
+		if tick < start {
+			continue
+		}
+		tickX := x(tick)
+		fmt.Fprintf(buffered, `<line x1="%0.1f" y1="%d" x2="%0.1f" y2="%d" stroke="#eee"/>`+"\n", tickX, stringLineMarginTop, tickX, axisY)
+		fmt.Fprintf(buffered, `<text x="%0.1f" y="%d" text-anchor="middle">%v</text>`+"\n", tickX, axisY+14, tick)
+	}
+
+	for _, id := range sld.Trajectories.TrainIDs() {
+		for _, run := range sld.runs(sld.Trajectories.Trajectories[id]) {
+			color := stringLineInboundColor
+			if run[0].IsOutbound {
+				color = stringLineOutboundColor
+			}
+			fmt.Fprintf(buffered, `<polyline fill="none" stroke="%s" stroke-width="1" data-train="%d" points="`, color, id)
+			for _, point := range run {
+				fmt.Fprintf(buffered, "%0.1f,%0.1f ", x(point.Time), y(point.Chainage))
+			}
+			fmt.Fprint(buffered, "\"/>\n")
+
+			for index := 1; index < len(run); index++ {
+				if run[index].State == TrainStateHeld && run[index-1].State == TrainStateHeld {
+					fmt.Fprintf(buffered, `<line x1="%0.1f" y1="%0.1f" x2="%0.1f" y2="%0.1f" stroke="%s" stroke-width="3"/>`+"\n",
+						x(run[index-1].Time), y(run[index-1].Chainage), x(run[index].Time), y(run[index].Chainage), stringLineHoldColor)
+				}
+			}
+		}
+	}
+
+	fmt.Fprint(buffered, "</svg>\n")
+	return buffered.Flush()
+}
+
+// runs splits a trajectory wherever the train went back to the yard or turned around,
+// so each trip in each direction is drawn as its own line.
+func (sld *StringLineDiagram) runs(points []TrajectoryPoint) [][]TrajectoryPoint {
+	var runs [][]TrajectoryPoint
+	var current []TrajectoryPoint
+	for index, point := range points {
+		if index > 0 {
+			previous := points[index-1]
+			if point.Time-previous.Time > 2*sld.Trajectories.Interval {
+				runs = append(runs, current)
+				current = nil
+			} else if point.IsOutbound != previous.IsOutbound {
+				runs = append(runs, current)
+				current = []TrajectoryPoint{previous}
+				current[0].IsOutbound = point.IsOutbound
+			}
+		}
+		current = append(current, point)
+	}
+	if len(current) > 0 {
+		runs = append(runs, current)
+	}
+	return runs
+}
+
+func (sld *StringLineDiagram) timeRange() (start, end time.Duration) {
+	var hasPoint bool
+	for _, trajectory := range sld.Trajectories.Trajectories {
+		for _, point := range trajectory {
+			if !hasPoint || point.Time < start {
+				start = point.Time
+			}
+			if !hasPoint || point.Time > end {
+				end = point.Time
+			}
+			hasPoint = true
+		}
+	}
+	return
+}
+
+func (sld *StringLineDiagram) maxChainage() float64 {
+	var max float64
+	for _, station := range sld.Stations {
+		if station.Chainage > max {
+			max = station.Chainage
+		}
+	}
+	return max
+}
@@ -0,0 +1,299 @@
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SweepParameter is a Config field, by JSON key, and the values to try for it.
+type SweepParameter struct {
+	Name   string
+	Values []string
+}
+
+// ParseSweepParameter parses "name=value,value,...", e.g. "total_train_count=24,32,40".
+func ParseSweepParameter(text string) (SweepParameter, error) {
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return SweepParameter{}, fmt.Errorf("sweep parameter should look like name=value,value: %q", text)
+	}
+	parameter := SweepParameter{Name: parts[0], Values: splitSweepValues(parts[1])}
+	var config Config
+	for _, value := range parameter.Values {
+		if err := SetConfigValue(&config, parameter.Name, value); err != nil {
+			return SweepParameter{}, err
+		}
+	}
+	return parameter, nil
+}
+
+// splitSweepValues splits on the commas between values, leaving alone those inside
+// a JSON value such as a list of services.
+func splitSweepValues(text string) []string {
+	var values []string
+	var depth int
+	var quoted, escaped bool
+	start := 0
+	for index, r := range text {
+		switch {
+		case escaped:
+			{
+				escaped = false
+			}
+		case quoted:
+			{
+				escaped = r == '\\'
+				quoted = r != '"'
+			}
+		case r == '"':
+			{
+				quoted = true
+			}
+		case r == '[' || r == '{':
+			{
+				depth++
+			}
+		case r == ']' || r == '}':
+			{
+				depth--
+			}
+		case r == ',' && depth == 0:
+			{
+				values = append(values, text[start:index])
+				start = index + 1
+			}
+		}
+	}
+	return append(values, text[start:])
+}
+
+// SweepPoint is one setting of every swept parameter, in the sweep's parameter order.
+type SweepPoint []string
+
+// GridPoints returns every combination of the parameters' values, the last parameter varying fastest.
+func GridPoints(parameters []SweepParameter) []SweepPoint {
+	points := []SweepPoint{{}}
+	for _, parameter := range parameters {
+		var next []SweepPoint
+		for _, point := range points {
+			for _, value := range parameter.Values {
+				next = append(next, append(append(SweepPoint{}, point...), value))
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// NewGridSweep returns a sweep over every combination of the parameters' values.
+func NewGridSweep(scenario Scenario, seed int64, parameters ...SweepParameter) *Sweep {
+	names := make([]string, len(parameters))
+	for index, parameter := range parameters {
+		names[index] = parameter.Name
+	}
+	return &Sweep{
+		Scenario:     scenario,
+		Seed:         seed,
+		Parameters:   names,
+		Points:       GridPoints(parameters),
+		Replications: 5,
+		Confidence:   0.95,
+		Workers:      runtime.GOMAXPROCS(0),
+	}
+}
+
+// Sweep runs a scenario at each of a list of parameter settings. Every point uses the
+// same replication seeds, so differences between points aren't down to luck of the draw.
+type Sweep struct {
+	Scenario   Scenario
+	Seed       int64
+	Parameters []string
+	Points     []SweepPoint
+
+	Replications int
+	Confidence   float64
+	Workers      int
+}
+
+// Config returns the scenario's config with the point's parameters set.
+func (sw *Sweep) Config(point SweepPoint) (Config, error) {
+	config := sw.Scenario.Config
+	for index, name := range sw.Parameters {
+		if err := SetConfigValue(&config, name, point[index]); err != nil {
+			return config, err
+		}
+	}
+	return config, config.Validate()
+}
+
+// Run simulates every point and replication, in parallel.
+func (sw *Sweep) Run() (*SweepResult, error) {
+	scenarios := make([]Scenario, len(sw.Points))
+	for index, point := range sw.Points {
+		if len(point) != len(sw.Parameters) {
+			return nil, fmt.Errorf("sweep point %d has %d values for %d parameters", index, len(point), len(sw.Parameters))
+		}
+		config, err := sw.Config(point)
+		if err != nil {
+			return nil, err
+		}
+		scenarios[index] = sw.Scenario
+		scenarios[index].Config = config
+	}
+
+	stats := make([][]*SimulationStats, len(sw.Points))
+	for index := range stats {
+		stats[index] = make([]*SimulationStats, sw.Replications)
+	}
+	runParallel(sw.Workers, len(sw.Points)*sw.Replications, func(index int) {
+		point, replication := index/sw.Replications, index%sw.Replications
+		stats[point][replication] = scenarios[point].NewSimulation(DeriveSeed(sw.Seed, replication)).Simulate()
+	})
+
+	result := &SweepResult{Parameters: sw.Parameters, Confidence: sw.Confidence}
+	for index, point := range sw.Points {
+		result.Points = append(result.Points, &SweepPointResult{
+			Values:  point,
+			Stats:   stats[index],
+			Metrics: EstimateMetrics(stats[index], sw.Confidence),
+		})
+	}
+	return result, nil
+}
+
+// SweepPointResult is the aggregate of the replications at one sweep point.
+type SweepPointResult struct {
+	Values  SweepPoint
+	Stats   []*SimulationStats
+	Metrics []*MetricEstimate
+}
+
+// Metric returns the estimate of the named StatsMetric, or nil.
+func (spr *SweepPointResult) Metric(name string) *MetricEstimate {
+	for _, metric := range spr.Metrics {
+		if metric.Name == name {
+			return metric
+		}
+	}
+	return nil
+}
+
+// SweepResult is every sweep point's metrics.
+type SweepResult struct {
+	Parameters []string
+	Confidence float64
+	Points     []*SweepPointResult
+}
+
+// sweepTableMetrics are the metrics SweepResult.String shows.
+var sweepTableMetrics = []string{"Mean Wait (s)", "P95 Wait (s)", "Mean Journey (s)", "Peak Load Factor", "Denied Boardings", "Operating Cost"}
+
+func (sr *SweepResult) String() string {
+	buffer := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(append(append([]string{}, sr.Parameters...), sweepTableMetrics...), "\t"))
+	for _, point := range sr.Points {
+		columns := append([]string{}, point.Values...)
+		for _, name := range sweepTableMetrics {
+			if metric := point.Metric(name); metric != nil {
+				columns = append(columns, fmt.Sprintf("%0.2f ± %0.2f", metric.Mean, metric.HalfWidth))
+			} else {
+				columns = append(columns, "")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+	}
+	w.Flush()
+	return buffer.String()
+}
+
+// ServiceTargets are the levels of service a plan has to meet. Zero values aren't checked.
+type ServiceTargets struct {
+	MaxP95Wait time.Duration
+	// MaxLoadFactor is the highest mean load, as a fraction of capacity, allowed on the busiest track.
+	MaxLoadFactor float64
+}
+
+// Met returns if the mean over the replications meets every target.
+func (st ServiceTargets) Met(point *SweepPointResult) bool {
+	if st.MaxP95Wait > 0 {
+		if metric := point.Metric("P95 Wait (s)"); metric == nil || metric.Mean > st.MaxP95Wait.Seconds() {
+			return false
+		}
+	}
+	if st.MaxLoadFactor > 0 {
+		if metric := point.Metric("Peak Load Factor"); metric == nil || metric.Mean > st.MaxLoadFactor {
+			return false
+		}
+	}
+	return true
+}
+
+// NewOptimizer returns an optimizer picking the first of `candidates` for `parameter` that meets `targets`.
+// Candidates go from most to least preferred, e.g. fleet sizes smallest first or headways widest first.
+func NewOptimizer(scenario Scenario, seed int64, parameter SweepParameter, targets ServiceTargets) *Optimizer {
+	return &Optimizer{
+		Sweep:     NewGridSweep(scenario, seed),
+		Parameter: parameter,
+		Targets:   targets,
+	}
+}
+
+// Optimizer searches the candidate values of one parameter for the most preferred one that meets
+// the targets. It assumes that once a candidate meets the targets every later one does too,
+// e.g. that adding trains never makes the service worse, and bisects rather than trying them all.
+type Optimizer struct {
+	Sweep     *Sweep
+	Parameter SweepParameter
+	Targets   ServiceTargets
+}
+
+// OptimizerResult is the outcome of a search.
+type OptimizerResult struct {
+	Parameter string
+	// Best is the chosen candidate, or nil if none met the targets.
+	Best *SweepPointResult
+	// Tried are the candidates simulated, in the order they were tried.
+	Tried []*SweepPointResult
+}
+
+func (or *OptimizerResult) String() string {
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprint(buffer, (&SweepResult{Parameters: []string{or.Parameter}, Points: or.Tried}).String())
+	if or.Best == nil {
+		fmt.Fprintf(buffer, "No %s met the targets.\n", or.Parameter)
+	} else {
+		fmt.Fprintf(buffer, "Best %s: %s\n", or.Parameter, or.Best.Values[0])
+	}
+	return buffer.String()
+}
+
+// Run bisects the candidates.
+func (o *Optimizer) Run() (*OptimizerResult, error) {
+	result := &OptimizerResult{Parameter: o.Parameter.Name}
+	sweep := *o.Sweep
+	sweep.Parameters = []string{o.Parameter.Name}
+
+	low, high := 0, len(o.Parameter.Values)
+	for low < high {
+		mid := (low + high) / 2
+		sweep.Points = []SweepPoint{{o.Parameter.Values[mid]}}
+		swept, err := sweep.Run()
+		if err != nil {
+			return nil, err
+		}
+		point := swept.Points[0]
+		result.Tried = append(result.Tried, point)
+		if o.Targets.Met(point) {
+			result.Best = point
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestSetConfigValue(t *testing.T) {
+	assert := assert.New(t)
+
+	var config Config
+	assert.Nil(SetConfigValue(&config, "total_train_count", "40"))
+	assert.Nil(SetConfigValue(&config, "average_time_between_trains", "2m"))
+	assert.Nil(SetConfigValue(&config, "wheelchair_share", "0.01"))
+	assert.Nil(SetConfigValue(&config, "use_station_layouts", "true"))
+	assert.Nil(SetConfigValue(&config, "seed", "99"))
+	assert.Equal(40, config.TotalTrainCount)
+	assert.Equal(2*time.Minute, config.AverageTimeBetweenTrains)
+	assert.Equal(0.01, config.WheelchairShare)
+	assert.True(config.UseStationLayouts)
+	assert.Equal(int64(99), config.Seed)
+
+	assert.Nil(SetConfigValue(&config, "services", `[{"name": "Express", "skip_stations": ["Bank"], "share": 0.5}, {"name": "Local", "share": 0.5}]`))
+	assert.Len(config.Services, 2)
+	assert.Equal([]string{"Bank"}, config.Services[0].SkipStations)
+
+	assert.NotNil(SetConfigValue(&config, "services", `[{"name": "Express"`))
+	assert.NotNil(SetConfigValue(&config, "not_a_field", "1"))
+	assert.NotNil(SetConfigValue(&config, "total_train_count", "lots"))
+
+	fields := map[string]bool{}
+	for _, name := range ConfigFields() {
+		fields[name] = true
+	}
+	for _, name := range []string{"seed", "total_train_count", "average_time_between_trains", "wheelchair_share", "use_station_layouts", "engine"} {
+		assert.True(fields[name], name)
+	}
+}
+
+func TestParseSweepParameter(t *testing.T) {
+	assert := assert.New(t)
+
+	parameter, err := ParseSweepParameter("average_time_between_trains=90s,120s,150s")
+	assert.Nil(err)
+	assert.Equal("average_time_between_trains", parameter.Name)
+	assert.Equal([]string{"90s", "120s", "150s"}, parameter.Values)
+
+	parameter, err = ParseSweepParameter(`services=[],[{"name": "Express, semi-fast", "skip_stations": ["Bank", "Moorgate"], "share": 1}]`)
+	assert.Nil(err)
+	assert.Equal([]string{`[]`, `[{"name": "Express, semi-fast", "skip_stations": ["Bank", "Moorgate"], "share": 1}]`}, parameter.Values)
+
+	_, err = ParseSweepParameter("total_train_count")
+	assert.NotNil(err)
+	_, err = ParseSweepParameter("total_train_count=1,x")
+	assert.NotNil(err)
+}
+
+func TestGridPoints(t *testing.T) {
+	assert := assert.New(t)
+
+	points := GridPoints([]SweepParameter{
+		{Name: "total_train_count", Values: []string{"8", "16"}},
+		{Name: "average_time_between_trains", Values: []string{"60s", "90s", "120s"}},
+	})
+	assert.Len(points, 6)
+	assert.Equal(SweepPoint{"8", "60s"}, points[0])
+	assert.Equal(SweepPoint{"8", "90s"}, points[1])
+	assert.Equal(SweepPoint{"16", "120s"}, points[5])
+}
+
+func TestSweepRun(t *testing.T) {
+	assert := assert.New(t)
+
+	sweep := NewGridSweep(testReplicationScenario(), 3, SweepParameter{Name: "total_train_count", Values: []string{"4", "8"}})
+	sweep.Replications = 2
+	result, err := sweep.Run()
+	assert.Nil(err)
+	assert.Len(result.Points, 2)
+	assert.Len(result.Points[0].Stats, 2)
+
+	fewer, more := result.Points[0].Metric("Operating Cost"), result.Points[1].Metric("Operating Cost")
+	assert.NotNil(fewer)
+	assert.True(fewer.Mean < more.Mean)
+	assert.NotZero(result.Points[0].Metric("Mean Wait (s)").Mean)
+	assert.NotEmpty(result.String())
+
+	// trains that can't brake would never finish a run.
+	_, err = NewGridSweep(testReplicationScenario(), 3, SweepParameter{Name: "train_average_braking", Values: []string{"1.5", "0"}}).Run()
+	assert.NotNil(err)
+}
+
+func TestOptimizerBisects(t *testing.T) {
+	assert := assert.New(t)
+
+	candidates := SweepParameter{Name: "total_train_count", Values: []string{"1", "2", "3", "4"}}
+	optimizer := NewOptimizer(testReplicationScenario(), 3, candidates, ServiceTargets{})
+	optimizer.Sweep.Replications = 1
+	result, err := optimizer.Run()
+	assert.Nil(err)
+	assert.NotNil(result.Best)
+	assert.Equal("1", result.Best.Values[0])
+	assert.Len(result.Tried, 3)
+
+	optimizer.Targets = ServiceTargets{MaxP95Wait: time.Second}
+	result, err = optimizer.Run()
+	assert.Nil(err)
+	assert.Nil(result.Best)
+	assert.NotEmpty(result.String())
+}
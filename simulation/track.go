@@ -1,6 +1,9 @@
 package simulation
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 type Track struct {
 	DistanceMeters float64
@@ -10,6 +13,18 @@ type Track struct {
 
 	Begin *Station
 	End   *Station
+
+	// Traversals are the trains that have run the length of the track.
+	Traversals []Traversal
+}
+
+// Traversal is a train running the length of a track.
+type Traversal struct {
+	TrainID    int
+	DepartedAt time.Duration
+	RunTime    time.Duration
+	Load       int
+	Capacity   int
 }
 
 func (t *Track) AddTrain(train *Train) {
@@ -37,6 +52,13 @@ func (t *Track) MoveTrains(stepLength time.Duration, wallClock time.Duration) {
 
 		if train.HasReachedStation(wallClock, t) {
 			trainsToRemove = append(trainsToRemove, train)
+			t.Traversals = append(t.Traversals, Traversal{
+				TrainID:    train.ID,
+				DepartedAt: train.DepartedStation,
+				RunTime:    wallClock - train.DepartedStation,
+				Load:       len(train.Passengers),
+				Capacity:   train.Capacity,
+			})
 			train.ArrivesAtStation(wallClock, t.End)
 		}
 	}
@@ -46,6 +68,18 @@ func (t *Track) MoveTrains(stepLength time.Duration, wallClock time.Duration) {
 	}
 }
 
+// TrainAhead returns the train the given one is following: the one in front of it on the track,
+// or else the one on the platform it's heading for. Trains are kept in the order they joined the
+// track, so this sees a train stopped at the very start of it, which GetNextTrain can't.
+func (t *Track) TrainAhead(train *Train) *Train {
+	for x := 1; x < len(t.Trains); x++ {
+		if t.Trains[x] == train {
+			return t.Trains[x-1]
+		}
+	}
+	return t.GetNextTrain(math.Inf(1))
+}
+
 func (t *Track) GetNextTrain(position float64) *Train {
 	onTracks := lastTrain(t.Trains, func(train *Train) bool {
 		return train.Position > position
@@ -56,6 +90,9 @@ func (t *Track) GetNextTrain(position float64) *Train {
 	}
 
 	if t.IsOutBound {
+		if t.End.IsOutboundTerminus() { // trains turn around into the inbound platform
+			return t.End.InBoundTrain
+		}
 		return t.End.OutBoundTrain
 	} else {
 		return t.End.InBoundTrain
@@ -48,6 +48,7 @@ func NewTrain(id int, line string, maximumSpeed, acceleration, braking float64,
 type Train struct {
 	ID         int
 	Line       string
+	Service    *Service
 	IsOutbound bool
 	Passengers []*Passenger
 
@@ -55,11 +56,19 @@ type Train struct {
 
 	LeftYard         time.Duration
 	ArrivedAtStation time.Duration
+	DepartedStation  time.Duration
 	HeldAtStation    time.Duration
 
 	AverageTimeInStation time.Duration
 
+	// StepFreeBoardingTime is the extra dwell each rider who needs a step-free route
+	// adds when they get on or off.
+	StepFreeBoardingTime time.Duration
+	ExtraDwell           time.Duration
+
 	Signal Signal
+	// HeldByHand keeps the train held wherever it is, whatever the signals say, until it's released.
+	HeldByHand bool
 
 	CautionSpeed float64
 	MaximumSpeed float64
@@ -74,6 +83,13 @@ type Train struct {
 	DistanceTraveled float64
 	Speeds           []float64
 	RoundTripTimes   []time.Duration
+	RoundTrips       []RoundTrip
+}
+
+// RoundTrip is one trip out of the yard, to the end of the line and back.
+type RoundTrip struct {
+	LeftYard   time.Duration
+	ReturnedAt time.Duration
 }
 
 func (t *Train) String() string {
@@ -100,14 +116,14 @@ func (t *Train) Hold(wallClock time.Duration) {
 func (t *Train) Accelerate(stepLength time.Duration, targetSpeed float64) {
 	stepLengthSeconds := float64(stepLength) / float64(time.Second)
 	if t.Speed < targetSpeed {
-		t.Speed += (t.Acceleration / stepLengthSeconds)
+		t.Speed += t.Acceleration * stepLengthSeconds
 	}
 }
 
 func (t *Train) Decellerate(stepLength time.Duration) {
 	stepLengthSeconds := float64(stepLength) / float64(time.Second)
 	if t.Speed > 0 {
-		t.Speed -= (t.Braking / stepLengthSeconds)
+		t.Speed -= t.Braking * stepLengthSeconds
 		if t.Speed < 0 {
 			t.Speed = 0
 		}
@@ -126,13 +142,53 @@ func (t *Train) BrakingDistance() float64 {
 	return (timeToDecellerate * t.Speed) / 2.0
 }
 
+// StoppingDistance is how far the train could go if it decided to stop now, allowing for
+// the step it might spend still accelerating and the step it takes to start braking.
+func (t *Train) StoppingDistance(stepLength time.Duration) float64 {
+	stepLengthSeconds := float64(stepLength) / float64(time.Second)
+	speed := t.Speed + (t.Acceleration * stepLengthSeconds)
+	return ((speed * speed) / (2.0 * t.Braking)) + (2.0 * speed * stepLengthSeconds) + t.MinumumSafeDistance
+}
+
+// StopsAt returns if the train stops at the station, rather than running through it.
+func (t *Train) StopsAt(station *Station) bool {
+	if station.IsInboundTerminus() || station.IsOutboundTerminus() {
+		return true
+	}
+	return t.ServesStation(station.Name)
+}
+
+// ServesStation returns if the train's service stops at the named station.
+func (t *Train) ServesStation(name string) bool {
+	return t.Service == nil || t.Service.StopsAt(name)
+}
+
 func (t *Train) ShouldStartBrakingForStation(track *Track) bool {
+	if !t.StopsAt(track.End) {
+		return false
+	}
 	brakingDistance := t.BrakingDistance()
 	return float64(track.DistanceMeters)-t.Position <= brakingDistance
 }
 
 func (t *Train) EvaluateSituation(stepLength time.Duration, track *Track) {
-	trainAhead := track.GetNextTrain(t.Position)
+	if t.HeldByHand {
+		t.SendSignal(SignalHold)
+		return
+	}
+
+	trainAhead := track.TrainAhead(t)
+	if trainAhead == nil && !t.StopsAt(track.End) {
+		// we're running through the next station, so we have to watch the track beyond it too.
+		if beyond := track.End.TrackFor(track.IsOutBound); beyond != nil && len(beyond.Trains) > 0 {
+			closest := beyond.Trains[len(beyond.Trains)-1]
+			if track.DistanceMeters-t.Position+closest.Position < t.StoppingDistance(stepLength) {
+				t.SendSignal(SignalHold)
+				return
+			}
+		}
+	}
+
 	if trainAhead == nil {
 		if t.Signal != SignalGo {
 			t.SendSignal(SignalGo)
@@ -140,16 +196,18 @@ func (t *Train) EvaluateSituation(stepLength time.Duration, track *Track) {
 		return
 	}
 
-	var distanceToNextTrain float64
-	if trainAhead.Position != 0 {
-		distanceToNextTrain = trainAhead.Position - t.Position
-	} else {
-		timeRemainingInStation := t.AverageTimeInStation - trainAhead.ArrivedAtStation
-		distanceWhileWaiting := t.Speed * (float64(timeRemainingInStation) / float64(time.Second))
-		distanceToNextTrain = track.DistanceMeters - t.Position - distanceWhileWaiting
-	}
+	brakingDistance := t.StoppingDistance(stepLength)
 
-	brakingDistance := t.BrakingDistance() + t.MinumumSafeDistance
+	if !track.HasTrain(trainAhead.ID) {
+		// the train ahead is still dwelling in the next station, so we have to be able to stop short of the platform.
+		if track.DistanceMeters-t.Position < brakingDistance {
+			t.SendSignal(SignalHold)
+		} else if t.Signal == SignalHold {
+			t.SendSignal(SignalCaution)
+		}
+		return
+	}
+	distanceToNextTrain := trainAhead.Position - t.Position
 
 	switch trainAhead.Signal {
 	case SignalHold:
@@ -162,7 +220,10 @@ func (t *Train) EvaluateSituation(stepLength time.Duration, track *Track) {
 		}
 	case SignalGo, SignalCaution:
 		{
-			if distanceToNextTrain < brakingDistance {
+			if distanceToNextTrain+trainAhead.BrakingDistance() < brakingDistance {
+				// even if the train ahead braked now we couldn't stop short of where it would stop.
+				t.SendSignal(SignalHold)
+			} else if distanceToNextTrain < brakingDistance {
 				switch t.Signal {
 				case SignalGo:
 					{
@@ -173,8 +234,10 @@ func (t *Train) EvaluateSituation(stepLength time.Duration, track *Track) {
 						t.SendSignal(SignalHold)
 					}
 				}
+			} else if t.Signal == SignalHold {
+				// the train ahead has pulled far enough away to close up on it again.
+				t.SendSignal(SignalCaution)
 			}
-
 		}
 	}
 
@@ -221,47 +284,88 @@ func (t *Train) HasReachedStation(wallClock time.Duration, track *Track) bool {
 
 func (t *Train) ReturnsToYard(wallClock time.Duration, station *Station) {
 	t.RoundTripTimes = append(t.RoundTripTimes, wallClock-t.LeftYard)
+	t.RoundTrips = append(t.RoundTrips, RoundTrip{LeftYard: t.LeftYard, ReturnedAt: wallClock})
 	t.Reset()
 }
 
 func (t *Train) ArrivesAtStation(wallClock time.Duration, station *Station) {
-	t.Speed = 0
+	stopping := t.StopsAt(station)
+	if stopping {
+		t.Speed = 0
+	}
 	t.Position = 0
 	station.TrainEnters(t)
 	t.ArrivedAtStation = wallClock
-	t.DisembarkPassengers(wallClock, station)
-	t.EmbarkPassengers(wallClock, station)
+	if stopping {
+		station.publishTrain(wallClock, EventTrainArrived, t, "[%d] arrived at %s", t.ID, station.Name)
+		t.DisembarkPassengers(wallClock, station)
+		t.EmbarkPassengers(wallClock, station)
+	} else {
+		station.publishTrain(wallClock, EventTrainArrived, t, "[%d] passed through %s", t.ID, station.Name)
+	}
+}
+
+// DwellTime returns how long the train has to stay in the station.
+func (t *Train) DwellTime(station *Station) time.Duration {
+	if !t.StopsAt(station) {
+		return 0
+	}
+	return t.AverageTimeInStation + t.ExtraDwell
 }
 
 func (t *Train) Reset() {
 	t.IsOutbound = true
 	t.LeftYard = 0
 	t.ArrivedAtStation = 0
+	t.DepartedStation = 0
+	t.ExtraDwell = 0
+	if t.HeldByHand {
+		// a hold by hand doesn't follow the train into the yard.
+		t.HeldByHand = false
+		t.SendSignal(SignalGo)
+	}
+}
+
+// AddBoardingTime extends the dwell for riders who take longer to get on or off.
+func (t *Train) AddBoardingTime(p *Passenger) {
+	if p.NeedsStepFree() {
+		t.ExtraDwell += t.StepFreeBoardingTime
+	}
 }
 
 func (t *Train) Depart(wallClock time.Duration, station *Station) {
-	if wallClock-t.ArrivedAtStation >= t.AverageTimeInStation {
+	if wallClock-t.ArrivedAtStation >= t.DwellTime(station) {
 		switch t.Signal {
 		case SignalGo, SignalCaution:
 			{
+				station.RecordDeparture(wallClock, t)
+				station.publishTrain(wallClock, EventTrainDeparted, t, "[%d] departed %s", t.ID, station.Name)
 				station.TrainDeparts(t)
+				t.DepartedStation = wallClock
 				t.ArrivedAtStation = 0
+				t.ExtraDwell = 0
 			}
 		}
 	}
 }
 
 func (t *Train) EmbarkPassengers(wallClock time.Duration, station *Station) {
-	currentCapacity := t.Capacity - len(t.Passengers)
-	if currentCapacity > 0 {
-		for x := 0; x < station.WaitingPassengers.Len(); x++ {
-			p := station.WaitingPassengers.Dequeue()
-			if p.IsOutBound == t.IsOutbound { //if going the same direction
-				p.Boarding(wallClock, t)
-				t.Passengers = append(t.Passengers, p)
-			} else {
+	waitingCount := station.WaitingPassengers.Len()
+	for x := 0; x < waitingCount; x++ {
+		p := station.WaitingPassengers.Dequeue()
+		if p.IsOutBound == t.IsOutbound && p.WillBoard(t) { //if going the same direction
+			if len(t.Passengers) >= t.Capacity {
+				station.DeniedBoardings++
 				station.WaitingPassengers.Enqueue(p)
+				continue
 			}
+			p.Boarding(wallClock, t)
+			t.AddBoardingTime(p)
+			t.Passengers = append(t.Passengers, p)
+			station.Boardings++
+			station.publishPassenger(wallClock, EventPassengerBoarded, t, p, "boarded")
+		} else {
+			station.WaitingPassengers.Enqueue(p)
 		}
 	}
 }
@@ -270,8 +374,25 @@ func (t *Train) DisembarkPassengers(wallClock time.Duration, station *Station) {
 	var newPassengers []*Passenger
 	for _, rider := range t.Passengers {
 		if rider.Destination == station.Name {
+			if rider.NeedsStepFree() && !station.HasStepFreeAccess() {
+				if next := station.NextStepFreeStation(t.IsOutbound); next != nil {
+					rider.Destination = next.Name
+					rider.Reroutes++
+					newPassengers = append(newPassengers, rider)
+					continue
+				}
+				// there's nowhere left ahead they can get out, so the trip ends here, unfinished.
+				rider.Disembarking(wallClock, t)
+				t.AddBoardingTime(rider)
+				station.Alightings++
+				station.PassengerStranded(wallClock, rider)
+				continue
+			}
 			rider.Disembarking(wallClock, t)
-			station.GeneralPopulation.Enqueue(rider)
+			t.AddBoardingTime(rider)
+			station.Alightings++
+			station.publishPassenger(wallClock, EventPassengerAlighted, t, rider, "alighted")
+			station.PassengerAlights(wallClock, rider)
 		} else {
 			newPassengers = append(newPassengers, rider)
 		}
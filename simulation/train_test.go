@@ -0,0 +1,154 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestTrainStoppingDistance(t *testing.T) {
+	assert := assert.New(t)
+
+	train := NewTrain(1, "IRT 3", 20, 1, 2, 30*time.Second)
+	assert.Equal(train.MinumumSafeDistance, train.StoppingDistance(time.Second)-(1.0/4.0)-2.0)
+
+	// at 10 m/s it might still reach 11 m/s, then take 30.25m to stop, plus 22m over the two steps.
+	train.Speed = 10
+	assert.InDelta(30.25+22+train.MinumumSafeDistance, train.StoppingDistance(time.Second), 0.0001)
+}
+
+func TestTrainSpeedChangesWithTheStep(t *testing.T) {
+	assert := assert.New(t)
+
+	// four quarter-second steps change the speed as much as one whole second does.
+	train := NewTrain(1, "IRT 3", 20, 1, 2, 30*time.Second)
+	for step := 0; step < 4; step++ {
+		train.Accelerate(250*time.Millisecond, train.MaximumSpeed)
+	}
+	assert.InDelta(1.0, train.Speed, 0.0001)
+	train.Speed = 10
+	for step := 0; step < 4; step++ {
+		train.Decellerate(250 * time.Millisecond)
+	}
+	assert.InDelta(8.0, train.Speed, 0.0001)
+}
+
+func TestTrainStopsShortOfATrainInTheStation(t *testing.T) {
+	assert := assert.New(t)
+
+	first, second, third := NewStation("first", 0, nil), NewStation("second", 0, nil), NewStation("third", 0, nil)
+	first.LinkWith(second, 1000)
+	second.LinkWith(third, 1000)
+	track := first.OutBoundTrack
+
+	dwelling := NewTrain(1, "IRT 3", 20, 1, 1, 30*time.Second)
+	dwelling.IsOutbound = true
+	dwelling.ArrivedAtStation = time.Hour
+	second.TrainEnters(dwelling)
+
+	following := NewTrain(2, "IRT 3", 20, 1, 1, 30*time.Second)
+	following.IsOutbound = true
+	track.AddTrain(following)
+
+	// far enough back to stop in time, the train carries on.
+	following.Position, following.Speed = 100, 15
+	following.EvaluateSituation(time.Second, track)
+	assert.Equal(SignalGo, following.Signal)
+
+	// however long the train ahead has been dwelling, we can't count on it leaving before we get there.
+	following.Position = track.DistanceMeters - following.StoppingDistance(time.Second) + 1
+	following.EvaluateSituation(time.Second, track)
+	assert.Equal(SignalHold, following.Signal)
+}
+
+func TestTrainHoldsInTimeBehindAHeldTrain(t *testing.T) {
+	assert := assert.New(t)
+
+	first, second, third := NewStation("first", 0, nil), NewStation("second", 0, nil), NewStation("third", 0, nil)
+	first.LinkWith(second, 1000)
+	second.LinkWith(third, 1000)
+	track := first.OutBoundTrack
+
+	held := NewTrain(1, "IRT 3", 20, 1, 1, 30*time.Second)
+	held.IsOutbound = true
+	held.Signal = SignalHold
+	held.Position = 500
+	following := NewTrain(2, "IRT 3", 20, 1, 1, 30*time.Second)
+	following.IsOutbound = true
+	following.Speed = 15
+	track.AddTrain(held)
+	track.AddTrain(following)
+
+	// close enough that by the time it brakes it can't stop short, though it could if it braked this instant.
+	following.Position = held.Position - following.BrakingDistance() - following.MinumumSafeDistance - 10
+	following.EvaluateSituation(time.Second, track)
+	assert.Equal(SignalHold, following.Signal)
+}
+
+func TestTrainSeesTheTrainTurningAtTheTerminus(t *testing.T) {
+	assert := assert.New(t)
+
+	first, terminus := NewStation("first", 0, nil), NewStation("terminus", 0, nil)
+	first.LinkWith(terminus, 1000)
+
+	turning := NewTrain(1, "IRT 3", 20, 1, 1, 30*time.Second)
+	turning.IsOutbound = true
+	terminus.TrainEnters(turning)
+	assert.Equal(turning, terminus.InBoundTrain)
+	assert.Equal(turning, first.OutBoundTrack.GetNextTrain(0))
+}
+
+func TestTrainSeesATrainStoppedAtTheStartOfTheTrack(t *testing.T) {
+	assert := assert.New(t)
+
+	first, second, third := NewStation("first", 0, nil), NewStation("second", 0, nil), NewStation("third", 0, nil)
+	first.LinkWith(second, 1000)
+	second.LinkWith(third, 1000)
+	track := first.OutBoundTrack
+
+	// a train that left the platform on hold and hasn't moved since.
+	stopped := NewTrain(1, "IRT 3", 20, 1, 1, 30*time.Second)
+	stopped.IsOutbound = true
+	stopped.SendSignal(SignalHold)
+	following := NewTrain(2, "IRT 3", 20, 1, 1, 30*time.Second)
+	following.IsOutbound = true
+	following.SendSignal(SignalGo)
+	track.AddTrain(stopped)
+	track.AddTrain(following)
+
+	assert.Equal(stopped, track.TrainAhead(following))
+	assert.Nil(track.TrainAhead(stopped))
+	following.EvaluateSituation(time.Second, track)
+	assert.Equal(SignalHold, following.Signal)
+}
+
+func TestTrainHoldsBehindASlowerTrain(t *testing.T) {
+	assert := assert.New(t)
+
+	first, second, third := NewStation("first", 0, nil), NewStation("second", 0, nil), NewStation("third", 0, nil)
+	first.LinkWith(second, 1000)
+	second.LinkWith(third, 1000)
+	track := first.OutBoundTrack
+
+	slow := NewTrain(1, "IRT 3", 20, 1, 1, 30*time.Second)
+	slow.IsOutbound = true
+	slow.SendSignal(SignalCaution)
+	slow.Position, slow.Speed = 500, 1
+	following := NewTrain(2, "IRT 3", 20, 1, 1, 30*time.Second)
+	following.IsOutbound = true
+	following.SendSignal(SignalCaution)
+	following.Speed = following.CautionSpeed
+	track.AddTrain(slow)
+	track.AddTrain(following)
+
+	// coming up at caution speed on a train going slower still, it has to stop rather than run into it.
+	following.Position = slow.Position - following.StoppingDistance(time.Second) + 1
+	following.EvaluateSituation(time.Second, track)
+	assert.Equal(SignalHold, following.Signal)
+
+	// once the train ahead has pulled away it can close up again.
+	slow.Position = following.Position + following.StoppingDistance(time.Second) + 1
+	following.EvaluateSituation(time.Second, track)
+	assert.Equal(SignalCaution, following.Signal)
+}
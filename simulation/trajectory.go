@@ -0,0 +1,168 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TrainState is what a train is doing at a point on its trajectory.
+type TrainState string
+
+const (
+	TrainStateRunning  TrainState = "running"
+	TrainStateDwelling TrainState = "dwelling"
+	TrainStateHeld     TrainState = "held"
+)
+
+// ComputeChainage sets each station's distance along the line from the inbound terminus.
+func (s *Simulation) ComputeChainage() {
+	if len(s.Stations) == 0 {
+		return
+	}
+	station := s.InBoundTerminus()
+	station.Chainage = 0
+	for station.OutBoundTrack != nil {
+		station.OutBoundTrack.End.Chainage = station.Chainage + station.OutBoundTrack.DistanceMeters
+		station = station.OutBoundTrack.End
+	}
+}
+
+// TrainLocation is where a train in service is on the line.
+type TrainLocation struct {
+	Train *Train
+	// Station is set if the train is in a station, Track if it's between stations.
+	Station  *Station
+	Track    *Track
+	Chainage float64
+	State    TrainState
+}
+
+// TrainLocations returns where every train out on the line is.
+func (s *Simulation) TrainLocations() []TrainLocation {
+	return trainLocations(s.Stations)
+}
+
+func trainLocations(stations []*Station) []TrainLocation {
+	var locations []TrainLocation
+	for _, station := range stations {
+		for _, train := range []*Train{station.OutBoundTrain, station.InBoundTrain} {
+			if train == nil {
+				continue
+			}
+			state := TrainStateDwelling
+			if train.Signal == SignalHold {
+				state = TrainStateHeld
+			}
+			locations = append(locations, TrainLocation{Train: train, Station: station, Chainage: station.Chainage, State: state})
+		}
+		for _, track := range []*Track{station.OutBoundTrack, station.InBoundTrack} {
+			if track == nil {
+				continue
+			}
+			for _, train := range track.Trains {
+				chainage := track.Begin.Chainage + train.Position
+				if !track.IsOutBound {
+					chainage = track.Begin.Chainage - train.Position
+				}
+				state := TrainStateRunning
+				if train.Signal == SignalHold && train.Speed == 0 {
+					state = TrainStateHeld
+				}
+				locations = append(locations, TrainLocation{Train: train, Track: track, Chainage: chainage, State: state})
+			}
+		}
+	}
+	return locations
+}
+
+// TrajectoryPoint is where a train was at a moment in time.
+type TrajectoryPoint struct {
+	Time       time.Duration
+	Chainage   float64
+	Speed      float64
+	IsOutbound bool
+	State      TrainState
+}
+
+// NewTrajectoryRecorder returns a recorder sampling every train's position every `interval`.
+func NewTrajectoryRecorder(interval time.Duration) *TrajectoryRecorder {
+	return &TrajectoryRecorder{
+		Interval:     interval,
+		Trajectories: map[int][]TrajectoryPoint{},
+	}
+}
+
+// TrajectoryRecorder keeps the line-wide position history of every train.
+type TrajectoryRecorder struct {
+	Interval     time.Duration
+	Trajectories map[int][]TrajectoryPoint
+
+	hasSampled    bool
+	lastSampledAt time.Duration
+}
+
+// ObserveInterval returns how often the recorder samples.
+func (tr *TrajectoryRecorder) ObserveInterval() time.Duration {
+	return tr.Interval
+}
+
+// Observe samples every train's location if an interval has passed since the last sample.
+func (tr *TrajectoryRecorder) Observe(s *Simulation) {
+	if tr.hasSampled && s.WallClock-tr.lastSampledAt < tr.Interval {
+		return
+	}
+	tr.hasSampled = true
+	tr.lastSampledAt = s.WallClock
+
+	for _, location := range s.TrainLocations() {
+		tr.Trajectories[location.Train.ID] = append(tr.Trajectories[location.Train.ID], TrajectoryPoint{
+			Time:       s.WallClock,
+			Chainage:   location.Chainage,
+			Speed:      location.Train.Speed,
+			IsOutbound: location.Train.IsOutbound,
+			State:      location.State,
+		})
+	}
+}
+
+// TrainIDs returns the IDs of every train with a trajectory, in order.
+func (tr *TrajectoryRecorder) TrainIDs() []int {
+	var ids []int
+	for id := range tr.Trajectories {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// WriteCSV writes every trajectory point with a
+// "train_id,time_s,chainage_m,speed_mps,direction,state" header.
+func (tr *TrajectoryRecorder) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"train_id", "time_s", "chainage_m", "speed_mps", "direction", "state"}); err != nil {
+		return err
+	}
+	for _, id := range tr.TrainIDs() {
+		for _, point := range tr.Trajectories[id] {
+			direction := "inbound"
+			if point.IsOutbound {
+				direction = "outbound"
+			}
+			if err := writer.Write([]string{
+				strconv.Itoa(id),
+				strconv.FormatFloat(point.Time.Seconds(), 'f', -1, 64),
+				strconv.FormatFloat(point.Chainage, 'f', 1, 64),
+				strconv.FormatFloat(point.Speed, 'f', 2, 64),
+				direction,
+				string(point.State),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
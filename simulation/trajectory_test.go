@@ -0,0 +1,77 @@
+package simulation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestSimulationComputeChainage(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	assert.Zero(sim.Stations[0].Chainage)
+	assert.InDelta(868, sim.Stations[1].Chainage, 0.001)
+	assert.InDelta(868+773, sim.Stations[2].Chainage, 0.001)
+	last := sim.OutBoundTerminus()
+	assert.InDelta(sim.DistanceBetween(sim.Stations[0].Name, last.Name), last.Chainage, 0.001)
+}
+
+func TestSimulationTrainLocations(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+
+	outbound := sim.Yard.Dequeue()
+	outbound.IsOutbound = true
+	outbound.Position = 100
+	sim.Stations[1].OutBoundTrack.AddTrain(outbound)
+
+	inbound := sim.Yard.Dequeue()
+	inbound.IsOutbound = false
+	inbound.Position = 100
+	sim.Stations[2].InBoundTrack.AddTrain(inbound)
+
+	held := sim.Yard.Dequeue()
+	held.Hold(0)
+	sim.Stations[3].OutBoundTrain = held
+
+	locations := map[int]TrainLocation{}
+	for _, location := range sim.TrainLocations() {
+		locations[location.Train.ID] = location
+	}
+	assert.Len(locations, 3)
+	assert.InDelta(sim.Stations[1].Chainage+100, locations[outbound.ID].Chainage, 0.001)
+	assert.Equal(TrainStateRunning, locations[outbound.ID].State)
+	assert.InDelta(sim.Stations[2].Chainage-100, locations[inbound.ID].Chainage, 0.001)
+	assert.Equal(sim.Stations[3], locations[held.ID].Station)
+	assert.Equal(TrainStateHeld, locations[held.ID].State)
+}
+
+func TestStringLineDiagramWriteSVG(t *testing.T) {
+	assert := assert.New(t)
+	sim := createTestSimulation()
+	sim.CalculateTotalAverageRidership()
+
+	trajectories := NewTrajectoryRecorder(10 * time.Second)
+	sim.Observers = append(sim.Observers, trajectories)
+	for sim.WallClock < 20*time.Minute {
+		sim.Step()
+	}
+	assert.NotEmpty(trajectories.Trajectories)
+
+	first := trajectories.Trajectories[trajectories.TrainIDs()[0]]
+	assert.True(first[len(first)-1].Chainage > first[0].Chainage)
+
+	svg := bytes.NewBuffer(nil)
+	assert.Nil(NewStringLineDiagram(sim.Stations, trajectories).WriteSVG(svg))
+	assert.True(strings.HasPrefix(svg.String(), "<svg"))
+	assert.True(strings.Contains(svg.String(), "<polyline"))
+	assert.True(strings.Contains(svg.String(), "Times Square-42 Street"))
+
+	csv := bytes.NewBuffer(nil)
+	assert.Nil(trajectories.WriteCSV(csv))
+	assert.True(strings.HasPrefix(csv.String(), "train_id,time_s,chainage_m,speed_mps,direction,state\n"))
+}
@@ -0,0 +1,166 @@
+package simulation
+
+import "math"
+
+// PairedDifference is a paired t-test of B against A over matched samples.
+type PairedDifference struct {
+	Samples int
+	MeanA   float64
+	MeanB   float64
+
+	// Mean is the mean of B - A, with Lower and Upper bounding its confidence interval.
+	Mean  float64
+	Lower float64
+	Upper float64
+
+	StdErr float64
+	T      float64
+	// P is the two-sided p-value of the difference being zero.
+	P float64
+}
+
+// PairedTTest compares matched samples `a` and `b`, which must be the same length,
+// with a confidence interval at `confidence` (e.g. 0.95).
+func PairedTTest(a, b []float64, confidence float64) PairedDifference {
+	result := PairedDifference{Samples: len(a), P: 1}
+	if len(a) == 0 || len(a) != len(b) {
+		return result
+	}
+
+	n := float64(len(a))
+	differences := make([]float64, len(a))
+	for index := range a {
+		result.MeanA += a[index] / n
+		result.MeanB += b[index] / n
+		differences[index] = b[index] - a[index]
+		result.Mean += differences[index] / n
+	}
+	if len(a) < 2 {
+		result.Lower, result.Upper = math.Inf(-1), math.Inf(1)
+		return result
+	}
+
+	var sumSquares float64
+	for _, difference := range differences {
+		sumSquares += (difference - result.Mean) * (difference - result.Mean)
+	}
+	result.StdErr = math.Sqrt(sumSquares/(n-1)) / math.Sqrt(n)
+
+	df := n - 1
+	margin := StudentTQuantile(1-(1-confidence)/2, df) * result.StdErr
+	result.Lower, result.Upper = result.Mean-margin, result.Mean+margin
+
+	if result.StdErr == 0 {
+		// every pair moved by exactly the same amount.
+		if result.Mean != 0 {
+			result.T = math.Copysign(math.Inf(1), result.Mean)
+			result.P = 0
+		}
+		return result
+	}
+	result.T = result.Mean / result.StdErr
+	result.P = 2 * (1 - StudentTCDF(math.Abs(result.T), df))
+	return result
+}
+
+// StudentTCDF returns P(T <= t) for Student's t distribution with `df` degrees of freedom.
+func StudentTCDF(t, df float64) float64 {
+	tail := 0.5 * RegularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+	if t < 0 {
+		return tail
+	}
+	return 1 - tail
+}
+
+// StudentTQuantile returns the t such that StudentTCDF(t, df) = p.
+func StudentTQuantile(p, df float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	if p >= 1 {
+		return math.Inf(1)
+	}
+	if p < 0.5 {
+		return -StudentTQuantile(1-p, df)
+	}
+
+	low, high := 0.0, 1.0
+	for StudentTCDF(high, df) < p {
+		high *= 2
+	}
+	for x := 0; x < 100; x++ {
+		mid := (low + high) / 2
+		if StudentTCDF(mid, df) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// RegularizedIncompleteBeta returns I_x(a, b), evaluated with a continued fraction.
+func RegularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	lgammaAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lgammaAB - lgammaA - lgammaB + a*math.Log(x) + b*math.Log(1-x))
+
+	// the continued fraction converges fastest below the mean, so use the symmetry
+	// I_x(a, b) = 1 - I_{1-x}(b, a) above it.
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const maxIterations, epsilon, tiny = 300, 1e-14, 1e-300
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1.0; m <= maxIterations; m++ {
+		// even step.
+		numerator := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		result *= d * c
+
+		// odd step.
+		numerator = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		result *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return result
+}
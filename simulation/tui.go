@@ -0,0 +1,726 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var tuiLogLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// tuiEscapes are the escape sequences terminals send for the keys the UI uses.
+var tuiEscapes = []struct {
+	sequence string
+	key      string
+}{
+	{"\x1b[A", "up"},
+	{"\x1b[B", "down"},
+	{"\x1b[C", "right"},
+	{"\x1b[D", "left"},
+	{"\x1b[5~", "pgup"},
+	{"\x1b[6~", "pgdn"},
+	{"\x1b[H", "home"},
+	{"\x1b[F", "end"},
+	{"\x1bOA", "up"},
+	{"\x1bOB", "down"},
+	{"\x1bOH", "home"},
+	{"\x1bOF", "end"},
+}
+
+const tuiHelp = "space pause · n step · +/- speed · ↑↓ PgUp PgDn stations · t/T trains · esc station · h hold · i incident · l log level · s log selection · / search · q quit"
+
+// NewTUI returns a terminal UI over a generated simulation, reading keys from in and drawing to out,
+// which should be a terminal in raw mode.
+func NewTUI(s *Simulation, in io.Reader, out io.Writer) *TUI {
+	return &TUI{
+		Simulation: s,
+		Width:      120,
+		Height:     40,
+		LogLines:   8,
+		pacer:      newPacer(s),
+		in:         in,
+		out:        out,
+		logLevel:   1,
+	}
+}
+
+// TUI is an interactive terminal UI over a stepped run. It can pause, single step and change speed,
+// scroll through the stations, inspect the passengers and signals of a station or train, hold trains
+// and start incidents by hand, and filter the log.
+type TUI struct {
+	Simulation *Simulation
+	// Width and Height are the terminal's size in characters.
+	Width    int
+	Height   int
+	LogLines int
+
+	in  io.Reader
+	out io.Writer
+
+	pacer
+
+	// cursor is the station selected in the list and scroll the first one shown.
+	cursor int
+	scroll int
+	// train is the selected train; when it's nil the station under the cursor is.
+	train *Train
+
+	// logLevel indexes tuiLogLevels.
+	logLevel     int
+	logSelection bool
+	search       string
+	searching    bool
+
+	status string
+	quit   bool
+}
+
+// Run draws the UI and runs the simulation until it's quit, in is closed or ctx is done.
+func (ui *TUI) Run(ctx context.Context) error {
+	if ui.Simulation.Engine == EngineEvent {
+		return fmt.Errorf("the terminal UI needs the %s engine", EngineStepped)
+	}
+	// the UI does the drawing and pausing itself.
+	ui.Simulation.PauseTime = nil
+
+	done := make(chan struct{})
+	defer close(done)
+	keys := make(chan string)
+	go ui.readKeys(keys, done)
+
+	fmt.Fprint(ui.out, "\x1b[2J\x1b[?25l")
+	defer fmt.Fprint(ui.out, "\x1b[?25h\r\n")
+
+	ticker := time.NewTicker(pacerFrame)
+	defer ticker.Stop()
+	last := time.Now()
+	if err := ui.draw(); err != nil {
+		return err
+	}
+	for !ui.quit {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			ui.handle(key)
+		case now := <-ticker.C:
+			if ui.runFor(now.Sub(last)) {
+				ui.status = tuiFinished
+			}
+			last = now
+		}
+		if err := ui.draw(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ui *TUI) readKeys(keys chan<- string, done <-chan struct{}) {
+	defer close(keys)
+	buffer := make([]byte, 64)
+	for {
+		n, err := ui.in.Read(buffer)
+		for _, key := range parseKeys(buffer[:n]) {
+			select {
+			case keys <- key:
+			case <-done:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parseKeys splits what the terminal sent into keys: escape sequences are named, e.g. "up" or "pgdn",
+// and everything else is the character typed.
+func parseKeys(input []byte) []string {
+	var keys []string
+	for len(input) > 0 {
+		var key string
+		length := 1
+		for _, escape := range tuiEscapes {
+			if strings.HasPrefix(string(input), escape.sequence) {
+				key, length = escape.key, len(escape.sequence)
+				break
+			}
+		}
+		if len(key) == 0 {
+			switch input[0] {
+			case '\r', '\n':
+				{
+					key = "enter"
+				}
+			case 0x7f, 0x08:
+				{
+					key = "backspace"
+				}
+			case 0x1b:
+				{
+					key = "esc"
+				}
+			case 0x03:
+				{
+					key = "ctrl-c"
+				}
+			default:
+				{
+					r, size := utf8.DecodeRune(input)
+					key, length = string(r), size
+				}
+			}
+		}
+		keys = append(keys, key)
+		input = input[length:]
+	}
+	return keys
+}
+
+// tuiFinished is the status once the run is over.
+const tuiFinished = "the run is over, every train is back in the yard"
+
+func (ui *TUI) step() {
+	if ui.pacer.step() {
+		ui.status = tuiFinished
+	}
+}
+
+func (ui *TUI) handle(key string) {
+	if key == "ctrl-c" {
+		ui.quit = true
+		return
+	}
+	if ui.searching {
+		ui.typeSearch(key)
+		return
+	}
+
+	ui.status = ""
+	switch key {
+	case "q":
+		{
+			ui.quit = true
+		}
+	case " ":
+		{
+			if ui.finished {
+				ui.status = tuiFinished
+				return
+			}
+			ui.paused = !ui.paused
+		}
+	case "n", ".":
+		{
+			ui.paused = true
+			ui.step()
+		}
+	case "+", "=":
+		{
+			ui.faster()
+		}
+	case "-", "_":
+		{
+			ui.slower()
+		}
+	case "up", "k":
+		{
+			ui.moveCursor(-1)
+		}
+	case "down", "j":
+		{
+			ui.moveCursor(1)
+		}
+	case "pgup":
+		{
+			ui.moveCursor(-ui.bodyHeight())
+		}
+	case "pgdn":
+		{
+			ui.moveCursor(ui.bodyHeight())
+		}
+	case "home":
+		{
+			ui.moveCursor(-len(ui.Simulation.Stations))
+		}
+	case "end":
+		{
+			ui.moveCursor(len(ui.Simulation.Stations))
+		}
+	case "t", "right":
+		{
+			ui.selectTrain(1)
+		}
+	case "T", "left":
+		{
+			ui.selectTrain(-1)
+		}
+	case "esc":
+		{
+			ui.train = nil
+		}
+	case "h":
+		{
+			ui.toggleHold()
+		}
+	case "i":
+		{
+			ui.injectIncident()
+		}
+	case "l":
+		{
+			ui.logLevel = (ui.logLevel + 1) % len(tuiLogLevels)
+			if level := tuiLogLevels[ui.logLevel]; ui.Simulation.Events != nil && level < ui.Simulation.Events.MinimumLevel {
+				// the log only keeps info and up unless asked, so start keeping the rest to show.
+				ui.Simulation.Events.MinimumLevel = level
+			}
+		}
+	case "s":
+		{
+			ui.logSelection = !ui.logSelection
+		}
+	case "/":
+		{
+			ui.searching = true
+			ui.search = ""
+		}
+	}
+}
+
+func (ui *TUI) typeSearch(key string) {
+	switch key {
+	case "enter":
+		{
+			ui.searching = false
+		}
+	case "esc":
+		{
+			ui.searching = false
+			ui.search = ""
+		}
+	case "backspace":
+		{
+			if len(ui.search) > 0 {
+				_, size := utf8.DecodeLastRuneInString(ui.search)
+				ui.search = ui.search[:len(ui.search)-size]
+			}
+		}
+	default:
+		{
+			if utf8.RuneCountInString(key) == 1 {
+				ui.search += key
+			}
+		}
+	}
+}
+
+func (ui *TUI) moveCursor(by int) {
+	ui.train = nil
+	ui.cursor += by
+	if ui.cursor >= len(ui.Simulation.Stations) {
+		ui.cursor = len(ui.Simulation.Stations) - 1
+	}
+	if ui.cursor < 0 {
+		ui.cursor = 0
+	}
+}
+
+// selectTrain selects the next train in service along the line, or the previous one, and moves
+// the cursor to where it is.
+func (ui *TUI) selectTrain(direction int) {
+	locations := ui.Simulation.TrainLocations()
+	if len(locations) == 0 {
+		ui.status = "there are no trains out on the line"
+		return
+	}
+	next := 0
+	if direction < 0 {
+		next = len(locations) - 1
+	}
+	for index, location := range locations {
+		if location.Train == ui.train {
+			next = (index + direction + len(locations)) % len(locations)
+			break
+		}
+	}
+	location := locations[next]
+	ui.train = location.Train
+	station := location.Station
+	if station == nil {
+		station = location.Track.Begin
+	}
+	for index, candidate := range ui.Simulation.Stations {
+		if candidate == station {
+			ui.cursor = index
+		}
+	}
+}
+
+// locate returns where a train is, or false if it's in the yard.
+func (ui *TUI) locate(train *Train) (TrainLocation, bool) {
+	for _, location := range ui.Simulation.TrainLocations() {
+		if location.Train == train {
+			return location, true
+		}
+	}
+	return TrainLocation{}, false
+}
+
+func (ui *TUI) toggleHold() {
+	if ui.train == nil {
+		ui.status = "select a train with t to hold it"
+		return
+	}
+	if ui.train.HeldByHand {
+		ui.Simulation.ReleaseTrain(ui.train)
+		ui.status = fmt.Sprintf("released [%d]", ui.train.ID)
+		return
+	}
+	ui.Simulation.HoldTrain(ui.train)
+	ui.status = fmt.Sprintf("holding [%d] until it's released with h", ui.train.ID)
+}
+
+// injectIncident starts an incident on the selected train, or on a train at the selected station.
+func (ui *TUI) injectIncident() {
+	station := ui.Simulation.Stations[ui.cursor]
+	train := ui.train
+	if train != nil {
+		location, _ := ui.locate(train)
+		if location.Station == nil {
+			ui.status = fmt.Sprintf("[%d] isn't in a station", train.ID)
+			return
+		}
+		station = location.Station
+	} else if station.OutBoundTrain != nil {
+		train = station.OutBoundTrain
+	} else if station.InBoundTrain != nil {
+		train = station.InBoundTrain
+	} else {
+		ui.status = fmt.Sprintf("there's no train at %s", station.Name)
+		return
+	}
+	ui.Simulation.StartIncident(station, train)
+	ui.status = fmt.Sprintf("incident at %s, holding [%d] for %v", station.Name, train.ID, ui.Simulation.AverageIncidentDelay)
+}
+
+// tuiSchematicLines is how many lines the schematic of the line takes, with a blank line after it.
+const tuiSchematicLines = 7
+
+// bodyHeight is how many rows the station list and inspector get.
+func (ui *TUI) bodyHeight() int {
+	height := ui.Height - ui.LogLines - 4 - tuiSchematicLines
+	if height < 1 {
+		return 1
+	}
+	return height
+}
+
+func (ui *TUI) draw() error {
+	_, err := io.WriteString(ui.out, ui.render())
+	return err
+}
+
+// render returns the whole screen, drawn over the last one from the top left.
+func (ui *TUI) render() string {
+	s := ui.Simulation
+	if ui.train != nil {
+		if _, ok := ui.locate(ui.train); !ok {
+			ui.train = nil
+		}
+	}
+
+	height := ui.bodyHeight()
+	if ui.cursor < ui.scroll {
+		ui.scroll = ui.cursor
+	}
+	if ui.cursor >= ui.scroll+height {
+		ui.scroll = ui.cursor - height + 1
+	}
+
+	lines := []string{ui.header(), tuiHelp}
+	lines = append(lines, s.Schematic(ui.Width).Lines()...)
+	lines = append(lines, "")
+	listWidth := ui.Width / 2
+	if listWidth > 64 {
+		listWidth = 64
+	}
+	var inspector []string
+	if ui.train != nil {
+		inspector = ui.inspectTrain(ui.train)
+	} else {
+		inspector = ui.inspectStation(s.Stations[ui.cursor])
+	}
+	for row := 0; row < height; row++ {
+		var station, inspected string
+		if index := ui.scroll + row; index < len(s.Stations) {
+			station = ui.stationRow(index)
+		}
+		if row < len(inspector) {
+			inspected = inspector[row]
+		}
+		lines = append(lines, fit(station, listWidth)+" │ "+inspected)
+	}
+
+	lines = append(lines, ui.logTitle())
+	log := ui.logLines(ui.LogLines)
+	for row := 0; row < ui.LogLines; row++ {
+		if row < len(log) {
+			lines = append(lines, log[row])
+		} else {
+			lines = append(lines, "")
+		}
+	}
+	if ui.searching {
+		lines = append(lines, "/"+ui.search+"_")
+	} else {
+		lines = append(lines, ui.status)
+	}
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+	for index, line := range lines {
+		if index > 0 {
+			screen.WriteString("\r\n")
+		}
+		screen.WriteString(truncate(line, ui.Width))
+		screen.WriteString("\x1b[K")
+	}
+	screen.WriteString("\x1b[J")
+	return screen.String()
+}
+
+func (ui *TUI) header() string {
+	s := ui.Simulation
+	state := "running"
+	if ui.paused {
+		state = "paused"
+	}
+	if ui.finished {
+		state = "finished"
+	}
+	if s.Complete {
+		state += ", service complete"
+	}
+	if !s.Stasis {
+		state += ", warming up"
+	}
+	speed := ui.speedLabel()
+	var waiting int
+	for _, station := range s.Stations {
+		waiting += station.WaitingPassengers.Len()
+	}
+	timeOfDay := s.TimeOfDay()
+	return fmt.Sprintf("Clock: %v (%02d:%02d)  %s at %s  %d waiting, %d trains out, %d in the yard",
+		s.WallClock, int(timeOfDay.Hours()), int(timeOfDay.Minutes())%60, state, speed, waiting, len(s.TrainsInService()), s.Yard.Len())
+}
+
+func (ui *TUI) stationRow(index int) string {
+	station := ui.Simulation.Stations[index]
+	marker := "  "
+	if index == ui.cursor {
+		marker = "> "
+	}
+	row := fmt.Sprintf("%s%-18s %5d %-9s %-9s", marker, truncate(station.Name, 18), station.WaitingPassengers.Len(),
+		platformLabel(station.OutBoundTrain), platformLabel(station.InBoundTrain))
+	for _, track := range []*Track{station.OutBoundTrack, station.InBoundTrack} {
+		if track != nil && len(track.Trains) > 0 {
+			row += fmt.Sprintf(" →%s %d", track.End.Name, len(track.Trains))
+		}
+	}
+	return row
+}
+
+func platformLabel(train *Train) string {
+	if train == nil {
+		return "-"
+	}
+	return train.String()
+}
+
+func (ui *TUI) inspectStation(station *Station) []string {
+	s := ui.Simulation
+	lines := []string{
+		station.Name,
+		fmt.Sprintf("%0.1fkm along the line, %d riders a day", station.Chainage/1000, station.RidersPerDayMean),
+		fmt.Sprintf("Waiting: %d, peak %d at %v", station.WaitingPassengers.Len(), station.PeakWaiting, station.PeakWaitingAt),
+		fmt.Sprintf("Boarded: %d, alighted %d, denied boarding %d", station.Boardings, station.Alightings, station.DeniedBoardings),
+	}
+	if station.Layout != nil {
+		lines = append(lines, fmt.Sprintf("Entering: %d, exiting %d", station.Layout.AccessCount(), station.Layout.EgressCount()))
+		for _, circulation := range station.Layout.Circulations() {
+			lines = append(lines, "  "+circulation.String())
+		}
+	}
+	lines = append(lines,
+		"Outbound platform: "+ui.describePlatformTrain(station.OutBoundTrain),
+		"Inbound platform: "+ui.describePlatformTrain(station.InBoundTrain),
+	)
+	for _, track := range []*Track{station.OutBoundTrack, station.InBoundTrack} {
+		if track == nil {
+			continue
+		}
+		var trains []string
+		for _, train := range track.Trains {
+			trains = append(trains, fmt.Sprintf("[%d] %0.0fm %0.1fm/s %v", train.ID, train.Position, train.Speed, train.Signal))
+		}
+		if len(trains) == 0 {
+			trains = append(trains, "clear")
+		}
+		lines = append(lines, fmt.Sprintf("Track to %s: %s", track.End.Name, strings.Join(trains, ", ")))
+	}
+
+	lines = append(lines, "Waiting passengers:")
+	for _, p := range station.WaitingPassengers.Values() {
+		direction := "inbound"
+		if p.IsOutBound {
+			direction = "outbound"
+		}
+		lines = append(lines, fmt.Sprintf("  %v to %s, %s, waiting %v", p, p.Destination, direction, s.WallClock-p.StartedWaiting))
+		if len(lines) >= ui.bodyHeight() {
+			break
+		}
+	}
+	return lines
+}
+
+func (ui *TUI) describePlatformTrain(train *Train) string {
+	if train == nil {
+		return "-"
+	}
+	description := fmt.Sprintf("%v dwelling %v, %d of %d aboard", train, ui.Simulation.WallClock-train.ArrivedAtStation, len(train.Passengers), train.Capacity)
+	if train.HeldByHand {
+		description += ", held by hand"
+	} else if ui.Simulation.openIncident(train) != nil {
+		description += ", held by an incident"
+	}
+	return description
+}
+
+func (ui *TUI) inspectTrain(train *Train) []string {
+	s := ui.Simulation
+	direction := "inbound"
+	if train.IsOutbound {
+		direction = "outbound"
+	}
+	service := ""
+	if train.Service != nil {
+		service = ", " + train.Service.Name + " service"
+	}
+	lines := []string{fmt.Sprintf("Train [%d] %s%s, %s", train.ID, train.Line, service, direction)}
+
+	location, _ := ui.locate(train)
+	if location.Station != nil {
+		lines = append(lines, fmt.Sprintf("At %s, dwelling %v", location.Station.Name, s.WallClock-train.ArrivedAtStation))
+	} else {
+		lines = append(lines, fmt.Sprintf("%0.0fm from %s towards %s", train.Position, location.Track.Begin.Name, location.Track.End.Name))
+	}
+	lines = append(lines, fmt.Sprintf("Signal: %v (%s), speed %0.1fm/s, caution %0.1fm/s, maximum %0.1fm/s",
+		train.Signal, location.State, train.Speed, train.CautionSpeed, train.MaximumSpeed))
+	if train.HeldByHand {
+		lines = append(lines, "Held by hand, h releases it")
+	}
+	if incident := s.openIncident(train); incident != nil {
+		lines = append(lines, fmt.Sprintf("Held by an incident at %s since %v", incident.Station, incident.Start))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Aboard: %d of %d", len(train.Passengers), train.Capacity),
+		fmt.Sprintf("Left the yard at %v, %d round trips so far, %0.1fkm traveled", train.LeftYard, len(train.RoundTrips), train.DistanceTraveled/1000),
+		"Passengers:",
+	)
+	for _, p := range train.Passengers {
+		lines = append(lines, fmt.Sprintf("  %v to %s, riding %v", p, p.Destination, s.WallClock-p.StartedRiding))
+		if len(lines) >= ui.bodyHeight() {
+			break
+		}
+	}
+	return lines
+}
+
+func (ui *TUI) logFilter() EventFilter {
+	filter := EventFilter{MinimumLevel: tuiLogLevels[ui.logLevel]}
+	if ui.logSelection {
+		if ui.train != nil {
+			id := ui.train.ID
+			filter.TrainID = &id
+		} else {
+			filter.Station = ui.Simulation.Stations[ui.cursor].Name
+		}
+	}
+	return filter
+}
+
+func (ui *TUI) logTitle() string {
+	title := fmt.Sprintf("Log: %s and up", strings.ToLower(tuiLogLevels[ui.logLevel].String()))
+	if ui.logSelection {
+		if ui.train != nil {
+			title += fmt.Sprintf(", train [%d]", ui.train.ID)
+		} else {
+			title += ", " + ui.Simulation.Stations[ui.cursor].Name
+		}
+	}
+	if len(ui.search) > 0 {
+		title += fmt.Sprintf(", matching %q", ui.search)
+	}
+	return "── " + title + " " + strings.Repeat("─", 40)
+}
+
+// logLines returns the last `count` events that pass the log's filter and search, oldest first.
+func (ui *TUI) logLines(count int) []string {
+	filter := ui.logFilter()
+	search := strings.ToLower(ui.search)
+	events := ui.Simulation.Events.Recent(ui.Simulation.Events.Len())
+	var lines []string
+	for index := len(events) - 1; index >= 0 && len(lines) < count; index-- {
+		line := events[index].String()
+		if filter.Matches(events[index]) && strings.Contains(strings.ToLower(line), search) {
+			lines = append(lines, line)
+		}
+	}
+	for left, right := 0, len(lines)-1; left < right; left, right = left+1, right-1 {
+		lines[left], lines[right] = lines[right], lines[left]
+	}
+	return lines
+}
+
+// truncate cuts a line to at most width characters, not counting ANSI escape sequences.
+func truncate(line string, width int) string {
+	var visible int
+	escaped := false
+	for index, r := range line {
+		switch {
+		case escaped:
+			{
+				escaped = r < '@' || r > '~' || r == '['
+			}
+		case r == '\x1b':
+			{
+				escaped = true
+			}
+		default:
+			{
+				if visible == width {
+					if strings.Contains(line[:index], "\x1b") {
+						return line[:index] + ansiReset
+					}
+					return line[:index]
+				}
+				visible++
+			}
+		}
+	}
+	return line
+}
+
+// fit cuts or pads a line to exactly width characters.
+func fit(line string, width int) string {
+	line = truncate(line, width)
+	return line + strings.Repeat(" ", width-utf8.RuneCountInString(line))
+}
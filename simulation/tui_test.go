@@ -0,0 +1,173 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+func TestTUIParseKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"up", "down", "pgup", "pgdn", " ", "n", "enter", "esc", "backspace", "é", "q"},
+		parseKeys([]byte("\x1b[A\x1bOB\x1b[5~\x1b[6~ n\r\x1b\x7féq")))
+	assert.Empty(parseKeys(nil))
+}
+
+func TestTUIStepsAndSpeed(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	ui := NewTUI(sim, nil, new(bytes.Buffer))
+
+	ui.handle("n")
+	ui.handle("n")
+	assert.True(ui.paused)
+	assert.Equal(2*sim.StepLength, sim.WallClock)
+
+	// paused, time passing runs nothing.
+	ui.runFor(time.Second)
+	assert.Equal(2*sim.StepLength, sim.WallClock)
+
+	ui.handle(" ")
+	ui.handle("-")
+	ui.handle("-")
+	assert.Equal(2, pacerSpeeds[ui.speed])
+	ui.runFor(time.Second)
+	assert.Equal(4*sim.StepLength, sim.WallClock)
+
+	for x := 0; x < len(pacerSpeeds); x++ {
+		ui.handle("+")
+	}
+	assert.Zero(pacerSpeeds[ui.speed])
+	for !ui.finished {
+		ui.runFor(pacerFrame)
+	}
+	assert.True(sim.IsFinished())
+	assert.True(ui.paused)
+}
+
+func TestTUIHoldsTrainsAndStartsIncidents(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	ui := NewTUI(sim, nil, new(bytes.Buffer))
+	ui.handle("h")
+	assert.Equal("select a train with t to hold it", ui.status)
+
+	sim.RunUntil(30 * time.Minute)
+	ui.handle("t")
+	assert.NotNil(ui.train)
+	held := ui.train
+	location, _ := ui.locate(held)
+
+	ui.handle("h")
+	assert.True(held.HeldByHand)
+	assert.Equal(EventTrainHeld, sim.Events.Recent(1)[0].Kind)
+	for x := 0; x < 600; x++ {
+		ui.handle("n")
+	}
+	// it's stopped where it was, or as soon as it could.
+	stopped, _ := ui.locate(held)
+	assert.Zero(held.Speed)
+	assert.Equal(location.Station, stopped.Station)
+	if location.Station == nil {
+		assert.Equal(location.Track, stopped.Track)
+	}
+
+	ui.handle("h")
+	assert.False(held.HeldByHand)
+	assert.Equal(SignalGo, held.Signal)
+
+	// an incident at the station under the cursor holds a train at its platform.
+	ui.handle("esc")
+	for ui.cursor = 0; ui.cursor < len(sim.Stations); ui.cursor++ {
+		if sim.Stations[ui.cursor].OutBoundTrain != nil || sim.Stations[ui.cursor].InBoundTrain != nil {
+			break
+		}
+	}
+	assert.True(ui.cursor < len(sim.Stations))
+	incidents := len(sim.Incidents)
+	ui.handle("i")
+	assert.Len(sim.Incidents, incidents+1)
+	assert.Equal(sim.Stations[ui.cursor].Name, sim.Incidents[incidents].Station)
+	assert.Equal(EventIncidentStarted, sim.Events.Recent(1)[0].Kind)
+}
+
+func TestTUIRender(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testCheckpointScenario().NewSimulation(1)
+	sim.Generate()
+	sim.RunUntil(20 * time.Minute)
+	ui := NewTUI(sim, nil, new(bytes.Buffer))
+	ui.Height = 30
+	ui.handle(" ")
+
+	screen := ui.render()
+	assert.True(strings.HasPrefix(screen, "\x1b[H"))
+	lines := strings.Split(strings.TrimPrefix(screen, "\x1b[H"), "\r\n")
+	assert.Len(lines, ui.Height)
+	assert.True(strings.HasPrefix(lines[0], "Clock: 20m0s"))
+	assert.True(strings.Contains(lines[0], "paused"))
+	assert.True(strings.Contains(screen, "> "+sim.Stations[0].Name))
+	assert.True(strings.Contains(screen, "Waiting passengers:"))
+
+	// scrolling past the bottom of the list brings the last station into view.
+	ui.handle("end")
+	screen = ui.render()
+	assert.True(strings.Contains(screen, "> "+sim.Stations[len(sim.Stations)-1].Name))
+	assert.False(strings.Contains(screen, "  "+sim.Stations[0].Name+" "))
+
+	ui.handle("t")
+	screen = ui.render()
+	assert.True(strings.Contains(screen, "Train ["))
+	assert.True(strings.Contains(screen, "Signal: "))
+
+	// searching the log leaves only the lines that match.
+	for _, key := range parseKeys([]byte("/Releasing\r")) {
+		ui.handle(key)
+	}
+	assert.Equal("Releasing", ui.search)
+	log := ui.logLines(ui.LogLines)
+	assert.NotEmpty(log)
+	for _, line := range log {
+		assert.True(strings.Contains(line, "Releasing"))
+	}
+	ui.handle("s")
+	for _, line := range ui.logLines(ui.LogLines) {
+		assert.True(strings.Contains(line, fmt.Sprintf("Releasing [%d]", ui.train.ID)))
+	}
+
+	// the log starts keeping debug events once they're asked for.
+	assert.Equal(slog.LevelInfo, sim.Events.MinimumLevel)
+	for range tuiLogLevels[1:] {
+		ui.handle("l")
+	}
+	assert.Equal(slog.LevelDebug, sim.Events.MinimumLevel)
+}
+
+func TestTUIRun(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	out := new(bytes.Buffer)
+	ui := NewTUI(sim, strings.NewReader("nnq"), out)
+	assert.Nil(ui.Run(context.Background()))
+	assert.True(ui.quit)
+	assert.True(sim.WallClock >= 2*sim.StepLength)
+	assert.True(strings.Contains(out.String(), "Clock: "))
+
+	event := testReplicationScenario()
+	event.Config.Engine = EngineEvent
+	assert.NotNil(NewTUI(event.NewSimulation(1), strings.NewReader("q"), out).Run(context.Background()))
+}
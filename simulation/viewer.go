@@ -0,0 +1,322 @@
+package simulation
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+//go:embed viewer
+var viewerAssets embed.FS
+
+// viewerBacklog is how many messages a viewer can fall behind by before frames are dropped for it.
+const viewerBacklog = 8
+
+// NewViewer returns a web viewer for a simulation; nothing runs until Run is called.
+func NewViewer(s *Simulation) *Viewer {
+	assets, _ := fs.Sub(viewerAssets, "viewer")
+	return &Viewer{
+		Simulation: s,
+		pacer:      newPacer(s),
+		assets:     http.FileServer(http.FS(assets)),
+		commands:   make(chan string),
+		joins:      make(chan *viewerClient),
+		leaves:     make(chan *viewerClient),
+		clients:    map[*viewerClient]bool{},
+		done:       make(chan struct{}),
+	}
+}
+
+// Viewer is the terminal UI for the browser. It serves a page, from assets built into the binary,
+// that draws the line with its trains moving along it, and streams a ViewerSnapshot to every page open
+// over a WebSocket each frame. Any page can pause, step or change the speed, as in the terminal UI.
+type Viewer struct {
+	Simulation *Simulation
+	pacer
+
+	assets   http.Handler
+	commands chan string
+	joins    chan *viewerClient
+	leaves   chan *viewerClient
+	clients  map[*viewerClient]bool
+	sentAt   time.Duration
+	// done is closed when Run returns.
+	done chan struct{}
+}
+
+type viewerClient struct {
+	conn *websocketConn
+	send chan []byte
+}
+
+// ViewerLine is sent once to each page as it connects: the stations it draws the line with.
+type ViewerLine struct {
+	Type             string          `json:"type"`
+	Length           float64         `json:"length"`
+	PlatformCapacity int             `json:"platform_capacity"`
+	Stations         []ViewerStation `json:"stations"`
+}
+
+// ViewerStation is a station along the line.
+type ViewerStation struct {
+	Name     string  `json:"name"`
+	Chainage float64 `json:"chainage"`
+}
+
+// ViewerSnapshot is the state of the simulation after a step.
+type ViewerSnapshot struct {
+	Type      string  `json:"type"`
+	SimTimeS  float64 `json:"sim_time_s"`
+	TimeOfDay string  `json:"time_of_day"`
+	Paused    bool    `json:"paused"`
+	Finished  bool    `json:"finished"`
+	Complete  bool    `json:"complete"`
+	WarmingUp bool    `json:"warming_up"`
+	Speed     string  `json:"speed"`
+	Yard      int     `json:"yard"`
+	// WaitingOutbound and WaitingInbound are the passengers on each platform, in station order.
+	WaitingOutbound []int         `json:"waiting_outbound"`
+	WaitingInbound  []int         `json:"waiting_inbound"`
+	Trains          []ViewerTrain `json:"trains"`
+}
+
+// ViewerTrain is a train out on the line.
+type ViewerTrain struct {
+	ID         int        `json:"id"`
+	Chainage   float64    `json:"chainage"`
+	Outbound   bool       `json:"outbound"`
+	Signal     string     `json:"signal"`
+	State      TrainState `json:"state"`
+	Speed      float64    `json:"speed"`
+	Load       int        `json:"load"`
+	Capacity   int        `json:"capacity"`
+	HeldByHand bool       `json:"held_by_hand"`
+}
+
+// ServeHTTP serves the page at / and its WebSocket at /ws.
+func (v *Viewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/ws" {
+		v.serveWebsocket(w, r)
+		return
+	}
+	v.assets.ServeHTTP(w, r)
+}
+
+// Run runs the simulation at the pace set from the pages, sending them a snapshot every frame
+// the simulation moves, until ctx is done.
+func (v *Viewer) Run(ctx context.Context) error {
+	if v.Simulation.Engine == EngineEvent {
+		return fmt.Errorf("the web viewer needs the %s engine", EngineStepped)
+	}
+	// the viewer does the pausing itself.
+	v.Simulation.PauseTime = nil
+	defer close(v.done)
+
+	ticker := time.NewTicker(pacerFrame)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			{
+				for client := range v.clients {
+					close(client.send)
+				}
+				return nil
+			}
+		case client := <-v.joins:
+			{
+				v.clients[client] = true
+				client.send <- v.encode(v.line())
+				client.send <- v.encode(v.snapshot())
+			}
+		case client := <-v.leaves:
+			{
+				if v.clients[client] {
+					delete(v.clients, client)
+					close(client.send)
+				}
+			}
+		case command := <-v.commands:
+			{
+				v.apply(command)
+				v.broadcast()
+			}
+		case now := <-ticker.C:
+			{
+				v.runFor(now.Sub(last))
+				last = now
+				if v.Simulation.WallClock != v.sentAt {
+					v.broadcast()
+				}
+			}
+		}
+	}
+}
+
+func (v *Viewer) apply(command string) {
+	switch command {
+	case "pause":
+		{
+			v.paused = true
+		}
+	case "resume":
+		{
+			v.paused = v.finished
+		}
+	case "toggle":
+		{
+			v.paused = !v.paused || v.finished
+		}
+	case "step":
+		{
+			v.paused = true
+			v.step()
+		}
+	case "faster":
+		{
+			v.faster()
+		}
+	case "slower":
+		{
+			v.slower()
+		}
+	}
+}
+
+// broadcast sends a snapshot to every page, skipping those too far behind to take it.
+func (v *Viewer) broadcast() {
+	v.sentAt = v.Simulation.WallClock
+	message := v.encode(v.snapshot())
+	for client := range v.clients {
+		select {
+		case client.send <- message:
+		default:
+		}
+	}
+}
+
+func (v *Viewer) encode(message interface{}) []byte {
+	data, _ := json.Marshal(message)
+	return data
+}
+
+func (v *Viewer) line() ViewerLine {
+	s := v.Simulation
+	line := ViewerLine{Type: "line", PlatformCapacity: s.TrainCapacity}
+	for _, station := range s.Stations {
+		line.Stations = append(line.Stations, ViewerStation{Name: station.Name, Chainage: station.Chainage})
+	}
+	if len(s.Stations) > 0 {
+		line.Length = s.Stations[len(s.Stations)-1].Chainage
+	}
+	return line
+}
+
+func (v *Viewer) snapshot() ViewerSnapshot {
+	s := v.Simulation
+	timeOfDay := s.TimeOfDay()
+	snapshot := ViewerSnapshot{
+		Type:            "snapshot",
+		SimTimeS:        s.WallClock.Seconds(),
+		TimeOfDay:       fmt.Sprintf("%02d:%02d", int(timeOfDay.Hours()), int(timeOfDay.Minutes())%60),
+		Paused:          v.paused,
+		Finished:        v.finished,
+		Complete:        s.Complete,
+		WarmingUp:       !s.Stasis,
+		Speed:           v.speedLabel(),
+		Yard:            s.Yard.Len(),
+		WaitingOutbound: make([]int, len(s.Stations)),
+		WaitingInbound:  make([]int, len(s.Stations)),
+		Trains:          []ViewerTrain{},
+	}
+	for index, station := range s.Stations {
+		for _, p := range station.WaitingPassengers.Values() {
+			if p.IsOutBound {
+				snapshot.WaitingOutbound[index]++
+			} else {
+				snapshot.WaitingInbound[index]++
+			}
+		}
+	}
+	for _, location := range s.TrainLocations() {
+		train := location.Train
+		snapshot.Trains = append(snapshot.Trains, ViewerTrain{
+			ID:         train.ID,
+			Chainage:   location.Chainage,
+			Outbound:   train.IsOutbound,
+			Signal:     viewerSignal(train.Signal),
+			State:      location.State,
+			Speed:      train.Speed,
+			Load:       len(train.Passengers),
+			Capacity:   train.Capacity,
+			HeldByHand: train.HeldByHand,
+		})
+	}
+	return snapshot
+}
+
+func viewerSignal(signal Signal) string {
+	switch signal {
+	case SignalGo:
+		{
+			return "go"
+		}
+	case SignalCaution:
+		{
+			return "caution"
+		}
+	}
+	return "hold"
+}
+
+// serveWebsocket streams snapshots to a page and passes its commands on to Run.
+func (v *Viewer) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebsocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	client := &viewerClient{conn: conn, send: make(chan []byte, viewerBacklog)}
+	select {
+	case v.joins <- client:
+	case <-v.done:
+		return
+	}
+
+	go func() {
+		for message := range client.send {
+			if err := conn.WriteText(message); err != nil {
+				break
+			}
+		}
+		// once Run has let go of the page, stop reading from it too.
+		conn.Close()
+	}()
+
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var command struct {
+			Command string `json:"command"`
+		}
+		if json.Unmarshal(message, &command) != nil {
+			continue
+		}
+		select {
+		case v.commands <- command.Command:
+		case <-v.done:
+			return
+		}
+	}
+	select {
+	case v.leaves <- client:
+	case <-v.done:
+	}
+}
@@ -0,0 +1,244 @@
+// The viewer's page: draws the line from the "line" message and animates the trains between
+// the "snapshot" messages the binary streams over /ws. Everything is served by the binary itself.
+(function () {
+  "use strict";
+
+  // the right margin leaves room for the last station's name, which slants off to the right.
+  var margin = 60, marginRight = 140;
+  var outboundY = 170, inboundY = 215, heatHeight = 40;
+  var height = inboundY + heatHeight + 40;
+
+  var canvas = document.getElementById("line");
+  var context = canvas.getContext("2d");
+  var status = document.getElementById("status");
+  var pauseButton = document.getElementById("pause");
+
+  var socket = null;
+  var line = null;
+  var snapshot = null;
+  // trains by id: where each was drawn from and is heading to, and when it set off.
+  var trains = {};
+  var snapshotAt = 0, snapshotInterval = 50;
+  var mouse = null;
+
+  function connect() {
+    socket = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+    socket.onmessage = function (event) {
+      var message = JSON.parse(event.data);
+      if (message.type === "line") {
+        line = message;
+        trains = {};
+      } else if (message.type === "snapshot") {
+        receive(message);
+      }
+    };
+    socket.onclose = function () {
+      status.textContent = "disconnected, retrying…";
+      setTimeout(connect, 2000);
+    };
+  }
+
+  function send(command) {
+    if (socket && socket.readyState === WebSocket.OPEN) {
+      socket.send(JSON.stringify({ command: command }));
+    }
+  }
+
+  function receive(message) {
+    var now = performance.now();
+    if (snapshotAt > 0) {
+      snapshotInterval = Math.min(Math.max(now - snapshotAt, 16), 250);
+    }
+    snapshotAt = now;
+    var next = {};
+    message.trains.forEach(function (train) {
+      var previous = trains[train.id];
+      var from = train.chainage;
+      // a train that turned round at a terminus jumps to its new track rather than sliding.
+      if (previous && previous.train.outbound === train.outbound) {
+        from = position(previous, now);
+      }
+      next[train.id] = { train: train, from: from, to: train.chainage };
+    });
+    trains = next;
+    snapshot = message;
+    showStatus();
+  }
+
+  function position(entry, now) {
+    var t = Math.min((now - snapshotAt) / snapshotInterval, 1);
+    return entry.from + (entry.to - entry.from) * t;
+  }
+
+  function showStatus() {
+    var s = snapshot;
+    var state = s.finished ? "finished" : s.paused ? "paused" : "running";
+    if (s.complete) {
+      state += ", service complete";
+    }
+    if (s.warming_up) {
+      state += ", warming up";
+    }
+    var waiting = 0;
+    s.waiting_outbound.forEach(function (n) { waiting += n; });
+    s.waiting_inbound.forEach(function (n) { waiting += n; });
+    status.textContent = "Clock: " + clock(s.sim_time_s) + " (" + s.time_of_day + ")  " + state + " at " + s.speed +
+      "  " + waiting + " waiting, " + s.trains.length + " trains out, " + s.yard + " in the yard";
+    pauseButton.textContent = s.paused ? "resume" : "pause";
+    pauseButton.disabled = s.finished;
+  }
+
+  function clock(seconds) {
+    var h = Math.floor(seconds / 3600), m = Math.floor(seconds / 60) % 60, sec = Math.floor(seconds) % 60;
+    return h + "h" + pad(m) + "m" + pad(sec) + "s";
+  }
+
+  function pad(n) {
+    return (n < 10 ? "0" : "") + n;
+  }
+
+  function x(chainage) {
+    var width = canvas.clientWidth - margin - marginRight;
+    if (!line || line.length <= 0) {
+      return margin;
+    }
+    return margin + chainage / line.length * width;
+  }
+
+  function loadColor(train) {
+    var load = train.capacity > 0 ? train.load / train.capacity : 0;
+    if (load >= 0.9) {
+      return "#e5534b";
+    }
+    if (load >= 0.5) {
+      return "#d4a72c";
+    }
+    return "#57ab5a";
+  }
+
+  function heatColor(waiting) {
+    var heat = Math.min(waiting / Math.max(line.platform_capacity, 1), 1);
+    return "rgba(229, 83, 75, " + (0.25 + 0.75 * heat) + ")";
+  }
+
+  function resize() {
+    var ratio = window.devicePixelRatio || 1;
+    canvas.style.height = height + "px";
+    canvas.width = canvas.clientWidth * ratio;
+    canvas.height = height * ratio;
+    context.setTransform(ratio, 0, 0, ratio, 0, 0);
+  }
+
+  function draw(now) {
+    context.clearRect(0, 0, canvas.clientWidth, height);
+    if (line && snapshot) {
+      drawLine();
+      drawTrains(now);
+    }
+    requestAnimationFrame(draw);
+  }
+
+  function drawLine() {
+    context.strokeStyle = "#5c6370";
+    context.lineWidth = 3;
+    [outboundY, inboundY].forEach(function (y) {
+      context.beginPath();
+      context.moveTo(x(0), y);
+      context.lineTo(x(line.length), y);
+      context.stroke();
+    });
+
+    context.font = "12px ui-monospace, Menlo, Consolas, monospace";
+    line.stations.forEach(function (station, index) {
+      var sx = x(station.chainage);
+      context.fillStyle = "#d8dde4";
+      context.fillRect(sx - 1, outboundY - 7, 3, inboundY - outboundY + 14);
+
+      // platform queues: outbound above the line, inbound below, taller and redder the more are waiting.
+      var outbound = snapshot.waiting_outbound[index], inbound = snapshot.waiting_inbound[index];
+      var scale = heatHeight / Math.max(line.platform_capacity, 1);
+      context.fillStyle = heatColor(outbound);
+      context.fillRect(sx - 4, outboundY - 10 - Math.min(outbound * scale, heatHeight), 8, Math.min(outbound * scale, heatHeight));
+      context.fillStyle = heatColor(inbound);
+      context.fillRect(sx - 4, inboundY + 10, 8, Math.min(inbound * scale, heatHeight));
+
+      context.save();
+      context.translate(sx, outboundY - heatHeight - 16);
+      context.rotate(-Math.PI / 4);
+      context.fillStyle = "#adbac7";
+      context.fillText(station.name, 0, 0);
+      context.restore();
+    });
+  }
+
+  function drawTrains(now) {
+    var hovered = null;
+    Object.keys(trains).forEach(function (id) {
+      var entry = trains[id], train = entry.train;
+      var tx = x(position(entry, now)), ty = train.outbound ? outboundY : inboundY;
+      var direction = train.outbound ? 1 : -1;
+
+      context.beginPath();
+      context.moveTo(tx + 8 * direction, ty);
+      context.lineTo(tx - 6 * direction, ty - 7);
+      context.lineTo(tx - 6 * direction, ty + 7);
+      context.closePath();
+      context.fillStyle = loadColor(train);
+      context.fill();
+      if (train.signal !== "go" || train.held_by_hand) {
+        context.lineWidth = train.held_by_hand ? 3 : 2;
+        context.strokeStyle = train.signal === "caution" ? "#d4a72c" : "#e5534b";
+        context.stroke();
+      }
+      if (mouse && Math.abs(mouse.x - tx) < 9 && Math.abs(mouse.y - ty) < 9) {
+        hovered = { train: train, x: tx, y: ty };
+      }
+    });
+    if (hovered) {
+      drawTooltip(hovered);
+    }
+  }
+
+  function drawTooltip(hovered) {
+    var train = hovered.train;
+    var lines = [
+      "train " + train.id + (train.outbound ? " outbound" : " inbound"),
+      train.state + ", signal " + train.signal + (train.held_by_hand ? " (held by hand)" : ""),
+      train.load + "/" + train.capacity + " aboard",
+      (train.speed * 3.6).toFixed(0) + " km/h"
+    ];
+    var width = 0;
+    lines.forEach(function (text) { width = Math.max(width, context.measureText(text).width); });
+    var left = Math.min(hovered.x + 12, canvas.clientWidth - width - 20);
+    var top = hovered.y + 14;
+    context.fillStyle = "rgba(34, 39, 46, 0.95)";
+    context.fillRect(left, top, width + 12, lines.length * 16 + 8);
+    context.fillStyle = "#d8dde4";
+    lines.forEach(function (text, index) {
+      context.fillText(text, left + 6, top + 18 + index * 16);
+    });
+  }
+
+  canvas.addEventListener("mousemove", function (event) {
+    var bounds = canvas.getBoundingClientRect();
+    mouse = { x: event.clientX - bounds.left, y: event.clientY - bounds.top };
+  });
+  canvas.addEventListener("mouseleave", function () { mouse = null; });
+
+  pauseButton.addEventListener("click", function () { send("toggle"); });
+  document.getElementById("step").addEventListener("click", function () { send("step"); });
+  document.getElementById("slower").addEventListener("click", function () { send("slower"); });
+  document.getElementById("faster").addEventListener("click", function () { send("faster"); });
+  document.addEventListener("keydown", function (event) {
+    var commands = { " ": "toggle", "n": "step", ".": "step", "+": "faster", "=": "faster", "-": "slower" };
+    if (commands[event.key]) {
+      event.preventDefault();
+      send(commands[event.key]);
+    }
+  });
+  window.addEventListener("resize", resize);
+
+  resize();
+  connect();
+  requestAnimationFrame(draw);
+})();
@@ -0,0 +1,155 @@
+package simulation
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/blendlabs/go-assert"
+)
+
+// viewerTestClient is the browser's end of a viewer's WebSocket.
+type viewerTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialViewer(t *testing.T, server *httptest.Server) *viewerTestClient {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := server.Listener.Addr().String()
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: "+host+"\r\nOrigin: http://"+host+"\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake failed: %s", response.Status)
+	}
+	return &viewerTestClient{conn: conn, reader: reader}
+}
+
+func (c *viewerTestClient) send(message string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x81, 0x80 | byte(len(message))}
+	frame = append(frame, mask...)
+	for index := range message {
+		frame = append(frame, message[index]^mask[index%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *viewerTestClient) receive(t *testing.T, message interface{}) string {
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := uint64(header[1] & 0x7f)
+	if length == 126 {
+		var extended [2]byte
+		io.ReadFull(c.reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	} else if length == 127 {
+		var extended [8]byte
+		io.ReadFull(c.reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(payload, &envelope)
+	if message != nil {
+		json.Unmarshal(payload, message)
+	}
+	return envelope.Type
+}
+
+func TestViewerStreamsSnapshots(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := testReplicationScenario().NewSimulation(1)
+	sim.Generate()
+	viewer := NewViewer(sim)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- viewer.Run(ctx) }()
+	server := httptest.NewServer(viewer)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/")
+	assert.Nil(err)
+	page, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.True(strings.Contains(string(page), "<canvas"))
+	response, err = http.Get(server.URL + "/viewer.js")
+	assert.Nil(err)
+	response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+
+	client := dialViewer(t, server)
+	var line ViewerLine
+	assert.Equal("line", client.receive(t, &line))
+	assert.Len(line.Stations, len(sim.Stations))
+	assert.Equal(sim.Stations[len(sim.Stations)-1].Chainage, line.Length)
+
+	// pausing with a step runs just the one.
+	client.send(`{"command": "step"}`)
+	var snapshot ViewerSnapshot
+	for {
+		assert.Equal("snapshot", client.receive(t, &snapshot))
+		if snapshot.Paused {
+			break
+		}
+	}
+	clock := snapshot.SimTimeS
+	client.send(`{"command": "step"}`)
+	assert.Equal("snapshot", client.receive(t, &snapshot))
+	assert.True(snapshot.Paused)
+	assert.InDelta(clock+sim.StepLength.Seconds(), snapshot.SimTimeS, 0.001)
+	assert.Len(snapshot.WaitingOutbound, len(sim.Stations))
+	assert.Len(snapshot.Trains, len(sim.TrainsInService()))
+
+	client.send(`{"command": "faster"}`)
+	assert.Equal("snapshot", client.receive(t, &snapshot))
+	assert.Equal("30 steps/s", snapshot.Speed)
+
+	cancel()
+	assert.Nil(<-stopped)
+}
+
+func TestViewerRefusesOtherSites(t *testing.T) {
+	assert := assert.New(t)
+
+	viewer := NewViewer(testReplicationScenario().NewSimulation(1))
+	request := httptest.NewRequest(http.MethodGet, "http://localhost:8080/ws", nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	request.Header.Set("Origin", "http://example.com")
+	recorder := httptest.NewRecorder()
+	viewer.ServeHTTP(recorder, request)
+	assert.Equal(http.StatusForbidden, recorder.Code)
+
+	request.Header.Del("Upgrade")
+	recorder = httptest.NewRecorder()
+	viewer.ServeHTTP(recorder, request)
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,228 @@
+package simulation
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is what RFC 6455 appends to the client's key to accept a connection.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocketMaxMessage is the largest message read from a client; the viewer's are tiny.
+const websocketMaxMessage = 1 << 16
+
+// WebSocket opcodes.
+const (
+	websocketContinuation = 0x0
+	websocketText         = 0x1
+	websocketBinary       = 0x2
+	websocketClose        = 0x8
+	websocketPing         = 0x9
+	websocketPong         = 0xa
+)
+
+// websocketConn is the server end of a WebSocket connection, with just enough of RFC 6455 for
+// the viewer: whole text messages out, messages in, pings answered and closes honoured.
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+}
+
+// upgradeWebsocket takes over an HTTP request asking for a WebSocket. It refuses pages from other
+// sites, so only the viewer's own page can connect.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, fmt.Errorf("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported websocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if len(key) == 0 {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("missing websocket key")
+	}
+	if origin := r.Header.Get("Origin"); len(origin) > 0 {
+		if parsed, err := url.Parse(origin); err != nil || parsed.Host != r.Host {
+			http.Error(w, "cross-origin WebSocket refused", http.StatusForbidden)
+			return nil, fmt.Errorf("cross-origin websocket from %q", origin)
+		}
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets aren't supported here", http.StatusInternalServerError)
+		return nil, fmt.Errorf("response can't be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(buffered, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err := buffered.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocketConn{conn: conn, reader: buffered.Reader}, nil
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends a text message.
+func (wc *websocketConn) WriteText(message []byte) error {
+	return wc.writeFrame(websocketText, message)
+}
+
+// writeFrame sends one whole, unmasked frame, as servers do.
+func (wc *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		{
+			header = append(header, byte(len(payload)))
+		}
+	case len(payload) <= 0xffff:
+		{
+			header = append(header, 126)
+			header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+		}
+	default:
+		{
+			header = append(header, 127)
+			header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+		}
+	}
+	if _, err := wc.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next message from the client, put back together if it came in pieces.
+// It answers pings along the way, and returns io.EOF once the client closes the connection.
+func (wc *websocketConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		final, opcode, payload, err := wc.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case websocketClose:
+			{
+				if len(payload) > 2 {
+					payload = payload[:2]
+				}
+				wc.writeFrame(websocketClose, payload)
+				return nil, io.EOF
+			}
+		case websocketPing:
+			{
+				if err := wc.writeFrame(websocketPong, payload); err != nil {
+					return nil, err
+				}
+			}
+		case websocketPong:
+			{
+				// the viewer never pings, so there's nothing to match it with.
+			}
+		case websocketText, websocketBinary, websocketContinuation:
+			{
+				message = append(message, payload...)
+				if len(message) > websocketMaxMessage {
+					return nil, fmt.Errorf("websocket message over %d bytes", websocketMaxMessage)
+				}
+				if final {
+					return message, nil
+				}
+			}
+		default:
+			{
+				return nil, fmt.Errorf("unknown websocket opcode %#x", opcode)
+			}
+		}
+	}
+}
+
+// readFrame reads one frame; clients must mask what they send.
+func (wc *websocketConn) readFrame() (final bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(wc.reader, header[:]); err != nil {
+		return
+	}
+	final = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		err = errors.New("websocket frame from the client isn't masked")
+		return
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		{
+			var extended [2]byte
+			if _, err = io.ReadFull(wc.reader, extended[:]); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(extended[:]))
+		}
+	case 127:
+		{
+			var extended [8]byte
+			if _, err = io.ReadFull(wc.reader, extended[:]); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(extended[:])
+		}
+	}
+	if length > websocketMaxMessage {
+		err = fmt.Errorf("websocket frame of %d bytes is over %d", length, websocketMaxMessage)
+		return
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(wc.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(wc.reader, payload); err != nil {
+		return
+	}
+	for index := range payload {
+		payload[index] ^= mask[index%4]
+	}
+	return
+}
+
+// Close closes the connection without a closing handshake.
+func (wc *websocketConn) Close() error {
+	return wc.conn.Close()
+}